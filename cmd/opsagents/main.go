@@ -3,7 +3,9 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -21,12 +23,15 @@ func main() {
 		Long:  `An intelligent Claude AI agent that automates deploying pre-built applications to AWS ECS Fargate with natural language commands`,
 	}
 
+	var stream bool
+	var autoApprove bool
+
 	var agentCmd = &cobra.Command{
 		Use:   "agent",
 		Short: "Start the Claude AI agent",
 		Long:  `Start an interactive session with the Claude AI agent to deploy applications`,
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := runAgent(); err != nil {
+			if err := runAgent(stream, autoApprove); err != nil {
 				fmt.Printf("Agent failed: %v\n", err)
 				os.Exit(1)
 			}
@@ -46,6 +51,75 @@ func main() {
 		},
 	}
 
+	var planJSON bool
+
+	var planCmd = &cobra.Command{
+		Use:   "plan",
+		Short: "Preview an ECS deployment without changing anything",
+		Long:  `Show which resources a deployment would create, update or leave unchanged, and the task definition it would register`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runPlan(planJSON); err != nil {
+				fmt.Printf("Plan failed: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var toRevision int32
+	var listRevisions bool
+
+	var rollbackCmd = &cobra.Command{
+		Use:   "rollback",
+		Short: "Roll the ECS service back to an earlier task definition revision",
+		Long:  `Update the ECS service to an earlier task definition revision (the previous one by default) and wait for it to become stable`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runRollback(toRevision, listRevisions); err != nil {
+				fmt.Printf("Rollback failed: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var switchBackCmd = &cobra.Command{
+		Use:   "switch-back",
+		Short: "Shift traffic back to the previous blue/green task set",
+		Long:  `Move the load balancer traffic of a blue/green service back to the task set kept by the last deployment`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runSwitchBack(); err != nil {
+				fmt.Printf("Switch-back failed: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var inventoryAll bool
+
+	var inventoryCmd = &cobra.Command{
+		Use:   "inventory",
+		Short: "List AWS resources managed by opsagents",
+		Long:  `List the resources tagged managed-by=opsagents for the configured service and environment`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runInventory(inventoryAll); err != nil {
+				fmt.Printf("Inventory failed: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var recommendDays int
+
+	var recommendCmd = &cobra.Command{
+		Use:   "recommend",
+		Short: "Recommend a Fargate task size from recent utilization",
+		Long:  `Read the service's Container Insights CPU and memory utilization and propose a cheaper or safer Fargate task size`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runRecommend(recommendDays); err != nil {
+				fmt.Printf("Recommendation failed: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
 	var configCmd = &cobra.Command{
 		Use:   "config",
 		Short: "Generate default configuration",
@@ -64,15 +138,29 @@ func main() {
 		Long:  `Remove all AWS ECS resources including services, clusters, load balancers, and log groups`,
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Println("Starting cleanup of AWS ECS resources...")
-			if err := runCleanup(); err != nil {
+			if err := runCleanup(autoApprove); err != nil {
 				fmt.Printf("Cleanup failed: %v\n", err)
 				os.Exit(1)
 			}
 		},
 	}
 
+	agentCmd.Flags().BoolVar(&stream, "stream", true, "Stream Claude's responses and tool progress as they happen")
+	agentCmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "Run mutating and destructive tools without asking for approval (for CI)")
+	planCmd.Flags().BoolVar(&planJSON, "json", false, "Print the plan and task definition as JSON")
+	rollbackCmd.Flags().Int32Var(&toRevision, "to-revision", 0, "Revision to roll back to (default: the previous revision)")
+	rollbackCmd.Flags().BoolVar(&listRevisions, "list", false, "Only list recent revisions")
+	inventoryCmd.Flags().BoolVar(&inventoryAll, "all", false, "List the resources of every service and environment")
+	recommendCmd.Flags().IntVar(&recommendDays, "days", 14, "Days of utilization to base the recommendation on (1-30)")
+	cleanupCmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "Delete resources without asking for confirmation (for CI)")
+
 	rootCmd.AddCommand(agentCmd)
 	rootCmd.AddCommand(deployCmd)
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(rollbackCmd)
+	rootCmd.AddCommand(switchBackCmd)
+	rootCmd.AddCommand(inventoryCmd)
+	rootCmd.AddCommand(recommendCmd)
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(cleanupCmd)
 
@@ -82,7 +170,7 @@ func main() {
 	}
 }
 
-func runAgent() error {
+func runAgent(stream, autoApprove bool) error {
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
@@ -94,7 +182,7 @@ func runAgent() error {
 	}
 
 	fmt.Println("🤖 Claude OpsAgent - Your AI DevOps Assistant")
-	fmt.Println("Type 'exit' or 'quit' to stop the agent")
+	fmt.Println("Type 'exit' or 'quit' to stop the agent, 'reset' to start a new conversation")
 	fmt.Println("Available commands:")
 	fmt.Println("  - 'deploy to production' - Deploy pre-built containers to AWS ECS")
 	fmt.Println("  - 'check deployment status' - Get current deployment status")
@@ -103,6 +191,14 @@ func runAgent() error {
 
 	scanner := bufio.NewScanner(os.Stdin)
 
+	if autoApprove {
+		fmt.Println("⚠️  Auto-approve is on: tools will change and delete resources without asking")
+		fmt.Println()
+		claudeAgent.SetApprover(agent.AutoApprover{})
+	} else {
+		claudeAgent.SetApprover(agent.NewTerminalApprover(scanner, os.Stdout))
+	}
+
 	for {
 		fmt.Print("You: ")
 		if !scanner.Scan() {
@@ -119,7 +215,22 @@ func runAgent() error {
 			break
 		}
 
+		if input == "reset" {
+			claudeAgent.ResetConversation()
+			fmt.Println("🧹 Conversation history cleared")
+			fmt.Println()
+			continue
+		}
+
 		fmt.Print("🤖 Claude: ")
+		if stream {
+			// Output is printed by the handler as it arrives
+			printer := &streamPrinter{}
+			claudeAgent.SendMessageStream(context.Background(), input, printer.print)
+			fmt.Println()
+			continue
+		}
+
 		response, err := claudeAgent.SendMessage(context.Background(), input)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
@@ -133,7 +244,6 @@ func runAgent() error {
 	return nil
 }
 
-
 func runDeploy() error {
 	cfg, err := config.Load()
 	if err != nil {
@@ -146,33 +256,13 @@ func runDeploy() error {
 		return fmt.Errorf("failed to initialize ECS deployer: %w", err)
 	}
 
-	// Create ECS configuration
-	ecsConfig := deploy.ECSConfig{
-		ClusterName:        cfg.AWS.ECS.ClusterName,
-		ServiceName:        cfg.AWS.ECS.ServiceName,
-		TaskDefinitionName: cfg.AWS.ECS.TaskDefinitionName,
-		VpcId:              cfg.AWS.ECS.VpcId,
-		SubnetIds:          cfg.AWS.ECS.SubnetIds,
-		SecurityGroupIds:   cfg.AWS.ECS.SecurityGroupIds,
-		LoadBalancerName:   cfg.AWS.ECS.LoadBalancerName,
-		WebAppImage:        cfg.Images.AppImage,
-		DatabaseImage:      cfg.Images.Neo4jImage,
-		WebAppPort:         cfg.AWS.ECS.WebAppPort,
-		DatabasePort:       cfg.AWS.ECS.DatabasePort,
-		DatabaseHTTPPort:   cfg.AWS.ECS.DatabaseHTTPPort,
-		WebAppMemory:       cfg.AWS.ECS.WebAppMemory,
-		WebAppCPU:          cfg.AWS.ECS.WebAppCPU,
-		DatabaseMemory:     cfg.AWS.ECS.DatabaseMemory,
-		DatabaseCPU:        cfg.AWS.ECS.DatabaseCPU,
-		Environment:        cfg.AWS.ECS.Environment,
-		CreateSecrets:      cfg.AWS.ECS.CreateSecrets,
-		CreateEFS:          cfg.AWS.ECS.CreateEFS,
-		EFSVolumeId:        cfg.AWS.ECS.EFSVolumeId,
-		Mode:               cfg.AWS.ECS.Mode,
+	ecsConfig := deploy.NewECSConfig(cfg)
+	if err := deploy.ValidateConfig(ecsConfig); err != nil {
+		return err
 	}
 
 	// Create ECS cluster
-	if err := deployer.CreateCluster(ecsConfig.ClusterName); err != nil {
+	if err := deployer.CreateCluster(ecsConfig); err != nil {
 		fmt.Printf("ECS cluster might already exist: %v\n", err)
 	}
 
@@ -189,73 +279,188 @@ func runDeploy() error {
 	}
 
 	// Create ECS service (for both advanced and basic deployments)
-	if err := deployer.CreateService(ecsConfig); err != nil {
+	err = deployer.CreateService(ecsConfig)
+	if rollout := deployer.LastRollout(); rollout != nil {
+		fmt.Println()
+		fmt.Print(rollout.String())
+	}
+	if err != nil {
 		return fmt.Errorf("failed to create ECS service: %w", err)
 	}
 
 	// Wait for service to be stable
 	if err := deployer.WaitForServiceStable(ecsConfig.ClusterName, ecsConfig.ServiceName); err != nil {
+		var circuitBreaker *deploy.CircuitBreakerError
+		if errors.As(err, &circuitBreaker) {
+			return err
+		}
 		return fmt.Errorf("failed waiting for service to be stable: %w", err)
 	}
 
 	fmt.Println("Deployment completed successfully!")
+	if url, err := deployer.ServiceURL(ecsConfig); err == nil {
+		fmt.Printf("URL: %s\n", url)
+	}
 	return nil
 }
 
-func runCleanup() error {
+func runPlan(asJSON bool) error {
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Initialize ECS deployer
 	deployer, err := deploy.NewECSDeployer()
 	if err != nil {
 		return fmt.Errorf("failed to initialize ECS deployer: %w", err)
 	}
 
-	// Create ECS configuration
-	ecsConfig := deploy.ECSConfig{
-		ClusterName:        cfg.AWS.ECS.ClusterName,
-		ServiceName:        cfg.AWS.ECS.ServiceName,
-		TaskDefinitionName: cfg.AWS.ECS.TaskDefinitionName,
-		VpcId:              cfg.AWS.ECS.VpcId,
-		SubnetIds:          cfg.AWS.ECS.SubnetIds,
-		SecurityGroupIds:   cfg.AWS.ECS.SecurityGroupIds,
-		LoadBalancerName:   cfg.AWS.ECS.LoadBalancerName,
-		WebAppImage:        cfg.Images.AppImage,
-		DatabaseImage:      cfg.Images.Neo4jImage,
-		WebAppPort:         cfg.AWS.ECS.WebAppPort,
-		DatabasePort:       cfg.AWS.ECS.DatabasePort,
-		DatabaseHTTPPort:   cfg.AWS.ECS.DatabaseHTTPPort,
-		WebAppMemory:       cfg.AWS.ECS.WebAppMemory,
-		WebAppCPU:          cfg.AWS.ECS.WebAppCPU,
-		DatabaseMemory:     cfg.AWS.ECS.DatabaseMemory,
-		DatabaseCPU:        cfg.AWS.ECS.DatabaseCPU,
-		Environment:        cfg.AWS.ECS.Environment,
-		CreateSecrets:      cfg.AWS.ECS.CreateSecrets,
-		CreateEFS:          cfg.AWS.ECS.CreateEFS,
-		EFSVolumeId:        cfg.AWS.ECS.EFSVolumeId,
-		Mode:               cfg.AWS.ECS.Mode,
+	// Keep stdout valid JSON by sending progress output to stderr
+	progress := io.Writer(os.Stdout)
+	if asJSON {
+		progress = os.Stderr
 	}
 
-	// Confirm cleanup with user
-	fmt.Printf("This will delete the following resources:\n")
-	fmt.Printf("  - ECS Service: %s\n", ecsConfig.ServiceName)
-	fmt.Printf("  - ECS Cluster: %s (if empty)\n", ecsConfig.ClusterName)
-	fmt.Printf("  - Task Definition: %s (all revisions)\n", ecsConfig.TaskDefinitionName)
-	fmt.Printf("  - Load Balancer: %s-alb\n", ecsConfig.ServiceName)
-	fmt.Printf("  - Target Group: %s-tg\n", ecsConfig.ServiceName)
-	fmt.Printf("  - CloudWatch Log Groups\n")
-	fmt.Print("\nAre you sure you want to proceed? (yes/no): ")
-
-	var response string
-	fmt.Scanln(&response)
-	
-	if strings.ToLower(response) != "yes" && strings.ToLower(response) != "y" {
-		fmt.Println("Cleanup cancelled.")
+	plan, err := deployer.Plan(deploy.NewECSConfig(cfg), progress)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		planJSON, err := plan.JSON()
+		if err != nil {
+			return fmt.Errorf("failed to render plan: %w", err)
+		}
+		fmt.Println(string(planJSON))
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Print(plan.String())
+	return nil
+}
+
+func runRollback(toRevision int32, listOnly bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	deployer, err := deploy.NewECSDeployer()
+	if err != nil {
+		return fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := deploy.NewECSConfig(cfg)
+
+	revisions, err := deployer.ListRevisions(ecsConfig, 10)
+	if err != nil {
+		return err
+	}
+	fmt.Print(deploy.RevisionsSummary(ecsConfig, revisions))
+	if listOnly {
 		return nil
 	}
+	fmt.Println()
+
+	result, err := deployer.Rollback(ecsConfig, toRevision)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(result.String())
+	fmt.Println("✅ Rollback completed successfully!")
+	return nil
+}
+
+func runSwitchBack() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	deployer, err := deploy.NewECSDeployer()
+	if err != nil {
+		return fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	result, err := deployer.SwitchBack(deploy.NewECSConfig(cfg))
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(result)
+	fmt.Println("✅ Switch-back completed successfully!")
+	return nil
+}
+
+func runInventory(all bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	deployer, err := deploy.NewECSDeployer()
+	if err != nil {
+		return fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	resources, err := deployer.Inventory(deploy.NewECSConfig(cfg), all)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(deploy.InventorySummary(resources))
+	return nil
+}
+
+func runRecommend(days int) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	deployer, err := deploy.NewECSDeployer()
+	if err != nil {
+		return fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	recommendation, err := deployer.Recommend(deploy.NewECSConfig(cfg), days)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(recommendation.String())
+	return nil
+}
+
+func runCleanup(autoApprove bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Initialize ECS deployer
+	deployer, err := deploy.NewECSDeployer()
+	if err != nil {
+		return fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := deploy.NewECSConfig(cfg)
+
+	// Confirm cleanup with user
+	fmt.Print(deploy.CleanupSummary(ecsConfig))
+	if !autoApprove {
+		fmt.Print("\nAre you sure you want to proceed? (yes/no): ")
+
+		var response string
+		fmt.Scanln(&response)
+
+		if strings.ToLower(response) != "yes" && strings.ToLower(response) != "y" {
+			fmt.Println("Cleanup cancelled.")
+			return nil
+		}
+	}
 
 	// Run cleanup
 	if err := deployer.Cleanup(ecsConfig); err != nil {
@@ -265,3 +470,33 @@ func runCleanup() error {
 	fmt.Println("✅ Cleanup completed successfully!")
 	return nil
 }
+
+// streamPrinter renders agent stream events in the terminal, re-printing the
+// Claude prompt when text resumes after tool output.
+type streamPrinter struct {
+	afterTool bool
+}
+
+func (p *streamPrinter) print(event agent.StreamEvent) {
+	switch event.Type {
+	case agent.EventText:
+		if p.afterTool {
+			fmt.Print("🤖 Claude: ")
+			p.afterTool = false
+		}
+		fmt.Print(event.Text)
+	case agent.EventToolStart:
+		fmt.Printf("\n🔧 Running %s...\n", event.ToolName)
+	case agent.EventToolResult:
+		if event.IsError {
+			fmt.Printf("❌ %s failed\n", event.ToolName)
+		} else {
+			fmt.Printf("✅ %s finished\n", event.ToolName)
+		}
+		p.afterTool = true
+	case agent.EventDone:
+		fmt.Println()
+	case agent.EventError:
+		fmt.Printf("\nError: %v\n", event.Err)
+	}
+}
@@ -11,6 +11,16 @@ type Config struct {
 	AgentName string `mapstructure:"agent_name"`
 	Port      int    `mapstructure:"port"`
 	LogLevel  string `mapstructure:"log_level"`
+	// Environment names the deployment, e.g. staging or production
+	Environment string `mapstructure:"environment"`
+
+	// State records the resources created by deployments
+	State struct {
+		Backend  string `mapstructure:"backend"` // local or s3
+		Path     string `mapstructure:"path"`
+		S3Bucket string `mapstructure:"s3_bucket"`
+		S3Prefix string `mapstructure:"s3_prefix"`
+	} `mapstructure:"state"`
 
 	Git struct {
 		Repository string `mapstructure:"repository"`
@@ -26,7 +36,9 @@ type Config struct {
 
 	AWS struct {
 		Region string `mapstructure:"region"`
-		ECS    struct {
+		// Tags are added to every resource a deployment creates
+		Tags map[string]string `mapstructure:"tags"`
+		ECS  struct {
 			ClusterName        string            `mapstructure:"cluster_name"`
 			ServiceName        string            `mapstructure:"service_name"`
 			TaskDefinitionName string            `mapstructure:"task_definition_name"`
@@ -46,6 +58,150 @@ type Config struct {
 			CreateEFS          bool              `mapstructure:"create_efs"`
 			EFSVolumeId        string            `mapstructure:"efs_volume_id"`
 			Mode               string            `mapstructure:"mode"`
+			// DeploymentStrategy is rolling (in-place update), blue_green or canary
+			DeploymentStrategy string `mapstructure:"deployment_strategy"`
+			BlueGreen          struct {
+				HealthCheckTimeout  int  `mapstructure:"health_check_timeout"` // seconds
+				KeepPreviousTaskSet bool `mapstructure:"keep_previous_task_set"`
+			} `mapstructure:"blue_green"`
+			Canary struct {
+				Steps        []int `mapstructure:"steps"`         // traffic percentages
+				StepDuration int   `mapstructure:"step_duration"` // seconds
+				Max5xxCount  int   `mapstructure:"max_5xx_count"`
+			} `mapstructure:"canary"`
+			// DesiredCount is the initial task count; Scaling lets Application
+			// Auto Scaling adjust it
+			DesiredCount int32 `mapstructure:"desired_count"`
+			Scaling      struct {
+				Enabled           bool    `mapstructure:"enabled"`
+				MinTasks          int32   `mapstructure:"min_tasks"`
+				MaxTasks          int32   `mapstructure:"max_tasks"`
+				CPUTarget         float64 `mapstructure:"cpu_target"`          // percent, 0 disables
+				MemoryTarget      float64 `mapstructure:"memory_target"`       // percent, 0 disables
+				RequestsPerTarget float64 `mapstructure:"requests_per_target"` // ALB requests per task, 0 disables
+				ScaleInCooldown   int32   `mapstructure:"scale_in_cooldown"`   // seconds
+				ScaleOutCooldown  int32   `mapstructure:"scale_out_cooldown"`  // seconds
+				Scheduled         []struct {
+					Name     string `mapstructure:"name"`
+					Schedule string `mapstructure:"schedule"`
+					Timezone string `mapstructure:"timezone"`
+					MinTasks int32  `mapstructure:"min_tasks"`
+					MaxTasks int32  `mapstructure:"max_tasks"`
+				} `mapstructure:"scheduled"`
+			} `mapstructure:"scaling"`
+			// Deployment configures rolling deployments and the ECS circuit breaker
+			Deployment struct {
+				CircuitBreaker         bool  `mapstructure:"circuit_breaker"`
+				Rollback               bool  `mapstructure:"rollback"`
+				MinimumHealthyPercent  int32 `mapstructure:"minimum_healthy_percent"`
+				MaximumPercent         int32 `mapstructure:"maximum_percent"`
+				HealthCheckGracePeriod int32 `mapstructure:"health_check_grace_period"` // seconds
+			} `mapstructure:"deployment"`
+			// HTTPS adds a 443 listener with an ACM certificate, either the
+			// configured one or one requested for DomainName
+			HTTPS struct {
+				Enabled        bool   `mapstructure:"enabled"`
+				CertificateArn string `mapstructure:"certificate_arn"`
+				DomainName     string `mapstructure:"domain_name"`
+				HostedZoneId   string `mapstructure:"hosted_zone_id"` // for DNS validation records
+				SSLPolicy      string `mapstructure:"ssl_policy"`
+				RedirectHTTP   bool   `mapstructure:"redirect_http"`
+			} `mapstructure:"https"`
+			// DNS points an alias record at the load balancer; the zone and
+			// name default to the HTTPS ones
+			DNS struct {
+				Enabled      bool   `mapstructure:"enabled"`
+				HostedZoneId string `mapstructure:"hosted_zone_id"`
+				RecordName   string `mapstructure:"record_name"`
+			} `mapstructure:"dns"`
+			// SecurityGroups creates dedicated groups for the load balancer,
+			// tasks and EFS when security_group_ids is empty
+			SecurityGroups struct {
+				Create       bool     `mapstructure:"create"`
+				AllowedCIDRs []string `mapstructure:"allowed_cidrs"` // clients allowed on 80/443
+			} `mapstructure:"security_groups"`
+			// LoadBalancerSubnetIds and TaskSubnetIds split subnet_ids by role;
+			// when empty they are discovered from the route tables of the VPC
+			LoadBalancerSubnetIds []string `mapstructure:"load_balancer_subnet_ids"` // public
+			TaskSubnetIds         []string `mapstructure:"task_subnet_ids"`          // private with NAT
+			AssignPublicIp        bool     `mapstructure:"assign_public_ip"`
+			// IAM creates a per-service execution role and task role; with
+			// create_roles off the named roles must already exist
+			IAM struct {
+				CreateRoles            bool              `mapstructure:"create_roles"`
+				ExecutionRoleName      string            `mapstructure:"execution_role_name"`
+				TaskRoleName           string            `mapstructure:"task_role_name"`
+				TaskRolePolicyArns     []string          `mapstructure:"task_role_policy_arns"`
+				TaskRoleInlinePolicies map[string]string `mapstructure:"task_role_inline_policies"` // name -> JSON document
+			} `mapstructure:"iam"`
+			// TargetGroup configures the load balancer health check and the
+			// target group attributes; existing groups are brought in line
+			TargetGroup struct {
+				HealthCheckPath     string `mapstructure:"health_check_path"`
+				Matcher             string `mapstructure:"matcher"`  // HTTP codes, e.g. 200 or 200-299
+				Interval            int32  `mapstructure:"interval"` // seconds
+				Timeout             int32  `mapstructure:"timeout"`  // seconds
+				HealthyThreshold    int32  `mapstructure:"healthy_threshold"`
+				UnhealthyThreshold  int32  `mapstructure:"unhealthy_threshold"`
+				DeregistrationDelay int32  `mapstructure:"deregistration_delay"` // seconds
+				SlowStart           int32  `mapstructure:"slow_start"`           // seconds, 0 disables
+				Stickiness          bool   `mapstructure:"stickiness"`
+				StickinessDuration  int32  `mapstructure:"stickiness_duration"` // seconds
+			} `mapstructure:"target_group"`
+			// CapacityProviders runs the tasks on a capacity provider strategy
+			// instead of the FARGATE launch type; empty keeps the launch type
+			CapacityProviders []struct {
+				Provider string `mapstructure:"provider"` // FARGATE or FARGATE_SPOT
+				Base     int32  `mapstructure:"base"`     // tasks always placed on this provider
+				Weight   int32  `mapstructure:"weight"`   // share of the tasks beyond the base
+			} `mapstructure:"capacity_providers"`
+			// TaskCPU and TaskMemory set the task size; 0 uses the sum of the
+			// container sizes
+			TaskCPU    int32 `mapstructure:"task_cpu"`
+			TaskMemory int32 `mapstructure:"task_memory"`
+			// ContainerHealth configures the health checks, startup order and
+			// timeouts of the default webapp and database containers
+			ContainerHealth struct {
+				WebAppCommand   string `mapstructure:"webapp_command"`   // "" disables
+				DatabaseCommand string `mapstructure:"database_command"` // "" disables
+				Interval        int32  `mapstructure:"interval"`         // seconds
+				Timeout         int32  `mapstructure:"timeout"`          // seconds
+				Retries         int32  `mapstructure:"retries"`
+				StartPeriod     int32  `mapstructure:"start_period"`  // seconds
+				StartTimeout    int32  `mapstructure:"start_timeout"` // seconds the webapp waits for the database
+				StopTimeout     int32  `mapstructure:"stop_timeout"`  // seconds before a container is killed
+			} `mapstructure:"container_health"`
+			// Containers replaces the webapp and database settings above with
+			// any list of containers; empty means webapp + Neo4j
+			Containers []struct {
+				Name        string            `mapstructure:"name"`
+				Image       string            `mapstructure:"image"`
+				CPU         int32             `mapstructure:"cpu"`
+				Memory      int32             `mapstructure:"memory"` // MiB
+				Ports       []int32           `mapstructure:"ports"`
+				Environment map[string]string `mapstructure:"environment"`
+				Secrets     map[string]string `mapstructure:"secrets"` // env var -> secret ARN or generated secret key
+				MountPoints []struct {
+					Volume   string `mapstructure:"volume"`
+					Path     string `mapstructure:"path"`
+					ReadOnly bool   `mapstructure:"read_only"`
+				} `mapstructure:"mount_points"`
+				Essential   *bool    `mapstructure:"essential"` // default true
+				Command     []string `mapstructure:"command"`
+				HealthCheck struct {
+					Command     []string `mapstructure:"command"`
+					Interval    int32    `mapstructure:"interval"` // seconds
+					Timeout     int32    `mapstructure:"timeout"`  // seconds
+					Retries     int32    `mapstructure:"retries"`
+					StartPeriod int32    `mapstructure:"start_period"` // seconds
+				} `mapstructure:"health_check"`
+				DependsOn []struct {
+					Container string `mapstructure:"container"`
+					Condition string `mapstructure:"condition"` // START, COMPLETE, SUCCESS or HEALTHY
+				} `mapstructure:"depends_on"`
+				StartTimeout int32 `mapstructure:"start_timeout"` // seconds
+				StopTimeout  int32 `mapstructure:"stop_timeout"`  // seconds
+			} `mapstructure:"containers"`
 		} `mapstructure:"ecs"`
 		Lightsail struct {
 			ServiceName   string            `mapstructure:"service_name"`
@@ -58,10 +214,25 @@ type Config struct {
 	} `mapstructure:"aws"`
 
 	Claude struct {
+		// Model backend: bedrock (InvokeModel), bedrock-converse or anthropic
+		Provider    string  `mapstructure:"provider"`
 		Region      string  `mapstructure:"region"`
 		ModelID     string  `mapstructure:"model_id"`
 		Temperature float32 `mapstructure:"temperature"`
 		MaxTokens   int     `mapstructure:"max_tokens"`
+		// Anthropic API settings, used by the anthropic provider only
+		APIKeyEnv string `mapstructure:"api_key_env"`
+		BaseURL   string `mapstructure:"base_url"`
+		// Conversation history budget; older turns are summarized and dropped
+		HistoryMaxTurns  int `mapstructure:"history_max_turns"`
+		HistoryMaxTokens int `mapstructure:"history_max_tokens"`
+		// Maximum number of model calls per message in the tool loop
+		MaxToolIterations int `mapstructure:"max_tool_iterations"`
+		// Tool selection; an empty enabled list allows every registered tool
+		Tools struct {
+			Enabled  []string `mapstructure:"enabled"`
+			Disabled []string `mapstructure:"disabled"`
+		} `mapstructure:"tools"`
 	} `mapstructure:"claude"`
 
 	Auth struct {
@@ -80,6 +251,10 @@ func Load() (*Config, error) {
 	viper.SetDefault("agent_name", "bigfootgolf-agent")
 	viper.SetDefault("port", 8080)
 	viper.SetDefault("log_level", "info")
+	viper.SetDefault("environment", "production")
+	viper.SetDefault("state.backend", "local")
+	viper.SetDefault("state.path", ".opsagents/state")
+	viper.SetDefault("state.s3_prefix", "opsagents/state")
 	viper.SetDefault("images.registry", "ghcr.io/jrzesz33")
 	viper.SetDefault("images.app_image", "ghcr.io/jrzesz33/bigfootgolf-webapp:sha-1756ddd")
 	viper.SetDefault("images.neo4j_image", "ghcr.io/jrzesz33/bigfootgolf-db:sha-1756ddd")
@@ -95,19 +270,73 @@ func Load() (*Config, error) {
 	viper.SetDefault("aws.ecs.webapp_cpu", 256)
 	viper.SetDefault("aws.ecs.database_memory", 512)
 	viper.SetDefault("aws.ecs.database_cpu", 256)
+	viper.SetDefault("aws.ecs.task_cpu", 0)
+	viper.SetDefault("aws.ecs.task_memory", 0)
 	viper.SetDefault("aws.ecs.load_balancer_name", "bigfootgolf-alb")
 	viper.SetDefault("aws.ecs.create_secrets", false)
 	viper.SetDefault("aws.ecs.create_efs", false)
 	viper.SetDefault("aws.ecs.mode", "prod")
+	viper.SetDefault("aws.ecs.deployment_strategy", "rolling")
+	viper.SetDefault("aws.ecs.blue_green.health_check_timeout", 300)
+	viper.SetDefault("aws.ecs.blue_green.keep_previous_task_set", true)
+	viper.SetDefault("aws.ecs.canary.steps", []int{10, 50, 100})
+	viper.SetDefault("aws.ecs.canary.step_duration", 120)
+	viper.SetDefault("aws.ecs.canary.max_5xx_count", 5)
+	viper.SetDefault("aws.ecs.desired_count", 1)
+	viper.SetDefault("aws.ecs.scaling.enabled", false)
+	viper.SetDefault("aws.ecs.scaling.min_tasks", 1)
+	viper.SetDefault("aws.ecs.scaling.max_tasks", 4)
+	viper.SetDefault("aws.ecs.scaling.cpu_target", 70)
+	viper.SetDefault("aws.ecs.scaling.memory_target", 0)
+	viper.SetDefault("aws.ecs.scaling.requests_per_target", 0)
+	viper.SetDefault("aws.ecs.scaling.scale_in_cooldown", 300)
+	viper.SetDefault("aws.ecs.scaling.scale_out_cooldown", 60)
+	viper.SetDefault("aws.ecs.deployment.circuit_breaker", true)
+	viper.SetDefault("aws.ecs.deployment.rollback", true)
+	viper.SetDefault("aws.ecs.deployment.minimum_healthy_percent", 100)
+	viper.SetDefault("aws.ecs.deployment.maximum_percent", 200)
+	viper.SetDefault("aws.ecs.deployment.health_check_grace_period", 60)
+	viper.SetDefault("aws.ecs.https.enabled", false)
+	viper.SetDefault("aws.ecs.https.ssl_policy", "ELBSecurityPolicy-TLS13-1-2-2021-06")
+	viper.SetDefault("aws.ecs.https.redirect_http", true)
+	viper.SetDefault("aws.ecs.dns.enabled", false)
+	viper.SetDefault("aws.ecs.security_groups.create", false)
+	viper.SetDefault("aws.ecs.security_groups.allowed_cidrs", []string{"0.0.0.0/0"})
+	viper.SetDefault("aws.ecs.assign_public_ip", true)
+	viper.SetDefault("aws.ecs.iam.create_roles", false)
+	viper.SetDefault("aws.ecs.target_group.health_check_path", "/health")
+	viper.SetDefault("aws.ecs.target_group.matcher", "200")
+	viper.SetDefault("aws.ecs.target_group.interval", 30)
+	viper.SetDefault("aws.ecs.target_group.timeout", 5)
+	viper.SetDefault("aws.ecs.target_group.healthy_threshold", 2)
+	viper.SetDefault("aws.ecs.target_group.unhealthy_threshold", 3)
+	viper.SetDefault("aws.ecs.target_group.deregistration_delay", 300)
+	viper.SetDefault("aws.ecs.target_group.slow_start", 0)
+	viper.SetDefault("aws.ecs.target_group.stickiness", false)
+	viper.SetDefault("aws.ecs.target_group.stickiness_duration", 86400)
+	viper.SetDefault("aws.ecs.container_health.webapp_command", "")
+	viper.SetDefault("aws.ecs.container_health.database_command", `cypher-shell -a bolt://localhost:7687 ${NEO4J_PASSWORD:+-u neo4j -p "$NEO4J_PASSWORD"} "RETURN 1" || exit 1`)
+	viper.SetDefault("aws.ecs.container_health.interval", 15)
+	viper.SetDefault("aws.ecs.container_health.timeout", 10)
+	viper.SetDefault("aws.ecs.container_health.retries", 5)
+	viper.SetDefault("aws.ecs.container_health.start_period", 60)
+	viper.SetDefault("aws.ecs.container_health.start_timeout", 120)
+	viper.SetDefault("aws.ecs.container_health.stop_timeout", 30)
 	// Lightsail defaults (kept for compatibility)
 	viper.SetDefault("aws.lightsail.service_name", "bigfootgolf-service")
 	viper.SetDefault("aws.lightsail.power", "nano")
 	viper.SetDefault("aws.lightsail.scale", 1)
 	viper.SetDefault("aws.lightsail.container_name", "bigfootgolf-app")
+	viper.SetDefault("claude.provider", "bedrock")
 	viper.SetDefault("claude.region", "us-east-1")
 	viper.SetDefault("claude.model_id", "anthropic.claude-3-sonnet-20240229-v1:0")
 	viper.SetDefault("claude.temperature", 0.1)
 	viper.SetDefault("claude.max_tokens", 4096)
+	viper.SetDefault("claude.history_max_turns", 20)
+	viper.SetDefault("claude.history_max_tokens", 60000)
+	viper.SetDefault("claude.max_tool_iterations", 10)
+	viper.SetDefault("claude.api_key_env", "ANTHROPIC_API_KEY")
+	viper.SetDefault("claude.base_url", "https://api.anthropic.com")
 	viper.SetDefault("auth.github_token_env", "GITHUB_TOKEN")
 	viper.SetDefault("auth.aws_profile_env", "AWS_PROFILE")
 
@@ -132,6 +361,13 @@ func CreateDefaultConfig() error {
 	config := `agent_name: bigfootgolf-agent
 port: 8080
 log_level: info
+environment: production      # Deployment environment, used to key the state
+
+state:
+  backend: local             # local or s3
+  path: .opsagents/state     # Directory for the local backend
+  s3_bucket: ""              # Bucket for the s3 backend
+  s3_prefix: opsagents/state
 
 images:
   registry: docker.io
@@ -140,12 +376,16 @@ images:
 
 aws:
   region: us-east-1
+  tags: {}                   # Extra tags for every created resource, e.g. {team: platform}
   ecs:
     cluster_name: bigfootgolf-cluster
     service_name: bigfootgolf-service
     task_definition_name: bigfootgolf-task
     vpc_id: ""  # Will be auto-detected or set via environment
     subnet_ids: []  # Will be auto-detected or set via environment
+    load_balancer_subnet_ids: []  # Public subnets for the load balancer, auto-detected from route tables
+    task_subnet_ids: []  # Private subnets with a NAT route for tasks, auto-detected from route tables
+    assign_public_ip: true  # Only needed when tasks run in public subnets
     security_group_ids: []  # Will be auto-detected or set via environment
     load_balancer_name: bigfootgolf-alb
     webapp_port: 8000
@@ -155,10 +395,79 @@ aws:
     webapp_cpu: 256
     database_memory: 512
     database_cpu: 256
+    task_cpu: 0                # Task size, 0 sums the containers; must be a valid Fargate combination
+    task_memory: 0             # e.g. task_cpu: 512 with task_memory: 1024-4096 in steps of 1024
     create_secrets: false      # Enable to create AWS Secrets Manager secrets
     create_efs: false         # Enable to create EFS volume for Neo4j persistence
     efs_volume_id: ""         # EFS Volume ID (auto-created if create_efs is true)
     mode: "prod"              # Application mode: prod, dev, test
+    deployment_strategy: rolling  # rolling, blue_green or canary
+    blue_green:
+      health_check_timeout: 300   # Seconds the new task set has to pass health checks
+      keep_previous_task_set: true  # Keep the old task set running for switch-back
+    canary:
+      steps: [10, 50, 100]        # Percentage of traffic on the new task set per step
+      step_duration: 120          # Seconds each step is watched before the next one
+      max_5xx_count: 5            # 5xx responses per step that trigger a rollback
+    desired_count: 1              # Initial number of tasks
+    scaling:
+      enabled: false              # Let Application Auto Scaling manage the task count
+      min_tasks: 1
+      max_tasks: 4
+      cpu_target: 70              # Average CPU percent to track, 0 disables
+      memory_target: 0            # Average memory percent to track, 0 disables
+      requests_per_target: 0      # ALB requests per task to track, 0 disables
+      scale_in_cooldown: 300
+      scale_out_cooldown: 60
+      scheduled: []               # e.g. [{name: business-hours, schedule: "cron(0 8 ? * MON-FRI *)", min_tasks: 2, max_tasks: 6}]
+    deployment:                   # Rolling deployments
+      circuit_breaker: true       # Stop deployments whose tasks keep failing
+      rollback: true              # Roll back to the last working revision when stopped
+      minimum_healthy_percent: 100
+      maximum_percent: 200
+      health_check_grace_period: 60  # Seconds before load balancer health checks count
+    https:
+      enabled: false              # Serve the app on 443 with an ACM certificate
+      certificate_arn: ""         # Existing ACM certificate; otherwise one is requested
+      domain_name: ""             # Domain of the requested certificate, e.g. app.example.com
+      hosted_zone_id: ""          # Route 53 zone for the DNS validation record
+      ssl_policy: ELBSecurityPolicy-TLS13-1-2-2021-06
+      redirect_http: true         # Redirect port 80 to HTTPS
+    dns:
+      enabled: false              # Point a Route 53 alias record at the load balancer
+      hosted_zone_id: ""          # Defaults to https.hosted_zone_id
+      record_name: ""             # e.g. app.example.com, defaults to https.domain_name
+    security_groups:              # Used when security_group_ids is empty
+      create: false               # Dedicated groups for the load balancer, tasks and EFS
+      allowed_cidrs: ["0.0.0.0/0"]  # Clients allowed to reach the load balancer on 80/443
+    iam:
+      create_roles: false         # Create <service>-execution-role and <service>-task-role
+      execution_role_name: ""     # Existing role to use instead, e.g. ecsTaskExecutionRole
+      task_role_name: ""          # Existing role the application runs as
+      task_role_policy_arns: []   # Managed policies for the task role
+      task_role_inline_policies: {}  # Inline policies for the task role, name: JSON document
+    target_group:                 # Load balancer health check, fixed on existing groups too
+      health_check_path: /health
+      matcher: "200"              # Healthy HTTP codes, e.g. "200-299" or "200,302"
+      interval: 30                # Seconds between health checks
+      timeout: 5                  # Seconds before a check fails, less than interval
+      healthy_threshold: 2
+      unhealthy_threshold: 3
+      deregistration_delay: 300   # Seconds draining targets keep their requests
+      slow_start: 0               # Seconds new targets ramp up, 0 or 30-900
+      stickiness: false           # Pin clients to a task with a load balancer cookie
+      stickiness_duration: 86400  # Cookie lifetime in seconds
+    capacity_providers: []        # Empty: FARGATE launch type; e.g. [{provider: FARGATE, base: 1, weight: 1}, {provider: FARGATE_SPOT, weight: 3}]
+    container_health:             # Default webapp + database layout
+      webapp_command: ""          # e.g. "curl -fs http://localhost:8000/health || exit 1", empty disables
+      database_command: 'cypher-shell -a bolt://localhost:7687 ${NEO4J_PASSWORD:+-u neo4j -p "$NEO4J_PASSWORD"} "RETURN 1" || exit 1'
+      interval: 15
+      timeout: 10
+      retries: 5
+      start_period: 60            # Seconds of failed checks ignored while Neo4j starts
+      start_timeout: 120          # Seconds the webapp waits for a healthy database
+      stop_timeout: 30            # Seconds containers get to shut down
+    containers: []                # Empty: webapp + Neo4j database from the settings above
     environment:
       ENV: production
       PORT: "8000"
@@ -173,10 +482,18 @@ aws:
       PORT: "8000"
 
 claude:
+  provider: bedrock            # bedrock, bedrock-converse or anthropic
   region: us-east-1
   model_id: anthropic.claude-3-sonnet-20240229-v1:0
   temperature: 0.1
   max_tokens: 4096
+  history_max_turns: 20        # Conversation turns kept in memory
+  history_max_tokens: 60000    # Approximate token budget for the history
+  max_tool_iterations: 10      # Maximum tool round-trips per message
+  api_key_env: ANTHROPIC_API_KEY   # API key variable for the anthropic provider
+  tools:
+    enabled: []                # Only offer these tools to Claude (empty = all)
+    disabled: []               # Never offer these tools, e.g. [cleanup_resources]
 
 auth:
   github_token_env: GITHUB_TOKEN  # Environment variable for GitHub PAT
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"opsagents/pkg/tools"
+)
+
+// ApprovalRequest describes a tool call that needs human approval.
+type ApprovalRequest struct {
+	ToolName string
+	Risk     tools.Risk
+	// Summary describes what the call will change
+	Summary string
+	Input   map[string]interface{}
+}
+
+// Approver decides whether a mutating or destructive tool call may run.
+type Approver interface {
+	Approve(ctx context.Context, req ApprovalRequest) (bool, error)
+}
+
+// ApproverFunc adapts a function to the Approver interface, e.g. to route
+// approvals through an API instead of the terminal.
+type ApproverFunc func(ctx context.Context, req ApprovalRequest) (bool, error)
+
+func (f ApproverFunc) Approve(ctx context.Context, req ApprovalRequest) (bool, error) {
+	return f(ctx, req)
+}
+
+// AutoApprover approves every tool call. Intended for CI where nobody is
+// around to answer prompts.
+type AutoApprover struct{}
+
+func (AutoApprover) Approve(context.Context, ApprovalRequest) (bool, error) {
+	return true, nil
+}
+
+// TerminalApprover asks for approval on the terminal. It shares the scanner of
+// the interactive session so prompts and chat input do not compete for stdin.
+type TerminalApprover struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+func NewTerminalApprover(in *bufio.Scanner, out io.Writer) *TerminalApprover {
+	return &TerminalApprover{in: in, out: out}
+}
+
+func (t *TerminalApprover) Approve(ctx context.Context, req ApprovalRequest) (bool, error) {
+	fmt.Fprintf(t.out, "\n⚠️  %s is %s and needs your approval.\n", req.ToolName, req.Risk)
+	fmt.Fprint(t.out, req.Summary)
+	fmt.Fprint(t.out, "\nDo you want to proceed? (yes/no): ")
+
+	if !t.in.Scan() {
+		if err := t.in.Err(); err != nil {
+			return false, fmt.Errorf("failed to read approval: %w", err)
+		}
+		return false, nil
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(t.in.Text()))
+	return answer == "yes" || answer == "y", nil
+}
+
+// approvalSummary describes a tool call, preferring the tool's own summary.
+func approvalSummary(ctx context.Context, tool tools.Tool, input map[string]interface{}) string {
+	if summarizer, ok := tool.(tools.Summarizer); ok {
+		if summary := summarizer.Summarize(ctx, input); summary != "" {
+			return summary
+		}
+	}
+
+	inputJSON, err := json.MarshalIndent(input, "  ", "  ")
+	if err != nil {
+		return fmt.Sprintf("Claude wants to run %s.\n", tool.Name())
+	}
+	return fmt.Sprintf("Claude wants to run %s with input:\n  %s\n", tool.Name(), inputJSON)
+}
@@ -2,39 +2,32 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
 
 	"opsagents/internal/config"
+	"opsagents/pkg/builder"
 	"opsagents/pkg/deploy"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
-	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
-	"os"
+	"opsagents/pkg/logs"
+	"opsagents/pkg/tools"
 )
 
 type ClaudeAgent struct {
-	client      *bedrockruntime.Client
+	provider    Provider
 	config      *config.Config
-	modelID     string
 	temperature float32
+	maxTokens   int
+	history     *Conversation
+	usage       Usage
+	tools       *tools.Registry
+	approver    Approver
+	// Caps the number of model calls per user message
+	maxToolIterations int
 }
 
-type Tool struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	InputSchema InputSchema `json:"input_schema"`
-}
+// Tool is the model-facing definition of a registered tool.
+type Tool = tools.Definition
 
-type InputSchema struct {
-	Type       string                 `json:"type"`
-	Properties map[string]interface{} `json:"properties"`
-	Required   []string               `json:"required"`
-}
+type InputSchema = tools.InputSchema
 
 type ToolUse struct {
 	Type  string                 `json:"type"`
@@ -47,424 +40,254 @@ type ToolResult struct {
 	Type      string `json:"type"`
 	ToolUseID string `json:"tool_use_id"`
 	Content   string `json:"content"`
+	IsError   bool   `json:"is_error,omitempty"`
 }
 
 func NewClaudeAgent(cfg *config.Config) (*ClaudeAgent, error) {
-	// Load AWS config with explicit environment variable credentials
-	var awsConfig aws.Config
-	var err error
-	
-	// Check if we have environment variables for AWS credentials
-	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
-	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
-	region := os.Getenv("AWS_REGION")
-	
-	if region == "" {
-		region = cfg.Claude.Region
-	}
-	
-	if accessKey != "" && secretKey != "" {
-		// Use static credentials from environment variables
-		awsConfig, err = awsconfig.LoadDefaultConfig(context.TODO(),
-			awsconfig.WithRegion(region),
-			awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
-		)
-	} else {
-		// Fall back to default credential chain (excluding IMDS)
-		awsConfig, err = awsconfig.LoadDefaultConfig(context.TODO(),
-			awsconfig.WithRegion(region),
-			awsconfig.WithEC2IMDSClientEnableState(imds.ClientDisabled),
-		)
-	}
-	
+	provider, err := NewProvider(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		return nil, fmt.Errorf("failed to create model provider: %w", err)
 	}
 
-	client := bedrockruntime.NewFromConfig(awsConfig)
+	return NewClaudeAgentWithProvider(cfg, provider)
+}
+
+// NewClaudeAgentWithProvider creates an agent backed by the given model
+// provider, e.g. a scripted fake for offline tests.
+func NewClaudeAgentWithProvider(cfg *config.Config, provider Provider) (*ClaudeAgent, error) {
+	registry, err := defaultRegistry(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	return &ClaudeAgent{
-		client:      client,
-		config:      cfg,
-		modelID:     cfg.Claude.ModelID,
-		temperature: cfg.Claude.Temperature,
+		provider:          provider,
+		tools:             registry,
+		config:            cfg,
+		temperature:       cfg.Claude.Temperature,
+		maxTokens:         cfg.Claude.MaxTokens,
+		history:           NewConversation(cfg.Claude.HistoryMaxTurns, cfg.Claude.HistoryMaxTokens),
+		maxToolIterations: cfg.Claude.MaxToolIterations,
 	}, nil
 }
 
+// GetTools returns the definitions of the enabled tools for the model request.
 func (a *ClaudeAgent) GetTools() []Tool {
-	return []Tool{
-		{
-			Name:        "deploy_application",
-			Description: "Deploy the application containers to AWS Lightsail",
-			InputSchema: InputSchema{
-				Type: "object",
-				Properties: map[string]interface{}{
-					"service_name": map[string]interface{}{
-						"type":        "string",
-						"description": "Name of the Lightsail service to deploy to",
-					},
-					"wait_for_ready": map[string]interface{}{
-						"type":        "boolean",
-						"description": "Whether to wait for service to become ready",
-					},
-				},
-				Required: []string{},
-			},
-		},
-		{
-			Name:        "get_deployment_status",
-			Description: "Get the current status of a deployed application",
-			InputSchema: InputSchema{
-				Type: "object",
-				Properties: map[string]interface{}{
-					"service_name": map[string]interface{}{
-						"type":        "string",
-						"description": "Name of the Lightsail service to check",
-					},
-				},
-				Required: []string{"service_name"},
-			},
-		},
-		{
-			Name:        "cleanup_resources",
-			Description: "Clean up all AWS ECS resources including services, clusters, load balancers, and log groups",
-			InputSchema: InputSchema{
-				Type: "object",
-				Properties: map[string]interface{}{
-					"confirm": map[string]interface{}{
-						"type":        "boolean",
-						"description": "Set to true to confirm resource deletion",
-					},
-					"service_name": map[string]interface{}{
-						"type":        "string",
-						"description": "Optional service name to clean up specific resources",
-					},
-				},
-				Required: []string{"confirm"},
-			},
-		},
-	}
+	return a.tools.Definitions()
 }
 
-func (a *ClaudeAgent) ExecuteTool(toolUse ToolUse) (*ToolResult, error) {
-	switch toolUse.Name {
-	case "deploy_application":
-		return a.executeDeployTool(toolUse)
-	case "get_deployment_status":
-		return a.executeStatusTool(toolUse)
-	case "cleanup_resources":
-		return a.executeCleanupTool(toolUse)
-	default:
-		return &ToolResult{
-			Type:      "tool_result",
-			ToolUseID: toolUse.ID,
-			Content:   fmt.Sprintf("Unknown tool: %s", toolUse.Name),
-		}, nil
-	}
+// Tools returns the registry of the agent, e.g. to register additional tools.
+func (a *ClaudeAgent) Tools() *tools.Registry {
+	return a.tools
 }
 
-
-func (a *ClaudeAgent) executeDeployTool(toolUse ToolUse) (*ToolResult, error) {
-	log.Println("Executing deploy_application tool")
-
-	// Initialize ECS deployer
-	deployer, err := deploy.NewECSDeployer()
-	if err != nil {
-		return &ToolResult{
-			Type:      "tool_result",
-			ToolUseID: toolUse.ID,
-			Content:   fmt.Sprintf("Failed to initialize ECS deployer: %v", err),
-		}, nil
-	}
-
-	// Get service name from input or use default
-	serviceName := a.config.AWS.ECS.ServiceName
-	if name, ok := toolUse.Input["service_name"].(string); ok && name != "" {
-		serviceName = name
+// ExecuteTool runs a registered tool. Mutating and destructive tools only run
+// after the approver allowed them. Tool failures and declined approvals are
+// returned as error results so Claude can react to them.
+func (a *ClaudeAgent) ExecuteTool(ctx context.Context, toolUse ToolUse) (*ToolResult, error) {
+	result := &ToolResult{
+		Type:      "tool_result",
+		ToolUseID: toolUse.ID,
+		IsError:   true,
 	}
 
-	// Create ECS configuration
-	ecsConfig := deploy.ECSConfig{
-		ClusterName:        a.config.AWS.ECS.ClusterName,
-		ServiceName:        serviceName,
-		TaskDefinitionName: a.config.AWS.ECS.TaskDefinitionName,
-		VpcId:              a.config.AWS.ECS.VpcId,
-		SubnetIds:          a.config.AWS.ECS.SubnetIds,
-		SecurityGroupIds:   a.config.AWS.ECS.SecurityGroupIds,
-		LoadBalancerName:   a.config.AWS.ECS.LoadBalancerName,
-		WebAppImage:        a.config.Images.AppImage,
-		DatabaseImage:      a.config.Images.Neo4jImage,
-		WebAppPort:         a.config.AWS.ECS.WebAppPort,
-		DatabasePort:       a.config.AWS.ECS.DatabasePort,
-		DatabaseHTTPPort:   a.config.AWS.ECS.DatabaseHTTPPort,
-		WebAppMemory:       a.config.AWS.ECS.WebAppMemory,
-		WebAppCPU:          a.config.AWS.ECS.WebAppCPU,
-		DatabaseMemory:     a.config.AWS.ECS.DatabaseMemory,
-		DatabaseCPU:        a.config.AWS.ECS.DatabaseCPU,
-		Environment:        a.config.AWS.ECS.Environment,
-		CreateSecrets:      a.config.AWS.ECS.CreateSecrets,
-		CreateEFS:          a.config.AWS.ECS.CreateEFS,
-		EFSVolumeId:        a.config.AWS.ECS.EFSVolumeId,
-		Mode:               a.config.AWS.ECS.Mode,
+	tool, ok := a.tools.Get(toolUse.Name)
+	if !ok {
+		result.Content = fmt.Sprintf("Unknown tool: %s", toolUse.Name)
+		return result, nil
 	}
 
-	// Create ECS cluster
-	if err := deployer.CreateCluster(ecsConfig.ClusterName); err != nil {
-		log.Printf("ECS cluster might already exist: %v", err)
-	}
+	if risk := tool.Risk(); risk.RequiresApproval() {
+		if a.approver == nil {
+			result.Content = fmt.Sprintf("%s is %s and no approver is configured, so it was not run. Nothing was changed.", toolUse.Name, risk)
+			return result, nil
+		}
 
-	// Use advanced deployment if advanced features are enabled
-	if ecsConfig.CreateSecrets || ecsConfig.CreateEFS {
-		if err := deployer.DeployAdvanced(ecsConfig); err != nil {
-			return &ToolResult{
-				Type:      "tool_result",
-				ToolUseID: toolUse.ID,
-				Content:   fmt.Sprintf("Failed to deploy with advanced features: %v", err),
-			}, nil
+		approved, err := a.approver.Approve(ctx, ApprovalRequest{
+			ToolName: toolUse.Name,
+			Risk:     risk,
+			Summary:  approvalSummary(ctx, tool, toolUse.Input),
+			Input:    toolUse.Input,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("approval for %s failed: %w", toolUse.Name, err)
 		}
-	} else {
-		// Basic deployment
-		if err := deployer.CreateTaskDefinition(ecsConfig); err != nil {
-			return &ToolResult{
-				Type:      "tool_result",
-				ToolUseID: toolUse.ID,
-				Content:   fmt.Sprintf("Failed to create task definition: %v", err),
-			}, nil
+		if !approved {
+			result.Content = fmt.Sprintf("The user declined to run %s. Nothing was changed; ask how they want to proceed.", toolUse.Name)
+			return result, nil
 		}
 	}
 
-	// Create ECS service (for both advanced and basic deployments)
-	if err := deployer.CreateService(ecsConfig); err != nil {
-		return &ToolResult{
-			Type:      "tool_result",
-			ToolUseID: toolUse.ID,
-			Content:   fmt.Sprintf("Failed to create ECS service: %v", err),
-		}, nil
-	}
-
-	// Wait for service to be stable if requested
-	waitForReady := true
-	if wait, ok := toolUse.Input["wait_for_ready"].(bool); ok {
-		waitForReady = wait
-	}
-
-	if waitForReady {
-		if err := deployer.WaitForServiceStable(ecsConfig.ClusterName, serviceName); err != nil {
-			return &ToolResult{
-				Type:      "tool_result",
-				ToolUseID: toolUse.ID,
-				Content:   fmt.Sprintf("Failed waiting for service to be stable: %v", err),
-			}, nil
-		}
+	content, err := a.tools.Execute(ctx, toolUse.Name, toolUse.Input)
+	if err != nil {
+		result.Content = err.Error()
+		return result, nil
 	}
 
-	return &ToolResult{
-		Type:      "tool_result",
-		ToolUseID: toolUse.ID,
-		Content:   fmt.Sprintf("ECS deployment to service '%s' completed successfully!", serviceName),
-	}, nil
+	result.Content = content
+	result.IsError = false
+	return result, nil
 }
 
-func (a *ClaudeAgent) executeStatusTool(toolUse ToolUse) (*ToolResult, error) {
-	log.Println("Executing get_deployment_status tool")
-
-	serviceName, ok := toolUse.Input["service_name"].(string)
-	if !ok {
-		return &ToolResult{
-			Type:      "tool_result",
-			ToolUseID: toolUse.ID,
-			Content:   "service_name parameter is required",
-		}, nil
-	}
+// SetApprover sets who approves mutating and destructive tool calls. Without
+// an approver such calls are refused.
+func (a *ClaudeAgent) SetApprover(approver Approver) {
+	a.approver = approver
+}
 
-	// Initialize ECS deployer
-	deployer, err := deploy.NewECSDeployer()
-	if err != nil {
-		return &ToolResult{
-			Type:      "tool_result",
-			ToolUseID: toolUse.ID,
-			Content:   fmt.Sprintf("Failed to initialize ECS deployer: %v", err),
-		}, nil
+// defaultRegistry registers the built-in tools and applies the tool selection
+// from the config.
+func defaultRegistry(cfg *config.Config) (*tools.Registry, error) {
+	registry := tools.NewRegistry()
+
+	for _, register := range []func(*tools.Registry, *config.Config) error{
+		deploy.RegisterTools,
+		builder.RegisterTools,
+		logs.RegisterTools,
+	} {
+		if err := register(registry, cfg); err != nil {
+			return nil, fmt.Errorf("failed to register tools: %w", err)
+		}
 	}
 
-	// Get service status
-	status, err := deployer.GetServiceStatus(a.config.AWS.ECS.ClusterName, serviceName)
-	if err != nil {
-		return &ToolResult{
-			Type:      "tool_result",
-			ToolUseID: toolUse.ID,
-			Content:   fmt.Sprintf("Failed to get service status: %v", err),
-		}, nil
+	if err := registry.Configure(cfg.Claude.Tools.Enabled, cfg.Claude.Tools.Disabled); err != nil {
+		return nil, err
 	}
 
-	return &ToolResult{
-		Type:      "tool_result",
-		ToolUseID: toolUse.ID,
-		Content:   status,
-	}, nil
+	return registry, nil
 }
 
-func (a *ClaudeAgent) executeCleanupTool(toolUse ToolUse) (*ToolResult, error) {
-	log.Println("Executing cleanup_resources tool")
-
-	// Check confirmation
-	confirm, ok := toolUse.Input["confirm"].(bool)
-	if !ok || !confirm {
-		return &ToolResult{
-			Type:      "tool_result",
-			ToolUseID: toolUse.ID,
-			Content:   "Cleanup cancelled. The 'confirm' parameter must be set to true to proceed with resource deletion.",
-		}, nil
-	}
+// ResetConversation clears the conversation history of the session.
+func (a *ClaudeAgent) ResetConversation() {
+	a.history.Reset()
+}
 
-	// Initialize ECS deployer
-	deployer, err := deploy.NewECSDeployer()
-	if err != nil {
-		return &ToolResult{
-			Type:      "tool_result",
-			ToolUseID: toolUse.ID,
-			Content:   fmt.Sprintf("Failed to initialize ECS deployer: %v", err),
-		}, nil
-	}
+// History returns the conversation history of the session.
+func (a *ClaudeAgent) History() *Conversation {
+	return a.history
+}
 
-	// Get service name from input or use default
-	serviceName := a.config.AWS.ECS.ServiceName
-	if name, ok := toolUse.Input["service_name"].(string); ok && name != "" {
-		serviceName = name
-	}
+// Usage returns the tokens used by all model calls of the session.
+func (a *ClaudeAgent) Usage() Usage {
+	return a.usage
+}
 
-	// Create ECS configuration
-	ecsConfig := deploy.ECSConfig{
-		ClusterName:        a.config.AWS.ECS.ClusterName,
-		ServiceName:        serviceName,
-		TaskDefinitionName: a.config.AWS.ECS.TaskDefinitionName,
-		VpcId:              a.config.AWS.ECS.VpcId,
-		SubnetIds:          a.config.AWS.ECS.SubnetIds,
-		SecurityGroupIds:   a.config.AWS.ECS.SecurityGroupIds,
-		LoadBalancerName:   a.config.AWS.ECS.LoadBalancerName,
-		WebAppImage:        a.config.Images.AppImage,
-		DatabaseImage:      a.config.Images.Neo4jImage,
-		WebAppPort:         a.config.AWS.ECS.WebAppPort,
-		DatabasePort:       a.config.AWS.ECS.DatabasePort,
-		DatabaseHTTPPort:   a.config.AWS.ECS.DatabaseHTTPPort,
-		WebAppMemory:       a.config.AWS.ECS.WebAppMemory,
-		WebAppCPU:          a.config.AWS.ECS.WebAppCPU,
-		DatabaseMemory:     a.config.AWS.ECS.DatabaseMemory,
-		DatabaseCPU:        a.config.AWS.ECS.DatabaseCPU,
-		Environment:        a.config.AWS.ECS.Environment,
-		CreateSecrets:      a.config.AWS.ECS.CreateSecrets,
-		CreateEFS:          a.config.AWS.ECS.CreateEFS,
-		EFSVolumeId:        a.config.AWS.ECS.EFSVolumeId,
-		Mode:               a.config.AWS.ECS.Mode,
-	}
+// systemPrompt frames the tool loop so the final answer reports what the
+// tools actually did rather than what Claude intended to do.
+const systemPrompt = `You are OpsAgent, a DevOps assistant that deploys and manages applications on AWS ECS Fargate using the provided tools.
+Use tools when the user asks you to act or to inspect the environment. Read every tool result carefully: if a tool fails, explain the error and decide whether another tool (for example get_deployment_status) can help diagnose it.
+Tools that change or delete resources ask the user for approval before they run. If the user declines, do not retry the same call; ask how they want to proceed instead.
+When you are done, reply with a concise summary of what actually happened, including any failures.`
 
-	// Execute cleanup
-	err = deployer.Cleanup(ecsConfig)
-	if err != nil {
-		return &ToolResult{
-			Type:      "tool_result",
-			ToolUseID: toolUse.ID,
-			Content:   fmt.Sprintf("Cleanup failed: %v", err),
-		}, nil
-	}
+// defaultMaxToolIterations bounds the tool loop when the config leaves it unset.
+const defaultMaxToolIterations = 10
 
-	return &ToolResult{
-		Type:      "tool_result",
-		ToolUseID: toolUse.ID,
-		Content:   fmt.Sprintf("✅ Successfully cleaned up all AWS ECS resources for service '%s'! This included:\n- ECS Service and Tasks\n- Task Definitions\n- Load Balancer and Target Groups\n- CloudWatch Log Groups\n- ECS Cluster (if empty)", serviceName),
-	}, nil
+// SendMessage adds the message to the conversation and runs the tool loop:
+// while Claude stops with tool_use, the requested tools are executed and their
+// results are sent back, until Claude produces a final answer or the iteration
+// cap is reached.
+func (a *ClaudeAgent) SendMessage(ctx context.Context, message string) (string, error) {
+	return a.runToolLoop(ctx, message, nil)
 }
 
-func (a *ClaudeAgent) SendMessage(ctx context.Context, message string) (string, error) {
-	tools := a.GetTools()
-
-	requestBody := map[string]interface{}{
-		"anthropic_version": "bedrock-2023-05-31",
-		"max_tokens":        4096,
-		"temperature":       a.temperature,
-		"messages": []map[string]interface{}{
-			{
-				"role":    "user",
-				"content": message,
-			},
-		},
-		"tools": tools,
-	}
+// runToolLoop drives the conversation for a single user message. When handler
+// is set, model output is streamed and tool progress is reported through it.
+// If a model call fails, the history is left as it was before the message.
+func (a *ClaudeAgent) runToolLoop(ctx context.Context, message string, handler StreamHandler) (string, error) {
+	start := a.history.snapshot()
+	a.history.AddUserText(message)
 
-	requestJSON, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	maxIterations := a.maxToolIterations
+	if maxIterations <= 0 {
+		maxIterations = defaultMaxToolIterations
 	}
 
-	input := &bedrockruntime.InvokeModelInput{
-		ModelId:     aws.String(a.modelID),
-		ContentType: aws.String("application/json"),
-		Body:        requestJSON,
-	}
+	var lastText string
+	for i := 0; i < maxIterations; i++ {
+		request := a.modelRequest()
 
-	result, err := a.client.InvokeModel(ctx, input)
-	if err != nil {
-		return "", fmt.Errorf("failed to invoke model: %w", err)
-	}
+		var response *ModelResponse
+		var err error
+		if handler != nil {
+			response, err = a.provider.Stream(ctx, request, handler)
+		} else {
+			response, err = a.provider.Send(ctx, request)
+		}
+		if err != nil {
+			// Drop the unfinished turn; the next message would otherwise be
+			// merged into it
+			a.history.restore(start)
+			return "", err
+		}
+
+		a.usage.InputTokens += response.Usage.InputTokens
+		a.usage.OutputTokens += response.Usage.OutputTokens
+		if text := response.text(); text != "" {
+			lastText = text
+		}
 
-	var response map[string]interface{}
-	if err := json.Unmarshal(result.Body, &response); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		toolUses := response.toolUses()
+		if response.StopReason != "tool_use" || len(toolUses) == 0 {
+			// Tool calls cut off by another stop reason, e.g. max_tokens, are not
+			// run; left unanswered in the history the next request is rejected
+			a.history.AddAssistant(response.withoutToolUses())
+			if lastText == "" {
+				return "No content in response", nil
+			}
+			return lastText, nil
+		}
+
+		a.history.AddAssistant(response.Content)
+		a.history.AddToolResults(a.executeToolUses(ctx, toolUses, handler))
 	}
 
-	// Process the response and handle tool calls
-	return a.processResponse(ctx, response)
+	// Close the turn with an assistant message, so the next user message
+	// starts a new turn instead of being merged into the tool results
+	stopped := fmt.Sprintf("Stopped after %d tool iterations without a final answer.", maxIterations)
+	a.history.AddAssistant([]ContentBlock{{Type: "text", Text: stopped}})
+	return fmt.Sprintf("%s\n\n⚠️ %s Ask me to continue if needed.", lastText, stopped), nil
 }
 
-func (a *ClaudeAgent) processResponse(ctx context.Context, response map[string]interface{}) (string, error) {
-	content, ok := response["content"].([]interface{})
-	if !ok {
-		return "No content in response", nil
+// modelRequest builds the request for the current history.
+func (a *ClaudeAgent) modelRequest() *ModelRequest {
+	maxTokens := a.maxTokens
+	if maxTokens <= 0 {
+		maxTokens = 4096
 	}
 
-	var textResponse string
-	var toolCalls []ToolUse
+	return &ModelRequest{
+		System:      systemPrompt,
+		Messages:    a.history.Messages(),
+		Tools:       a.GetTools(),
+		MaxTokens:   maxTokens,
+		Temperature: a.temperature,
+	}
+}
 
-	// Parse response content
-	for _, item := range content {
-		itemMap, ok := item.(map[string]interface{})
-		if !ok {
-			continue
+// executeToolUses runs each requested tool and returns the tool_result blocks
+// answering them. Every tool_use must be answered, so failures are reported
+// as error results instead of aborting the loop.
+func (a *ClaudeAgent) executeToolUses(ctx context.Context, toolUses []ToolUse, handler StreamHandler) []ContentBlock {
+	var results []ContentBlock
+	for _, toolUse := range toolUses {
+		if handler != nil {
+			handler(StreamEvent{Type: EventToolStart, ToolName: toolUse.Name, ToolUseID: toolUse.ID, Input: toolUse.Input})
 		}
 
-		switch itemMap["type"] {
-		case "text":
-			if text, ok := itemMap["text"].(string); ok {
-				textResponse += text
-			}
-		case "tool_use":
-			toolUse := ToolUse{
-				Type:  "tool_use",
-				ID:    itemMap["id"].(string),
-				Name:  itemMap["name"].(string),
-				Input: itemMap["input"].(map[string]interface{}),
-			}
-			toolCalls = append(toolCalls, toolUse)
+		block := ContentBlock{Type: "tool_result", ToolUseID: toolUse.ID}
+		result, err := a.ExecuteTool(ctx, toolUse)
+		if err != nil {
+			block.Content = fmt.Sprintf("Tool %s failed: %v", toolUse.Name, err)
+			block.IsError = true
+		} else {
+			block.Content = result.Content
+			block.IsError = result.IsError
 		}
-	}
 
-	// Execute tool calls if any
-	if len(toolCalls) > 0 {
-		var results []string
-		for _, toolCall := range toolCalls {
-			result, err := a.ExecuteTool(toolCall)
-			if err != nil {
-				results = append(results, fmt.Sprintf("Tool %s failed: %v", toolCall.Name, err))
-			} else {
-				results = append(results, result.Content)
-			}
-		}
-
-		if textResponse != "" {
-			textResponse += "\n\n"
+		if handler != nil {
+			handler(StreamEvent{Type: EventToolResult, ToolName: toolUse.Name, ToolUseID: toolUse.ID, Text: block.Content, IsError: block.IsError})
 		}
-		textResponse += "Tool Results:\n" + fmt.Sprintf("%v", results)
+		results = append(results, block)
 	}
-
-	return textResponse, nil
+	return results
 }
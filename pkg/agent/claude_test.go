@@ -0,0 +1,223 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"opsagents/internal/config"
+	"opsagents/pkg/tools"
+)
+
+// scriptedProvider returns its responses in order and records the requests.
+type scriptedProvider struct {
+	responses []*ModelResponse
+	err       error
+	requests  []*ModelRequest
+}
+
+func (p *scriptedProvider) Name() string {
+	return "scripted"
+}
+
+func (p *scriptedProvider) Send(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	p.requests = append(p.requests, req)
+	if len(p.responses) == 0 {
+		if p.err != nil {
+			return nil, p.err
+		}
+		return nil, errors.New("no scripted response left")
+	}
+	response := p.responses[0]
+	p.responses = p.responses[1:]
+	return response, nil
+}
+
+func (p *scriptedProvider) Stream(ctx context.Context, req *ModelRequest, handler StreamHandler) (*ModelResponse, error) {
+	return p.Send(ctx, req)
+}
+
+// echoTool is a read-only tool returning its text input, repeated when asked.
+type echoTool struct{}
+
+func (echoTool) Name() string        { return "echo" }
+func (echoTool) Description() string { return "Echo the input text" }
+func (echoTool) Risk() tools.Risk    { return tools.RiskReadOnly }
+
+func (echoTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{Type: "object", Properties: map[string]interface{}{}}
+}
+
+func (echoTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	return strings.Repeat(tools.String(input, "text", ""), tools.Int(input, "repeat", 1)), nil
+}
+
+func textResponse(text string) *ModelResponse {
+	return &ModelResponse{Content: []ContentBlock{{Type: "text", Text: text}}, StopReason: "end_turn"}
+}
+
+func toolUseResponse(calls ...ContentBlock) *ModelResponse {
+	return &ModelResponse{Content: calls, StopReason: "tool_use"}
+}
+
+func toolCall(id, name string, input map[string]interface{}) ContentBlock {
+	return ContentBlock{Type: "tool_use", ID: id, Name: name, Input: input}
+}
+
+func newTestAgent(t *testing.T, cfg *config.Config, provider Provider) *ClaudeAgent {
+	t.Helper()
+	agent, err := NewClaudeAgentWithProvider(cfg, provider)
+	if err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	if err := agent.Tools().Register(echoTool{}); err != nil {
+		t.Fatalf("failed to register echo tool: %v", err)
+	}
+	return agent
+}
+
+func TestToolLoop(t *testing.T) {
+	provider := &scriptedProvider{responses: []*ModelResponse{
+		toolUseResponse(
+			toolCall("call-1", "echo", map[string]interface{}{"text": "hello"}),
+			toolCall("call-2", "missing_tool", nil),
+		),
+		textResponse("Done"),
+	}}
+	agent := newTestAgent(t, &config.Config{}, provider)
+
+	answer, err := agent.SendMessage(context.Background(), "say hello")
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if answer != "Done" {
+		t.Errorf("answer = %q, want %q", answer, "Done")
+	}
+	if len(provider.requests) != 2 {
+		t.Fatalf("got %d model calls, want 2", len(provider.requests))
+	}
+
+	messages := agent.History().Messages()
+	if len(messages) != 4 {
+		t.Fatalf("history has %d messages, want 4", len(messages))
+	}
+	results := messages[2].Content
+	if messages[2].Role != "user" || len(results) != 2 {
+		t.Fatalf("third message = %+v, want the two tool results", messages[2])
+	}
+	if results[0].ToolUseID != "call-1" || results[0].Content != "hello" || results[0].IsError {
+		t.Errorf("echo result = %+v", results[0])
+	}
+	if results[1].ToolUseID != "call-2" || !results[1].IsError || !strings.Contains(results[1].Content, "Unknown tool") {
+		t.Errorf("unknown tool result = %+v", results[1])
+	}
+	if messages[3].Role != "assistant" || messages[3].Content[0].Text != "Done" {
+		t.Errorf("last message = %+v, want the final answer", messages[3])
+	}
+}
+
+func TestToolLoopIterationCap(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Claude.MaxToolIterations = 2
+
+	provider := &scriptedProvider{responses: []*ModelResponse{
+		toolUseResponse(toolCall("call-1", "echo", map[string]interface{}{"text": "one"})),
+		toolUseResponse(toolCall("call-2", "echo", map[string]interface{}{"text": "two"})),
+		textResponse("Next answer"),
+	}}
+	agent := newTestAgent(t, cfg, provider)
+
+	answer, err := agent.SendMessage(context.Background(), "loop")
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	stopped := "Stopped after 2 tool iterations without a final answer."
+	if !strings.Contains(answer, stopped) {
+		t.Errorf("answer = %q, want it to mention the iteration cap", answer)
+	}
+
+	messages := agent.History().Messages()
+	last := messages[len(messages)-1]
+	if last.Role != "assistant" || last.Content[0].Text != stopped {
+		t.Fatalf("last message = %+v, want the closing assistant message", last)
+	}
+
+	// The next message starts a new turn instead of joining the tool results
+	if _, err := agent.SendMessage(context.Background(), "continue"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if turns := agent.History().Turns(); turns != 2 {
+		t.Errorf("history has %d turns, want 2", turns)
+	}
+}
+
+func TestToolLoopDropsToolCallsNotRun(t *testing.T) {
+	provider := &scriptedProvider{responses: []*ModelResponse{{
+		Content: []ContentBlock{
+			{Type: "text", Text: "Let me check"},
+			toolCall("call-1", "echo", map[string]interface{}{"text": "cut off"}),
+		},
+		StopReason: "max_tokens",
+	}}}
+	agent := newTestAgent(t, &config.Config{}, provider)
+
+	if _, err := agent.SendMessage(context.Background(), "check"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	messages := agent.History().Messages()
+	for _, block := range messages[len(messages)-1].Content {
+		if block.Type == "tool_use" {
+			t.Errorf("unanswered tool_use block kept in the history: %+v", block)
+		}
+	}
+}
+
+func TestToolLoopRestoresHistoryOnError(t *testing.T) {
+	provider := &scriptedProvider{
+		responses: []*ModelResponse{
+			textResponse("Hi"),
+			toolUseResponse(toolCall("call-1", "echo", map[string]interface{}{"text": "one"})),
+		},
+		err: errors.New("throttled"),
+	}
+	agent := newTestAgent(t, &config.Config{}, provider)
+
+	if _, err := agent.SendMessage(context.Background(), "hello"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	before := len(agent.History().Messages())
+
+	if _, err := agent.SendMessage(context.Background(), "deploy"); err == nil {
+		t.Fatal("SendMessage succeeded, want the provider error")
+	}
+	if after := len(agent.History().Messages()); after != before {
+		t.Errorf("history has %d messages after the failed turn, want %d", after, before)
+	}
+}
+
+func TestToolLoopShortensToolResults(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Claude.HistoryMaxTokens = 1000
+
+	long := map[string]interface{}{"text": "log line ", "repeat": 500}
+	provider := &scriptedProvider{responses: []*ModelResponse{
+		toolUseResponse(toolCall("call-1", "echo", long)),
+		toolUseResponse(toolCall("call-2", "echo", long)),
+		textResponse("Done"),
+	}}
+	agent := newTestAgent(t, cfg, provider)
+
+	if _, err := agent.SendMessage(context.Background(), "read the logs"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	messages := agent.History().Messages()
+	shortened := messages[2].Content[0].Content
+	if !strings.HasSuffix(shortened, shortenedMarker) || len([]rune(shortened)) > maxShortenedResult+len("...")+len(shortenedMarker) {
+		t.Errorf("older tool result was not shortened: %d characters", len(shortened))
+	}
+	if latest := messages[4].Content[0].Content; strings.HasSuffix(latest, shortenedMarker) {
+		t.Errorf("latest tool result was shortened before the model saw it")
+	}
+}
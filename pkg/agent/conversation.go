@@ -0,0 +1,276 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ContentBlock is a single piece of message content in the Anthropic
+// Messages format. Depending on Type it carries text, a tool_use request
+// from the model, or a tool_result sent back to it.
+type ContentBlock struct {
+	Type      string                 `json:"type"`
+	Text      string                 `json:"text,omitempty"`
+	ID        string                 `json:"id,omitempty"`
+	Name      string                 `json:"name,omitempty"`
+	Input     map[string]interface{} `json:"input,omitempty"`
+	ToolUseID string                 `json:"tool_use_id,omitempty"`
+	Content   string                 `json:"content,omitempty"`
+	IsError   bool                   `json:"is_error,omitempty"`
+}
+
+// MarshalJSON only emits the fields that are valid for the block type, since
+// the Messages API rejects unknown fields and requires "input" on tool_use
+// blocks even when it is empty.
+func (b ContentBlock) MarshalJSON() ([]byte, error) {
+	switch b.Type {
+	case "text":
+		return json.Marshal(map[string]interface{}{
+			"type": b.Type,
+			"text": b.Text,
+		})
+	case "tool_use":
+		input := b.Input
+		if input == nil {
+			input = map[string]interface{}{}
+		}
+		return json.Marshal(map[string]interface{}{
+			"type":  b.Type,
+			"id":    b.ID,
+			"name":  b.Name,
+			"input": input,
+		})
+	case "tool_result":
+		block := map[string]interface{}{
+			"type":        b.Type,
+			"tool_use_id": b.ToolUseID,
+			"content":     b.Content,
+		}
+		if b.IsError {
+			block["is_error"] = true
+		}
+		return json.Marshal(block)
+	default:
+		type plain ContentBlock
+		return json.Marshal(plain(b))
+	}
+}
+
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// Conversation holds the message history of an agent session. Old turns are
+// dropped once the history exceeds the configured turn or token budget and
+// are folded into a short plain-text summary so the model keeps some context.
+type Conversation struct {
+	messages  []Message
+	summary   []string
+	maxTurns  int
+	maxTokens int
+}
+
+// maxSummaryLines bounds how much of the dropped history is kept in the summary.
+const maxSummaryLines = 30
+
+func NewConversation(maxTurns, maxTokens int) *Conversation {
+	return &Conversation{
+		maxTurns:  maxTurns,
+		maxTokens: maxTokens,
+	}
+}
+
+// AddUserText starts a new user turn. If the last message is already a user
+// message (for example pending tool results), the text is merged into it so
+// roles keep alternating.
+func (c *Conversation) AddUserText(text string) {
+	block := ContentBlock{Type: "text", Text: text}
+	if n := len(c.messages); n > 0 && c.messages[n-1].Role == "user" {
+		c.messages[n-1].Content = append(c.messages[n-1].Content, block)
+	} else {
+		c.messages = append(c.messages, Message{Role: "user", Content: []ContentBlock{block}})
+	}
+	c.trim()
+}
+
+// AddAssistant records the content blocks returned by the model.
+func (c *Conversation) AddAssistant(blocks []ContentBlock) {
+	if len(blocks) == 0 {
+		// The API rejects empty assistant messages
+		blocks = []ContentBlock{{Type: "text", Text: "(no response)"}}
+	}
+	c.messages = append(c.messages, Message{Role: "assistant", Content: blocks})
+}
+
+// AddToolResults records tool_result blocks answering the last assistant turn.
+// Long tool loops grow the history within one turn, so it is trimmed here too.
+func (c *Conversation) AddToolResults(results []ContentBlock) {
+	if len(results) == 0 {
+		return
+	}
+	c.messages = append(c.messages, Message{Role: "user", Content: results})
+	c.trim()
+}
+
+// Messages returns the history to send to the model, with the summary of
+// dropped turns prepended to the first user message.
+func (c *Conversation) Messages() []Message {
+	messages := make([]Message, len(c.messages))
+	copy(messages, c.messages)
+
+	if len(c.summary) > 0 && len(messages) > 0 {
+		summary := ContentBlock{
+			Type: "text",
+			Text: "Summary of earlier conversation (older turns were truncated):\n" + strings.Join(c.summary, "\n"),
+		}
+		first := messages[0]
+		first.Content = append([]ContentBlock{summary}, first.Content...)
+		messages[0] = first
+	}
+
+	return messages
+}
+
+// conversationSnapshot is a copy of the history and summary.
+type conversationSnapshot struct {
+	messages []Message
+	summary  []string
+}
+
+// snapshot copies the history, so a turn that fails halfway can be undone
+// with restore. Trimming shortens tool results in place, so the content of
+// each message is copied too.
+func (c *Conversation) snapshot() conversationSnapshot {
+	messages := make([]Message, len(c.messages))
+	for i, msg := range c.messages {
+		messages[i] = Message{Role: msg.Role, Content: append([]ContentBlock(nil), msg.Content...)}
+	}
+	return conversationSnapshot{
+		messages: messages,
+		summary:  append([]string(nil), c.summary...),
+	}
+}
+
+// restore resets the history and summary to a snapshot.
+func (c *Conversation) restore(snapshot conversationSnapshot) {
+	c.messages = snapshot.messages
+	c.summary = snapshot.summary
+}
+
+// Reset clears the history and summary.
+func (c *Conversation) Reset() {
+	c.messages = nil
+	c.summary = nil
+}
+
+// Turns returns the number of user turns currently held in the history.
+func (c *Conversation) Turns() int {
+	return len(c.turnStarts())
+}
+
+// EstimatedTokens roughly estimates the prompt size of the history using the
+// common ~4 characters per token heuristic.
+func (c *Conversation) EstimatedTokens() int {
+	data, err := json.Marshal(c.Messages())
+	if err != nil {
+		return 0
+	}
+	return len(data) / 4
+}
+
+// turnStarts returns the indexes of messages that begin a user turn, i.e. user
+// messages that start with text rather than tool results.
+func (c *Conversation) turnStarts() []int {
+	var starts []int
+	for i, msg := range c.messages {
+		if msg.Role == "user" && len(msg.Content) > 0 && msg.Content[0].Type == "text" {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// trim drops whole turns from the front of the history until it fits the
+// budget. The most recent turn is always kept; if it alone is over the token
+// budget, its older tool results are shortened instead.
+func (c *Conversation) trim() {
+	for {
+		starts := c.turnStarts()
+		if len(starts) < 2 {
+			if c.maxTokens > 0 && c.EstimatedTokens() > c.maxTokens {
+				c.shortenToolResults()
+			}
+			return
+		}
+
+		overTurns := c.maxTurns > 0 && len(starts) > c.maxTurns
+		overTokens := c.maxTokens > 0 && c.EstimatedTokens() > c.maxTokens
+		if !overTurns && !overTokens {
+			return
+		}
+
+		dropped := c.messages[starts[0]:starts[1]]
+		c.summary = append(c.summary, summarizeTurn(dropped)...)
+		if len(c.summary) > maxSummaryLines {
+			c.summary = c.summary[len(c.summary)-maxSummaryLines:]
+		}
+		c.messages = c.messages[starts[1]:]
+	}
+}
+
+// maxShortenedResult is the length older tool results are cut to when the
+// current turn alone exceeds the token budget.
+const (
+	maxShortenedResult = 500
+	shortenedMarker    = " (shortened to fit the context budget)"
+)
+
+// shortenToolResults truncates the tool results of all but the last message,
+// which the model has not seen yet.
+func (c *Conversation) shortenToolResults() {
+	for i := 0; i < len(c.messages)-1; i++ {
+		for j, block := range c.messages[i].Content {
+			if block.Type != "tool_result" || strings.HasSuffix(block.Content, shortenedMarker) {
+				continue
+			}
+			if len([]rune(block.Content)) > maxShortenedResult {
+				c.messages[i].Content[j].Content = truncate(block.Content, maxShortenedResult) + shortenedMarker
+			}
+		}
+	}
+}
+
+// summarizeTurn condenses a dropped turn into a few short lines.
+func summarizeTurn(messages []Message) []string {
+	var lines []string
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			switch {
+			case block.Type == "text" && msg.Role == "user":
+				lines = append(lines, "- User: "+truncate(block.Text, 200))
+			case block.Type == "text" && msg.Role == "assistant":
+				lines = append(lines, "- Assistant: "+truncate(block.Text, 200))
+			case block.Type == "tool_use":
+				input, _ := json.Marshal(block.Input)
+				lines = append(lines, fmt.Sprintf("- Assistant called %s with %s", block.Name, truncate(string(input), 150)))
+			case block.Type == "tool_result":
+				status := "returned"
+				if block.IsError {
+					status = "failed"
+				}
+				lines = append(lines, fmt.Sprintf("- Tool %s: %s", status, truncate(block.Content, 150)))
+			}
+		}
+	}
+	return lines
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(strings.Join(strings.Fields(s), " "))
+	if len(runes) <= max {
+		return string(runes)
+	}
+	return string(runes[:max]) + "..."
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"opsagents/internal/config"
+)
+
+// ModelRequest is a provider-neutral request for a single model call.
+type ModelRequest struct {
+	System      string
+	Messages    []Message
+	Tools       []Tool
+	MaxTokens   int
+	Temperature float32
+}
+
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// ModelResponse is the provider-neutral result of a model call, expressed in
+// Anthropic Messages content blocks.
+type ModelResponse struct {
+	Content    []ContentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      Usage          `json:"usage"`
+}
+
+// Provider sends messages and tool definitions to a model backend.
+type Provider interface {
+	// Name identifies the provider in logs and errors
+	Name() string
+	// Send performs a blocking model call
+	Send(ctx context.Context, req *ModelRequest) (*ModelResponse, error)
+	// Stream performs a model call, forwarding text deltas to handler as they
+	// arrive, and returns the complete response
+	Stream(ctx context.Context, req *ModelRequest, handler StreamHandler) (*ModelResponse, error)
+}
+
+const (
+	ProviderBedrock         = "bedrock"
+	ProviderBedrockConverse = "bedrock-converse"
+	ProviderAnthropic       = "anthropic"
+)
+
+// NewProvider creates the model provider selected by claude.provider.
+func NewProvider(cfg *config.Config) (Provider, error) {
+	switch strings.ToLower(cfg.Claude.Provider) {
+	case "", ProviderBedrock:
+		return NewBedrockProvider(cfg)
+	case ProviderBedrockConverse:
+		return NewConverseProvider(cfg)
+	case ProviderAnthropic:
+		return NewAnthropicProvider(cfg)
+	default:
+		return nil, fmt.Errorf("unknown claude provider %q (expected %s, %s or %s)",
+			cfg.Claude.Provider, ProviderBedrock, ProviderBedrockConverse, ProviderAnthropic)
+	}
+}
+
+// text returns the concatenated text blocks of the response.
+func (r *ModelResponse) text() string {
+	var parts []string
+	for _, block := range r.Content {
+		if block.Type == "text" && block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// withoutToolUses returns the content without its tool_use blocks, for a
+// response whose tool calls are not run.
+func (r *ModelResponse) withoutToolUses() []ContentBlock {
+	var blocks []ContentBlock
+	for _, block := range r.Content {
+		if block.Type != "tool_use" {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// toolUses returns the tool_use blocks of the response.
+func (r *ModelResponse) toolUses() []ToolUse {
+	var toolUses []ToolUse
+	for _, block := range r.Content {
+		if block.Type == "tool_use" {
+			toolUses = append(toolUses, ToolUse{
+				Type:  "tool_use",
+				ID:    block.ID,
+				Name:  block.Name,
+				Input: block.Input,
+			})
+		}
+	}
+	return toolUses
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"opsagents/internal/config"
+)
+
+const anthropicAPIVersion = "2023-06-01"
+
+// AnthropicProvider calls the Anthropic Messages API directly, for teams
+// without Bedrock access.
+type AnthropicProvider struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	modelID    string
+}
+
+func NewAnthropicProvider(cfg *config.Config) (*AnthropicProvider, error) {
+	keyEnv := cfg.Claude.APIKeyEnv
+	if keyEnv == "" {
+		keyEnv = "ANTHROPIC_API_KEY"
+	}
+
+	apiKey := os.Getenv(keyEnv)
+	if apiKey == "" {
+		return nil, fmt.Errorf("environment variable %s must be set to use the anthropic provider", keyEnv)
+	}
+
+	baseURL := cfg.Claude.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com"
+	}
+
+	return &AnthropicProvider{
+		// Long timeout since streamed responses stay open while Claude writes
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		modelID:    cfg.Claude.ModelID,
+	}, nil
+}
+
+func (p *AnthropicProvider) Name() string {
+	return ProviderAnthropic
+}
+
+func (p *AnthropicProvider) post(ctx context.Context, req *ModelRequest, stream bool) (*http.Response, error) {
+	requestBody := map[string]interface{}{
+		"model":       p.modelID,
+		"max_tokens":  req.MaxTokens,
+		"temperature": req.Temperature,
+		"messages":    req.Messages,
+		"tools":       req.Tools,
+	}
+	if req.System != "" {
+		requestBody["system"] = req.System
+	}
+	if stream {
+		requestBody["stream"] = true
+	}
+
+	requestJSON, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/messages", bytes.NewReader(requestJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Anthropic API: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("anthropic API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return resp, nil
+}
+
+func (p *AnthropicProvider) Send(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	resp, err := p.post(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response ModelResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return &response, nil
+}
+
+// Stream reads the server-sent events of a streaming Messages call.
+func (p *AnthropicProvider) Stream(ctx context.Context, req *ModelRequest, handler StreamHandler) (*ModelResponse, error) {
+	resp, err := p.post(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	acc := newStreamAccumulator()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			// Event names are repeated in the data payload, so only data lines matter
+			continue
+		}
+
+		var parsed streamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &parsed); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+		if err := acc.add(parsed, handler); err != nil {
+			return nil, err
+		}
+		if parsed.Type == "message_stop" {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("model stream failed: %w", err)
+	}
+
+	return acc.response(), nil
+}
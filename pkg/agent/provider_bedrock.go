@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"opsagents/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// BedrockProvider calls Claude through Bedrock InvokeModel with the Anthropic
+// Messages request body.
+type BedrockProvider struct {
+	client  *bedrockruntime.Client
+	modelID string
+}
+
+func NewBedrockProvider(cfg *config.Config) (*BedrockProvider, error) {
+	client, err := newBedrockClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BedrockProvider{
+		client:  client,
+		modelID: cfg.Claude.ModelID,
+	}, nil
+}
+
+func newBedrockClient(cfg *config.Config) (*bedrockruntime.Client, error) {
+	// Load AWS config with explicit environment variable credentials
+	var awsConfig aws.Config
+	var err error
+
+	// Check if we have environment variables for AWS credentials
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	region := os.Getenv("AWS_REGION")
+
+	if region == "" {
+		region = cfg.Claude.Region
+	}
+
+	if accessKey != "" && secretKey != "" {
+		// Use static credentials from environment variables
+		awsConfig, err = awsconfig.LoadDefaultConfig(context.TODO(),
+			awsconfig.WithRegion(region),
+			awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
+		)
+	} else {
+		// Fall back to default credential chain (excluding IMDS)
+		awsConfig, err = awsconfig.LoadDefaultConfig(context.TODO(),
+			awsconfig.WithRegion(region),
+			awsconfig.WithEC2IMDSClientEnableState(imds.ClientDisabled),
+		)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return bedrockruntime.NewFromConfig(awsConfig), nil
+}
+
+func (p *BedrockProvider) Name() string {
+	return ProviderBedrock
+}
+
+func (p *BedrockProvider) requestBody(req *ModelRequest) ([]byte, error) {
+	requestBody := map[string]interface{}{
+		"anthropic_version": "bedrock-2023-05-31",
+		"max_tokens":        req.MaxTokens,
+		"temperature":       req.Temperature,
+		"messages":          req.Messages,
+		"tools":             req.Tools,
+	}
+	if req.System != "" {
+		requestBody["system"] = req.System
+	}
+
+	requestJSON, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return requestJSON, nil
+}
+
+func (p *BedrockProvider) Send(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	requestJSON, err := p.requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(p.modelID),
+		ContentType: aws.String("application/json"),
+		Body:        requestJSON,
+	}
+
+	result, err := p.client.InvokeModel(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to invoke model: %w", err)
+	}
+
+	var response ModelResponse
+	if err := json.Unmarshal(result.Body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return &response, nil
+}
+
+// Stream calls InvokeModelWithResponseStream and rebuilds the complete
+// response while forwarding text deltas to handler.
+func (p *BedrockProvider) Stream(ctx context.Context, req *ModelRequest, handler StreamHandler) (*ModelResponse, error) {
+	requestJSON, err := p.requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := p.client.InvokeModelWithResponseStream(ctx, &bedrockruntime.InvokeModelWithResponseStreamInput{
+		ModelId:     aws.String(p.modelID),
+		ContentType: aws.String("application/json"),
+		Body:        requestJSON,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to invoke model with response stream: %w", err)
+	}
+
+	stream := output.GetStream()
+	defer stream.Close()
+
+	acc := newStreamAccumulator()
+	for event := range stream.Events() {
+		chunk, ok := event.(*types.ResponseStreamMemberChunk)
+		if !ok {
+			continue
+		}
+
+		var parsed streamEvent
+		if err := json.Unmarshal(chunk.Value.Bytes, &parsed); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+		if err := acc.add(parsed, handler); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("model stream failed: %w", err)
+	}
+
+	return acc.response(), nil
+}
@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"opsagents/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// ConverseProvider calls Claude through the model-agnostic Bedrock Converse API.
+type ConverseProvider struct {
+	client  *bedrockruntime.Client
+	modelID string
+}
+
+func NewConverseProvider(cfg *config.Config) (*ConverseProvider, error) {
+	client, err := newBedrockClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConverseProvider{
+		client:  client,
+		modelID: cfg.Claude.ModelID,
+	}, nil
+}
+
+func (p *ConverseProvider) Name() string {
+	return ProviderBedrockConverse
+}
+
+func (p *ConverseProvider) Send(ctx context.Context, req *ModelRequest) (*ModelResponse, error) {
+	messages, system, toolConfig, inference := p.convertRequest(req)
+
+	output, err := p.client.Converse(ctx, &bedrockruntime.ConverseInput{
+		ModelId:         aws.String(p.modelID),
+		Messages:        messages,
+		System:          system,
+		ToolConfig:      toolConfig,
+		InferenceConfig: inference,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Converse: %w", err)
+	}
+
+	response := &ModelResponse{StopReason: string(output.StopReason)}
+	if output.Usage != nil {
+		response.Usage = Usage{
+			InputTokens:  int(aws.ToInt32(output.Usage.InputTokens)),
+			OutputTokens: int(aws.ToInt32(output.Usage.OutputTokens)),
+		}
+	}
+
+	message, ok := output.Output.(*types.ConverseOutputMemberMessage)
+	if !ok {
+		return response, nil
+	}
+
+	for _, block := range message.Value.Content {
+		switch b := block.(type) {
+		case *types.ContentBlockMemberText:
+			response.Content = append(response.Content, ContentBlock{Type: "text", Text: b.Value})
+		case *types.ContentBlockMemberToolUse:
+			var input map[string]interface{}
+			if b.Value.Input != nil {
+				if err := b.Value.Input.UnmarshalSmithyDocument(&input); err != nil {
+					return nil, fmt.Errorf("failed to decode tool input: %w", err)
+				}
+			}
+			response.Content = append(response.Content, ContentBlock{
+				Type:  "tool_use",
+				ID:    aws.ToString(b.Value.ToolUseId),
+				Name:  aws.ToString(b.Value.Name),
+				Input: input,
+			})
+		}
+	}
+
+	return response, nil
+}
+
+func (p *ConverseProvider) Stream(ctx context.Context, req *ModelRequest, handler StreamHandler) (*ModelResponse, error) {
+	messages, system, toolConfig, inference := p.convertRequest(req)
+
+	output, err := p.client.ConverseStream(ctx, &bedrockruntime.ConverseStreamInput{
+		ModelId:         aws.String(p.modelID),
+		Messages:        messages,
+		System:          system,
+		ToolConfig:      toolConfig,
+		InferenceConfig: inference,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call ConverseStream: %w", err)
+	}
+
+	stream := output.GetStream()
+	defer stream.Close()
+
+	response := &ModelResponse{}
+	inputJSON := map[int]string{}
+	block := func(index int32) *ContentBlock {
+		for len(response.Content) <= int(index) {
+			response.Content = append(response.Content, ContentBlock{Type: "text"})
+		}
+		return &response.Content[index]
+	}
+
+	for event := range stream.Events() {
+		switch e := event.(type) {
+		case *types.ConverseStreamOutputMemberContentBlockStart:
+			if start, ok := e.Value.Start.(*types.ContentBlockStartMemberToolUse); ok {
+				b := block(aws.ToInt32(e.Value.ContentBlockIndex))
+				b.Type = "tool_use"
+				b.ID = aws.ToString(start.Value.ToolUseId)
+				b.Name = aws.ToString(start.Value.Name)
+			}
+		case *types.ConverseStreamOutputMemberContentBlockDelta:
+			index := aws.ToInt32(e.Value.ContentBlockIndex)
+			switch delta := e.Value.Delta.(type) {
+			case *types.ContentBlockDeltaMemberText:
+				b := block(index)
+				b.Text += delta.Value
+				handler(StreamEvent{Type: EventText, Text: delta.Value})
+			case *types.ContentBlockDeltaMemberToolUse:
+				block(index)
+				inputJSON[int(index)] += aws.ToString(delta.Value.Input)
+			}
+		case *types.ConverseStreamOutputMemberContentBlockStop:
+			index := aws.ToInt32(e.Value.ContentBlockIndex)
+			if raw := inputJSON[int(index)]; raw != "" {
+				var input map[string]interface{}
+				if err := json.Unmarshal([]byte(raw), &input); err != nil {
+					return nil, fmt.Errorf("failed to parse tool input: %w", err)
+				}
+				block(index).Input = input
+			}
+		case *types.ConverseStreamOutputMemberMessageStop:
+			response.StopReason = string(e.Value.StopReason)
+		case *types.ConverseStreamOutputMemberMetadata:
+			if e.Value.Usage != nil {
+				response.Usage = Usage{
+					InputTokens:  int(aws.ToInt32(e.Value.Usage.InputTokens)),
+					OutputTokens: int(aws.ToInt32(e.Value.Usage.OutputTokens)),
+				}
+			}
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("converse stream failed: %w", err)
+	}
+
+	// Drop the placeholders of blocks that never got text; Bedrock rejects
+	// empty text blocks when the history is sent back
+	content := response.Content[:0]
+	for _, b := range response.Content {
+		if b.Type != "text" || b.Text != "" {
+			content = append(content, b)
+		}
+	}
+	response.Content = content
+
+	return response, nil
+}
+
+// convertRequest maps the Anthropic-style request onto Converse types.
+func (p *ConverseProvider) convertRequest(req *ModelRequest) ([]types.Message, []types.SystemContentBlock, *types.ToolConfiguration, *types.InferenceConfiguration) {
+	var messages []types.Message
+	for _, msg := range req.Messages {
+		role := types.ConversationRoleUser
+		if msg.Role == "assistant" {
+			role = types.ConversationRoleAssistant
+		}
+
+		var content []types.ContentBlock
+		for _, block := range msg.Content {
+			switch block.Type {
+			case "text":
+				content = append(content, &types.ContentBlockMemberText{Value: block.Text})
+			case "tool_use":
+				input := block.Input
+				if input == nil {
+					input = map[string]interface{}{}
+				}
+				content = append(content, &types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+					ToolUseId: aws.String(block.ID),
+					Name:      aws.String(block.Name),
+					Input:     document.NewLazyDocument(input),
+				}})
+			case "tool_result":
+				result := types.ToolResultBlock{
+					ToolUseId: aws.String(block.ToolUseID),
+					Content: []types.ToolResultContentBlock{
+						&types.ToolResultContentBlockMemberText{Value: block.Content},
+					},
+					Status: types.ToolResultStatusSuccess,
+				}
+				if block.IsError {
+					result.Status = types.ToolResultStatusError
+				}
+				content = append(content, &types.ContentBlockMemberToolResult{Value: result})
+			}
+		}
+
+		messages = append(messages, types.Message{Role: role, Content: content})
+	}
+
+	var system []types.SystemContentBlock
+	if req.System != "" {
+		system = []types.SystemContentBlock{&types.SystemContentBlockMemberText{Value: req.System}}
+	}
+
+	var toolConfig *types.ToolConfiguration
+	if len(req.Tools) > 0 {
+		toolConfig = &types.ToolConfiguration{}
+		for _, tool := range req.Tools {
+			toolConfig.Tools = append(toolConfig.Tools, &types.ToolMemberToolSpec{Value: types.ToolSpecification{
+				Name:        aws.String(tool.Name),
+				Description: aws.String(tool.Description),
+				InputSchema: &types.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(jsonMap(tool.InputSchema))},
+			}})
+		}
+	}
+
+	inference := &types.InferenceConfiguration{
+		MaxTokens:   aws.Int32(int32(req.MaxTokens)),
+		Temperature: aws.Float32(req.Temperature),
+	}
+
+	return messages, system, toolConfig, inference
+}
+
+// jsonMap converts a JSON-tagged struct into a generic map, since Smithy
+// documents do not honour json struct tags.
+func jsonMap(v interface{}) map[string]interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
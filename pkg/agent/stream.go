@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+type StreamEventType string
+
+const (
+	// EventText carries a text delta from Claude
+	EventText StreamEventType = "text"
+	// EventToolStart is sent before a requested tool is executed
+	EventToolStart StreamEventType = "tool_start"
+	// EventToolResult is sent after a tool finished, with its output in Text
+	EventToolResult StreamEventType = "tool_result"
+	// EventDone carries Claude's final answer in Text
+	EventDone StreamEventType = "done"
+	// EventError is sent when the message could not be completed
+	EventError StreamEventType = "error"
+)
+
+// StreamEvent is a single step of a streamed agent response.
+type StreamEvent struct {
+	Type      StreamEventType
+	Text      string
+	ToolName  string
+	ToolUseID string
+	Input     map[string]interface{}
+	IsError   bool
+	Err       error
+}
+
+// StreamHandler receives stream events in order. It is called synchronously
+// from the agent loop, so it should not block for long.
+type StreamHandler func(StreamEvent)
+
+// SendMessageStream works like SendMessage but streams Claude's output through
+// handler as it is generated, together with tool start/finish events. The
+// final answer is both returned and delivered as an EventDone event.
+func (a *ClaudeAgent) SendMessageStream(ctx context.Context, message string, handler StreamHandler) (string, error) {
+	if handler == nil {
+		handler = func(StreamEvent) {}
+	}
+
+	response, err := a.runToolLoop(ctx, message, handler)
+	if err != nil {
+		handler(StreamEvent{Type: EventError, Err: err})
+		return "", err
+	}
+
+	handler(StreamEvent{Type: EventDone, Text: response})
+	return response, nil
+}
+
+// StreamMessage is the channel form of SendMessageStream. The channel is closed
+// after the EventDone or EventError event. Only one message may be in flight
+// per agent at a time.
+func (a *ClaudeAgent) StreamMessage(ctx context.Context, message string) <-chan StreamEvent {
+	events := make(chan StreamEvent, 64)
+
+	go func() {
+		defer close(events)
+		a.SendMessageStream(ctx, message, func(event StreamEvent) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	return events
+}
+
+// streamEvent is the subset of the Anthropic streaming event format we use.
+// Bedrock InvokeModelWithResponseStream and the Anthropic API share it.
+type streamEvent struct {
+	Type    string `json:"type"`
+	Message *struct {
+		Usage Usage `json:"usage"`
+	} `json:"message"`
+	Index        int           `json:"index"`
+	ContentBlock *ContentBlock `json:"content_block"`
+	Usage        *Usage        `json:"usage"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// streamAccumulator rebuilds the full response from streaming events.
+type streamAccumulator struct {
+	blocks     []ContentBlock
+	inputJSON  map[int]string
+	stopReason string
+	usage      Usage
+}
+
+func newStreamAccumulator() *streamAccumulator {
+	return &streamAccumulator{inputJSON: map[int]string{}}
+}
+
+// add applies a single event and forwards text deltas to handler.
+func (s *streamAccumulator) add(event streamEvent, handler StreamHandler) error {
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			s.usage.InputTokens = event.Message.Usage.InputTokens
+		}
+	case "content_block_start":
+		if event.ContentBlock == nil {
+			return nil
+		}
+		for len(s.blocks) <= event.Index {
+			s.blocks = append(s.blocks, ContentBlock{})
+		}
+		s.blocks[event.Index] = *event.ContentBlock
+		if event.ContentBlock.Text != "" {
+			handler(StreamEvent{Type: EventText, Text: event.ContentBlock.Text})
+		}
+	case "content_block_delta":
+		if event.Index >= len(s.blocks) {
+			return nil
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			s.blocks[event.Index].Text += event.Delta.Text
+			handler(StreamEvent{Type: EventText, Text: event.Delta.Text})
+		case "input_json_delta":
+			s.inputJSON[event.Index] += event.Delta.PartialJSON
+		}
+	case "content_block_stop":
+		if event.Index >= len(s.blocks) {
+			return nil
+		}
+		if raw, ok := s.inputJSON[event.Index]; ok && raw != "" {
+			var input map[string]interface{}
+			if err := json.Unmarshal([]byte(raw), &input); err != nil {
+				return fmt.Errorf("failed to parse tool input: %w", err)
+			}
+			s.blocks[event.Index].Input = input
+		}
+	case "message_delta":
+		if event.Delta.StopReason != "" {
+			s.stopReason = event.Delta.StopReason
+		}
+		if event.Usage != nil {
+			s.usage.OutputTokens = event.Usage.OutputTokens
+		}
+	case "error":
+		if event.Error != nil {
+			return fmt.Errorf("model stream error (%s): %s", event.Error.Type, event.Error.Message)
+		}
+		return fmt.Errorf("model stream error")
+	}
+	return nil
+}
+
+func (s *streamAccumulator) response() *ModelResponse {
+	return &ModelResponse{Content: s.blocks, StopReason: s.stopReason, Usage: s.usage}
+}
@@ -0,0 +1,97 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	appconfig "opsagents/internal/config"
+	"opsagents/pkg/tools"
+)
+
+// RegisterTools registers the image build tools.
+func RegisterTools(registry *tools.Registry, cfg *appconfig.Config) error {
+	return registry.Register(&buildImageTool{cfg: cfg})
+}
+
+type buildImageTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *buildImageTool) Name() string {
+	return "build_image"
+}
+
+func (t *buildImageTool) Description() string {
+	return "Build a Docker image locally from a Dockerfile in the application source directory, optionally tagging it"
+}
+
+func (t *buildImageTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"image_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the image to build",
+			},
+			"dockerfile": map[string]interface{}{
+				"type":        "string",
+				"description": "Path of the Dockerfile relative to the source directory (default Dockerfile)",
+			},
+			"source_dir": map[string]interface{}{
+				"type":        "string",
+				"description": "Build context directory (defaults to git.working_dir)",
+			},
+			"tag": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional tag to apply to the built image",
+			},
+		},
+		Required: []string{"image_name"},
+	}
+}
+
+func (t *buildImageTool) Risk() tools.Risk {
+	return tools.RiskMutating
+}
+
+func (t *buildImageTool) Summarize(ctx context.Context, input map[string]interface{}) string {
+	sourceDir := tools.String(input, "source_dir", t.cfg.Git.WorkingDir)
+	if sourceDir == "" {
+		sourceDir = "."
+	}
+	summary := fmt.Sprintf("This will run docker build in %s and create the local image %s",
+		sourceDir, tools.String(input, "image_name", ""))
+	if tag := tools.String(input, "tag", ""); tag != "" {
+		summary += fmt.Sprintf(", tagged %s", tag)
+	}
+	return summary + "\n"
+}
+
+func (t *buildImageTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing build_image tool")
+
+	imageName := tools.String(input, "image_name", "")
+	if imageName == "" {
+		return "", fmt.Errorf("image_name parameter is required")
+	}
+
+	sourceDir := tools.String(input, "source_dir", t.cfg.Git.WorkingDir)
+	if sourceDir == "" {
+		sourceDir = "."
+	}
+
+	builder := NewDockerBuilder(sourceDir, "")
+	if err := builder.BuildImage(imageName, tools.String(input, "dockerfile", "Dockerfile")); err != nil {
+		return "", err
+	}
+
+	if tag := tools.String(input, "tag", ""); tag != "" {
+		if err := builder.TagImage(imageName, tag); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Docker image %s built and tagged as %s:%s", imageName, imageName, tag), nil
+	}
+
+	return fmt.Sprintf("Docker image %s built successfully", imageName), nil
+}
@@ -0,0 +1,637 @@
+package deploy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// Deployment strategies for aws.ecs.deployment_strategy.
+const (
+	DeploymentRolling   = "rolling"
+	DeploymentBlueGreen = "blue_green"
+)
+
+// BlueTargetGroupName and GreenTargetGroupName name the two target groups of
+// a blue/green service. Blue is the target group rolling deployments use.
+func BlueTargetGroupName(serviceName string) string {
+	return fmt.Sprintf("%s-tg", serviceName)
+}
+
+func GreenTargetGroupName(serviceName string) string {
+	return fmt.Sprintf("%s-tg-green", serviceName)
+}
+
+// blueGreenTargets are the load balancer resources of a blue/green service.
+type blueGreenTargets struct {
+	loadBalancerArn string
+	listenerArn     string
+	// active receives the traffic, idle is where the next task set starts
+	active string
+	idle   string
+}
+
+// validateBlueGreen checks the health check timeout of blue/green and canary
+// deployments; without one the new task set would be torn down right away.
+func validateBlueGreen(config ECSConfig) error {
+	if config.DeploymentStrategy != DeploymentBlueGreen && config.DeploymentStrategy != DeploymentCanary {
+		return nil
+	}
+	if config.BlueGreenHealthTimeout <= 0 {
+		return fmt.Errorf("invalid blue/green config: health_check_timeout %s must be above 0", config.BlueGreenHealthTimeout)
+	}
+	return nil
+}
+
+// deployBlueGreen starts taskDefinition in a new task set behind the idle
+// target group, waits for its targets to pass health checks and then moves
+// the listener to it, at once or in canary steps. The previous task
+// set keeps running so SwitchBack can move traffic back instantly.
+func (d *ECSDeployer) deployBlueGreen(config ECSConfig, taskDefinition string) error {
+	if taskDefinition == "" {
+		taskDefinition = config.TaskDefinitionName
+	}
+
+	config, err := d.resolveNetworking(config)
+	if err != nil {
+		return err
+	}
+
+	targets, err := d.ensureBlueGreenTargets(config)
+	if err != nil {
+		return err
+	}
+
+	service, err := d.ensureExternalService(config)
+	if err != nil {
+		return err
+	}
+
+	// A task set kept from an earlier deployment may still sit behind the idle
+	// target group; its targets must not count towards the new health checks
+	for _, taskSet := range service.TaskSets {
+		if taskSetTargetGroup(taskSet) == targets.idle && aws.ToString(taskSet.Status) != "PRIMARY" {
+			d.deleteTaskSet(config, aws.ToString(taskSet.Id))
+		}
+	}
+
+	if err := d.attachIdleTargetGroup(config, targets); err != nil {
+		return err
+	}
+
+	fmt.Printf("Starting new task set for %s behind %s\n", shortTaskDefinition(taskDefinition), targetGroupLabel(targets.idle))
+	output, err := d.ecsClient.CreateTaskSet(d.ctx, &ecs.CreateTaskSetInput{
+		Cluster:              aws.String(config.ClusterName),
+		Service:              service.ServiceArn,
+		TaskDefinition:       aws.String(taskDefinition),
+		LaunchType:           launchType(config),
+		NetworkConfiguration: taskNetworkConfiguration(config),
+		LoadBalancers: []types.LoadBalancer{
+			{
+				TargetGroupArn: aws.String(targets.idle),
+				ContainerName:  aws.String(loadBalancerContainer(config)),
+				ContainerPort:  aws.Int32(config.WebAppPort),
+			},
+		},
+		CapacityProviderStrategy: capacityProviderStrategy(config),
+		Scale:                    &types.Scale{Unit: types.ScaleUnitPercent, Value: 100},
+		Tags:                     ecsTags(config.ResourceTags()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create task set: %w", err)
+	}
+	taskSet := output.TaskSet
+	taskSetId := aws.ToString(taskSet.Id)
+	fmt.Printf("Task set %s created\n", taskSetId)
+
+	// Health checks run against the idle target group before it gets traffic
+	timeout := config.BlueGreenHealthTimeout
+	err = d.waitForTaskSetSteady(config.ClusterName, config.ServiceName, taskSetId, timeout)
+	if err == nil {
+		err = d.waitForTargetsHealthy(targets.idle, timeout)
+	}
+	if err != nil {
+		fmt.Printf("New task set is not healthy, removing it; traffic stays on %s\n", targetGroupLabel(targets.active))
+		d.deleteTaskSet(config, taskSetId)
+		return fmt.Errorf("blue/green deployment failed before traffic was shifted: %w", err)
+	}
+
+	if config.DeploymentStrategy == DeploymentCanary {
+		err = d.shiftCanary(config, targets)
+	} else {
+		err = d.shiftTraffic(targets.listenerArn, map[string]int32{targets.idle: 100, targets.active: 0})
+	}
+	if err != nil {
+		d.deleteTaskSet(config, taskSetId)
+		return err
+	}
+
+	_, err = d.ecsClient.UpdateServicePrimaryTaskSet(d.ctx, &ecs.UpdateServicePrimaryTaskSetInput{
+		Cluster:        aws.String(config.ClusterName),
+		Service:        service.ServiceArn,
+		PrimaryTaskSet: taskSet.TaskSetArn,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark task set %s as primary: %w", taskSetId, err)
+	}
+
+	d.retirePreviousTaskSets(config, taskSetId, targets.active)
+
+	// Request count scaling follows the target group that now has the traffic
+	if err := d.configureScaling(config, targets.loadBalancerArn, targets.idle); err != nil {
+		return fmt.Errorf("failed to configure auto scaling: %w", err)
+	}
+
+	d.recordState(func(state *DeploymentState) {
+		state.ClusterName = config.ClusterName
+		state.ServiceArn = aws.ToString(service.ServiceArn)
+		state.TaskDefinitionArn = aws.ToString(taskSet.TaskDefinition)
+		state.DeploymentId = config.DeploymentId
+	})
+
+	fmt.Printf("Traffic shifted to task set %s behind %s\n", taskSetId, targetGroupLabel(targets.idle))
+	return nil
+}
+
+// SwitchBack moves the listener back to the previous task set kept by the
+// last blue/green deployment.
+func (d *ECSDeployer) SwitchBack(config ECSConfig) (string, error) {
+	if err := d.beginState(config); err != nil {
+		return "", err
+	}
+
+	service, err := d.describeService(config)
+	if err != nil {
+		return "", err
+	}
+	if !isExternalService(service) {
+		return "", fmt.Errorf("service %s does not use blue/green deployments; use rollback instead", config.ServiceName)
+	}
+
+	targets, err := d.currentBlueGreenTargets(config)
+	if err != nil {
+		return "", err
+	}
+
+	var previous *types.TaskSet
+	for i, taskSet := range service.TaskSets {
+		for _, lb := range taskSet.LoadBalancers {
+			if aws.ToString(lb.TargetGroupArn) == targets.idle {
+				previous = &service.TaskSets[i]
+			}
+		}
+	}
+	if previous == nil {
+		return "", fmt.Errorf("no previous task set is running behind %s to switch back to", targetGroupLabel(targets.idle))
+	}
+
+	if err := d.waitForTargetsHealthy(targets.idle, time.Minute); err != nil {
+		return "", fmt.Errorf("previous task set is not healthy: %w", err)
+	}
+
+	if err := d.shiftTraffic(targets.listenerArn, map[string]int32{targets.idle: 100, targets.active: 0}); err != nil {
+		return "", err
+	}
+
+	_, err = d.ecsClient.UpdateServicePrimaryTaskSet(d.ctx, &ecs.UpdateServicePrimaryTaskSetInput{
+		Cluster:        aws.String(config.ClusterName),
+		Service:        service.ServiceArn,
+		PrimaryTaskSet: previous.TaskSetArn,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to mark task set %s as primary: %w", aws.ToString(previous.Id), err)
+	}
+
+	d.recordState(func(state *DeploymentState) {
+		state.TaskDefinitionArn = aws.ToString(previous.TaskDefinition)
+	})
+
+	return fmt.Sprintf("Switched traffic for %s back to task set %s (%s) behind %s. Task set behind %s is kept until the next deployment.\n",
+		config.ServiceName, aws.ToString(previous.Id), shortTaskDefinition(aws.ToString(previous.TaskDefinition)),
+		targetGroupLabel(targets.idle), targetGroupLabel(targets.active)), nil
+}
+
+// ensureBlueGreenTargets creates the load balancer, both target groups and
+// the listener if needed and works out which target group is live.
+func (d *ECSDeployer) ensureBlueGreenTargets(config ECSConfig) (*blueGreenTargets, error) {
+	loadBalancerArn, err := d.createLoadBalancer(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create load balancer: %w", err)
+	}
+	blue, blueReplace, err := d.ensureTargetGroup(config, BlueTargetGroupName(config.ServiceName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create target group: %w", err)
+	}
+	green, greenReplace, err := d.ensureTargetGroup(config, GreenTargetGroupName(config.ServiceName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create target group: %w", err)
+	}
+	blueArn, greenArn := aws.ToString(blue.TargetGroupArn), aws.ToString(green.TargetGroupArn)
+	d.recordState(func(state *DeploymentState) {
+		state.LoadBalancerArn = loadBalancerArn
+		state.TargetGroupArn = blueArn
+		state.AlternateTargetGroupArn = greenArn
+	})
+	if err := d.ensureDNSRecord(config, loadBalancerArn); err != nil {
+		return nil, err
+	}
+
+	targets := &blueGreenTargets{loadBalancerArn: loadBalancerArn}
+	listener, err := d.findTrafficListener(loadBalancerArn, config)
+	if err != nil {
+		return nil, err
+	}
+	if listener == nil {
+		// First deployment: blue is live (empty) so the first task set starts on green.
+		// When HTTPS is added later, it starts on whatever port 80 forwards to.
+		startArn := blueArn
+		if config.HTTPS.Enabled {
+			if httpListener, err := d.findListener(loadBalancerArn, 80, elbv2types.ProtocolEnumHttp); err == nil && httpListener != nil {
+				if forwarded := forwardedTargetGroup(httpListener.DefaultActions); forwarded == greenArn {
+					startArn = greenArn
+				}
+			}
+		}
+		listenerArn, err := d.createListener(loadBalancerArn, startArn, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create listener: %w", err)
+		}
+		targets.listenerArn = listenerArn
+		targets.active = startArn
+	} else {
+		targets.listenerArn = aws.ToString(listener.ListenerArn)
+		targets.active = forwardedTargetGroup(listener.DefaultActions)
+		if config.HTTPS.Enabled {
+			// Keep the weights, only refresh the certificate and SSL policy
+			if err := d.refreshHTTPSListener(loadBalancerArn, config); err != nil {
+				return nil, err
+			}
+		}
+	}
+	d.recordState(func(state *DeploymentState) {
+		state.ListenerArn = targets.listenerArn
+	})
+
+	switch targets.active {
+	case blueArn:
+		targets.idle = greenArn
+	case greenArn:
+		targets.idle = blueArn
+	default:
+		// The listener forwards somewhere else, e.g. after a rolling deployment
+		targets.active, targets.idle = blueArn, greenArn
+	}
+
+	// Settings that need a new target group are applied to the idle one,
+	// which has no traffic; the live one follows after the next switch
+	replace := map[string][]string{blueArn: blueReplace, greenArn: greenReplace}
+	if differences := replace[targets.active]; len(differences) > 0 {
+		fmt.Printf("Warning: Target group %s serves traffic and differs in %s; it is replaced on the next deployment, once traffic has moved off it\n",
+			targetGroupLabel(targets.active), strings.Join(differences, ", "))
+	}
+	if differences := replace[targets.idle]; len(differences) > 0 {
+		idle, err := d.replaceIdleTargetGroup(config, targets, differences)
+		if err != nil {
+			return nil, err
+		}
+		d.recordState(func(state *DeploymentState) {
+			if targets.idle == blueArn {
+				state.TargetGroupArn = idle
+			} else {
+				state.AlternateTargetGroupArn = idle
+			}
+		})
+		targets.idle = idle
+	}
+	return targets, nil
+}
+
+// currentBlueGreenTargets reads the live and idle target groups from the
+// listener without creating anything.
+func (d *ECSDeployer) currentBlueGreenTargets(config ECSConfig) (*blueGreenTargets, error) {
+	loadBalancerArn := ""
+	if d.state != nil {
+		loadBalancerArn = d.state.LoadBalancerArn
+	}
+	if loadBalancerArn == "" {
+		output, err := d.elbv2Client.DescribeLoadBalancers(d.ctx, &elasticloadbalancingv2.DescribeLoadBalancersInput{
+			Names: []string{fmt.Sprintf("%s-alb", config.ServiceName)},
+		})
+		if err != nil || len(output.LoadBalancers) == 0 {
+			return nil, fmt.Errorf("load balancer for %s not found", config.ServiceName)
+		}
+		loadBalancerArn = aws.ToString(output.LoadBalancers[0].LoadBalancerArn)
+	}
+
+	listener, err := d.findTrafficListener(loadBalancerArn, config)
+	if err != nil {
+		return nil, err
+	}
+	if listener == nil {
+		return nil, fmt.Errorf("no listener on port %d found for %s", listenerPort(config), config.ServiceName)
+	}
+
+	output, err := d.elbv2Client.DescribeTargetGroups(d.ctx, &elasticloadbalancingv2.DescribeTargetGroupsInput{
+		Names: []string{BlueTargetGroupName(config.ServiceName), GreenTargetGroupName(config.ServiceName)},
+	})
+	if err != nil || len(output.TargetGroups) != 2 {
+		return nil, fmt.Errorf("blue and green target groups for %s not found", config.ServiceName)
+	}
+
+	targets := &blueGreenTargets{
+		loadBalancerArn: loadBalancerArn,
+		listenerArn:     aws.ToString(listener.ListenerArn),
+		active:          forwardedTargetGroup(listener.DefaultActions),
+	}
+	for _, targetGroup := range output.TargetGroups {
+		if arn := aws.ToString(targetGroup.TargetGroupArn); arn != targets.active {
+			targets.idle = arn
+		}
+	}
+	return targets, nil
+}
+
+// ensureExternalService returns the service, creating it with the external
+// deployment controller that task sets require.
+func (d *ECSDeployer) ensureExternalService(config ECSConfig) (*types.Service, error) {
+	service, err := d.describeService(config)
+	if err == nil {
+		if !isExternalService(service) {
+			return nil, fmt.Errorf("service %s was created for rolling deployments and cannot switch to blue/green; run cleanup first or set aws.ecs.deployment_strategy to rolling", config.ServiceName)
+		}
+		return service, nil
+	}
+
+	fmt.Printf("Creating ECS service %s for blue/green deployments\n", config.ServiceName)
+	output, err := d.ecsClient.CreateService(d.ctx, &ecs.CreateServiceInput{
+		ServiceName:          aws.String(config.ServiceName),
+		Cluster:              aws.String(config.ClusterName),
+		DesiredCount:         aws.Int32(initialDesiredCount(config)),
+		DeploymentController: &types.DeploymentController{Type: types.DeploymentControllerTypeExternal},
+		Tags:                 ecsTags(config.ResourceTags()),
+		EnableECSManagedTags: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ECS service: %w", err)
+	}
+	d.recordState(func(state *DeploymentState) {
+		state.ClusterName = config.ClusterName
+		state.ServiceArn = aws.ToString(output.Service.ServiceArn)
+	})
+	return output.Service, nil
+}
+
+// retirePreviousTaskSets keeps the task set behind the old live target group
+// for switch-back, if configured, and deletes all others except keep.
+func (d *ECSDeployer) retirePreviousTaskSets(config ECSConfig, keep, previousTargetGroup string) {
+	service, err := d.describeService(config)
+	if err != nil {
+		fmt.Printf("Warning: Failed to list task sets: %v\n", err)
+		return
+	}
+
+	for _, taskSet := range service.TaskSets {
+		id := aws.ToString(taskSet.Id)
+		if id == keep {
+			continue
+		}
+		if config.KeepPreviousTaskSet && taskSetTargetGroup(taskSet) == previousTargetGroup {
+			fmt.Printf("Keeping previous task set %s for switch-back\n", id)
+			continue
+		}
+		d.deleteTaskSet(config, id)
+	}
+}
+
+func (d *ECSDeployer) deleteTaskSet(config ECSConfig, taskSetId string) {
+	_, err := d.ecsClient.DeleteTaskSet(d.ctx, &ecs.DeleteTaskSetInput{
+		Cluster: aws.String(config.ClusterName),
+		Service: aws.String(config.ServiceName),
+		TaskSet: aws.String(taskSetId),
+		Force:   aws.Bool(true),
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to delete task set %s: %v\n", taskSetId, err)
+	} else {
+		fmt.Printf("Deleted task set %s\n", taskSetId)
+	}
+}
+
+// attachIdleTargetGroup adds the idle target group to the listener's forward
+// action with weight 0. ECS only accepts a task set behind a target group that
+// belongs to a load balancer, and the load balancer only health checks targets
+// of groups its listener forwards to. Existing weights are kept.
+func (d *ECSDeployer) attachIdleTargetGroup(config ECSConfig, targets *blueGreenTargets) error {
+	listener, err := d.findTrafficListener(targets.loadBalancerArn, config)
+	if err != nil {
+		return err
+	}
+	if listener == nil {
+		return fmt.Errorf("no listener on port %d found for %s", listenerPort(config), config.ServiceName)
+	}
+
+	weights := forwardWeights(listener.DefaultActions)
+	if _, attached := weights[targets.idle]; attached {
+		return nil
+	}
+	if len(weights) == 0 {
+		weights[targets.active] = 100
+	}
+	weights[targets.idle] = 0
+	return d.shiftTraffic(targets.listenerArn, weights)
+}
+
+// shiftTraffic sets the weights of the listener's forward action.
+func (d *ECSDeployer) shiftTraffic(listenerArn string, weights map[string]int32) error {
+	arns := make([]string, 0, len(weights))
+	for arn := range weights {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+
+	var targetGroups []elbv2types.TargetGroupTuple
+	var shares []string
+	for _, arn := range arns {
+		targetGroups = append(targetGroups, elbv2types.TargetGroupTuple{
+			TargetGroupArn: aws.String(arn),
+			Weight:         aws.Int32(weights[arn]),
+		})
+		shares = append(shares, fmt.Sprintf("%s=%d", targetGroupLabel(arn), weights[arn]))
+	}
+
+	_, err := d.elbv2Client.ModifyListener(d.ctx, &elasticloadbalancingv2.ModifyListenerInput{
+		ListenerArn: aws.String(listenerArn),
+		DefaultActions: []elbv2types.Action{
+			{
+				Type:          elbv2types.ActionTypeEnumForward,
+				ForwardConfig: &elbv2types.ForwardActionConfig{TargetGroups: targetGroups},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to shift listener traffic: %w", err)
+	}
+
+	fmt.Printf("Listener weights: %s\n", strings.Join(shares, ", "))
+	return nil
+}
+
+// waitForTaskSetSteady waits until the task set runs its desired tasks.
+func (d *ECSDeployer) waitForTaskSetSteady(clusterName, serviceName, taskSetId string, timeout time.Duration) error {
+	fmt.Printf("Waiting for task set %s to reach steady state...\n", taskSetId)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		output, err := d.ecsClient.DescribeTaskSets(d.ctx, &ecs.DescribeTaskSetsInput{
+			Cluster:  aws.String(clusterName),
+			Service:  aws.String(serviceName),
+			TaskSets: []string{taskSetId},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe task set: %w", err)
+		}
+		if len(output.TaskSets) == 0 {
+			return fmt.Errorf("task set %s not found", taskSetId)
+		}
+
+		taskSet := output.TaskSets[0]
+		if taskSet.StabilityStatus == types.StabilityStatusSteadyState && taskSet.RunningCount > 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for task set %s (running %d of %d)", taskSetId, taskSet.RunningCount, taskSet.ComputedDesiredCount)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// waitForTargetsHealthy waits until every registered target of the target
+// group passes its health check.
+func (d *ECSDeployer) waitForTargetsHealthy(targetGroupArn string, timeout time.Duration) error {
+	fmt.Printf("Waiting for targets in %s to pass health checks...\n", targetGroupLabel(targetGroupArn))
+
+	deadline := time.Now().Add(timeout)
+	for {
+		output, err := d.elbv2Client.DescribeTargetHealth(d.ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{
+			TargetGroupArn: aws.String(targetGroupArn),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe target health: %w", err)
+		}
+
+		healthy, total := 0, 0
+		var reasons []string
+		for _, description := range output.TargetHealthDescriptions {
+			if description.TargetHealth == nil || description.TargetHealth.State == elbv2types.TargetHealthStateEnumDraining {
+				continue
+			}
+			total++
+			if description.TargetHealth.State == elbv2types.TargetHealthStateEnumHealthy {
+				healthy++
+			} else if reason := aws.ToString(description.TargetHealth.Description); reason != "" {
+				reasons = append(reasons, reason)
+			}
+		}
+		if total > 0 && healthy == total {
+			fmt.Printf("%d of %d targets healthy\n", healthy, total)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d of %d targets healthy after %s: %s", healthy, total, timeout, strings.Join(reasons, "; "))
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+func (d *ECSDeployer) describeService(config ECSConfig) (*types.Service, error) {
+	output, err := d.ecsClient.DescribeServices(d.ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(config.ClusterName),
+		Services: []string{config.ServiceName},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe service: %w", err)
+	}
+	if len(output.Services) == 0 || aws.ToString(output.Services[0].Status) != "ACTIVE" {
+		return nil, fmt.Errorf("service %s not found", config.ServiceName)
+	}
+	return &output.Services[0], nil
+}
+
+func isExternalService(service *types.Service) bool {
+	return service.DeploymentController != nil && service.DeploymentController.Type == types.DeploymentControllerTypeExternal
+}
+
+// primaryTaskSet returns the task set that serves the service, if any.
+func primaryTaskSet(service *types.Service) *types.TaskSet {
+	for i, taskSet := range service.TaskSets {
+		if aws.ToString(taskSet.Status) == "PRIMARY" {
+			return &service.TaskSets[i]
+		}
+	}
+	return nil
+}
+
+func taskSetTargetGroup(taskSet types.TaskSet) string {
+	if len(taskSet.LoadBalancers) == 0 {
+		return ""
+	}
+	return aws.ToString(taskSet.LoadBalancers[0].TargetGroupArn)
+}
+
+// forwardedTargetGroup returns the target group with the highest weight in a
+// listener's forward action.
+func forwardedTargetGroup(actions []elbv2types.Action) string {
+	for _, action := range actions {
+		if action.Type != elbv2types.ActionTypeEnumForward {
+			continue
+		}
+		if action.ForwardConfig != nil && len(action.ForwardConfig.TargetGroups) > 0 {
+			best := action.ForwardConfig.TargetGroups[0]
+			for _, tuple := range action.ForwardConfig.TargetGroups[1:] {
+				if aws.ToInt32(tuple.Weight) > aws.ToInt32(best.Weight) {
+					best = tuple
+				}
+			}
+			return aws.ToString(best.TargetGroupArn)
+		}
+		return aws.ToString(action.TargetGroupArn)
+	}
+	return ""
+}
+
+// forwardWeights returns the weight of each target group in a listener's
+// forward action; a plain forward to one target group has weight 100.
+func forwardWeights(actions []elbv2types.Action) map[string]int32 {
+	weights := map[string]int32{}
+	for _, action := range actions {
+		if action.Type != elbv2types.ActionTypeEnumForward {
+			continue
+		}
+		if action.ForwardConfig != nil && len(action.ForwardConfig.TargetGroups) > 0 {
+			for _, tuple := range action.ForwardConfig.TargetGroups {
+				weights[aws.ToString(tuple.TargetGroupArn)] = aws.ToInt32(tuple.Weight)
+			}
+		} else if arn := aws.ToString(action.TargetGroupArn); arn != "" {
+			weights[arn] = 100
+		}
+		break
+	}
+	return weights
+}
+
+// targetGroupLabel shortens a target group ARN to its name.
+func targetGroupLabel(arn string) string {
+	// arn:aws:elasticloadbalancing:region:account:targetgroup/NAME/ID
+	parts := strings.Split(arn, "/")
+	if len(parts) >= 2 {
+		return parts[len(parts)-2]
+	}
+	return arn
+}
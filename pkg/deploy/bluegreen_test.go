@@ -0,0 +1,68 @@
+package deploy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// weightedForward is a forward action splitting traffic by weight.
+func weightedForward(weights map[string]int32) elbv2types.Action {
+	config := &elbv2types.ForwardActionConfig{}
+	for arn, weight := range weights {
+		config.TargetGroups = append(config.TargetGroups, elbv2types.TargetGroupTuple{
+			TargetGroupArn: aws.String(arn),
+			Weight:         aws.Int32(weight),
+		})
+	}
+	return elbv2types.Action{Type: elbv2types.ActionTypeEnumForward, ForwardConfig: config}
+}
+
+func TestForwardedTargetGroup(t *testing.T) {
+	redirect := elbv2types.Action{Type: elbv2types.ActionTypeEnumRedirect}
+	plain := elbv2types.Action{Type: elbv2types.ActionTypeEnumForward, TargetGroupArn: aws.String("blue")}
+
+	tests := []struct {
+		name    string
+		actions []elbv2types.Action
+		want    string
+	}{
+		{"no actions", nil, ""},
+		{"redirect only", []elbv2types.Action{redirect}, ""},
+		{"plain forward", []elbv2types.Action{plain}, "blue"},
+		{"after redirect", []elbv2types.Action{redirect, plain}, "blue"},
+		{"weighted to green", []elbv2types.Action{weightedForward(map[string]int32{"blue": 0, "green": 100})}, "green"},
+		{"canary step", []elbv2types.Action{weightedForward(map[string]int32{"blue": 90, "green": 10})}, "blue"},
+		{"single weighted", []elbv2types.Action{weightedForward(map[string]int32{"green": 1})}, "green"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardedTargetGroup(tt.actions); got != tt.want {
+				t.Errorf("forwardedTargetGroup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []elbv2types.Action
+		want    map[string]int32
+	}{
+		{"no actions", nil, map[string]int32{}},
+		{"plain forward", []elbv2types.Action{{Type: elbv2types.ActionTypeEnumForward, TargetGroupArn: aws.String("blue")}}, map[string]int32{"blue": 100}},
+		{"weighted", []elbv2types.Action{weightedForward(map[string]int32{"blue": 100, "green": 0})}, map[string]int32{"blue": 100, "green": 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardWeights(tt.actions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("forwardWeights() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// DeploymentCanary shifts traffic to the new task set in steps.
+const DeploymentCanary = "canary"
+
+// canaryPollInterval is how often health and 5xx counts are checked during a step.
+const canaryPollInterval = 30 * time.Second
+
+// RolloutEvent is one entry of a rollout timeline.
+type RolloutEvent struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Rollout is the timeline of a canary deployment.
+type Rollout struct {
+	ServiceName string         `json:"service_name"`
+	Events      []RolloutEvent `json:"events"`
+	RolledBack  bool           `json:"rolled_back"`
+}
+
+func (r *Rollout) add(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	r.Events = append(r.Events, RolloutEvent{Time: time.Now(), Message: message})
+	fmt.Printf("Canary: %s\n", message)
+}
+
+func (r *Rollout) String() string {
+	var b strings.Builder
+	outcome := "completed"
+	if r.RolledBack {
+		outcome = "rolled back"
+	}
+	fmt.Fprintf(&b, "Canary rollout of %s %s:\n", r.ServiceName, outcome)
+	for _, event := range r.Events {
+		fmt.Fprintf(&b, "  %s  %s\n", event.Time.Local().Format("15:04:05"), event.Message)
+	}
+	return b.String()
+}
+
+// LastRollout returns the timeline of the last canary deployment run by this
+// deployer, or nil if there was none.
+func (d *ECSDeployer) LastRollout() *Rollout {
+	return d.rollout
+}
+
+// canaryHealth is what one check of the canary target group found.
+type canaryHealth struct {
+	healthy   int
+	total     int
+	errors5xx int
+	requests  int
+}
+
+func (h canaryHealth) String() string {
+	return fmt.Sprintf("%d/%d targets healthy, %d 5xx of %d requests", h.healthy, h.total, h.errors5xx, h.requests)
+}
+
+// shiftCanary moves traffic from the active to the idle target group in the
+// configured steps. Between steps it watches the idle target group; when a
+// target turns unhealthy or the 5xx count passes the threshold, it puts all
+// traffic back on the active target group and returns an error.
+func (d *ECSDeployer) shiftCanary(config ECSConfig, targets *blueGreenTargets) error {
+	rollout := &Rollout{ServiceName: config.ServiceName}
+	d.rollout = rollout
+
+	steps := append([]int32(nil), config.CanarySteps...)
+	if len(steps) == 0 || steps[len(steps)-1] != 100 {
+		steps = append(steps, 100)
+	}
+	// Check every step before any traffic moves
+	if problems := canaryStepProblems(steps); len(problems) > 0 {
+		return fmt.Errorf("invalid canary steps: %s", strings.Join(problems, "; "))
+	}
+
+	for _, weight := range steps {
+		if err := d.shiftTraffic(targets.listenerArn, map[string]int32{targets.idle: weight, targets.active: 100 - weight}); err != nil {
+			rollout.add("failed to shift %d%% of traffic: %v", weight, err)
+			d.revertCanary(rollout, targets)
+			return err
+		}
+		rollout.add("shifted %d%% of traffic to %s", weight, targetGroupLabel(targets.idle))
+		if weight == 100 {
+			break
+		}
+
+		stepStart := time.Now()
+		deadline := stepStart.Add(config.CanaryStepDuration)
+		for {
+			wait := canaryPollInterval
+			if remaining := time.Until(deadline); remaining < wait {
+				wait = remaining
+			}
+			if wait > 0 {
+				time.Sleep(wait)
+			}
+
+			health, err := d.checkCanary(targets, stepStart)
+			if err != nil {
+				fmt.Printf("Warning: Failed to check canary health: %v\n", err)
+			} else if reason := config.canaryBreach(health); reason != "" {
+				rollout.add("threshold breached at %d%%: %s", weight, reason)
+				d.revertCanary(rollout, targets)
+				return fmt.Errorf("canary rolled back at %d%% of traffic: %s", weight, reason)
+			}
+
+			if !time.Now().Before(deadline) {
+				if err == nil {
+					rollout.add("step %d%% passed: %s", weight, health)
+				}
+				break
+			}
+		}
+	}
+
+	rollout.add("all traffic on the new task set")
+	return nil
+}
+
+// validateCanary checks the canary steps and thresholds of canary
+// deployments before anything is created.
+func validateCanary(config ECSConfig) error {
+	if config.DeploymentStrategy != DeploymentCanary {
+		return nil
+	}
+	problems := canaryStepProblems(config.CanarySteps)
+	if config.CanaryStepDuration <= 0 {
+		problems = append(problems, fmt.Sprintf("step_duration %s must be above 0", config.CanaryStepDuration))
+	}
+	if config.CanaryMax5xx < 0 {
+		problems = append(problems, fmt.Sprintf("max_5xx_count %d must not be negative", config.CanaryMax5xx))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid canary config:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// canaryStepProblems checks that every step is 1-100 percent and that the
+// steps strictly increase.
+func canaryStepProblems(steps []int32) []string {
+	var problems []string
+	for i, step := range steps {
+		if step < 1 || step > 100 {
+			problems = append(problems, fmt.Sprintf("step %d%% must be between 1 and 100", step))
+		}
+		if i > 0 && step <= steps[i-1] {
+			problems = append(problems, fmt.Sprintf("step %d%% must be larger than the step before it (%d%%)", step, steps[i-1]))
+		}
+	}
+	return problems
+}
+
+// canaryBreach returns why a check fails the canary thresholds, or "".
+func (c ECSConfig) canaryBreach(health canaryHealth) string {
+	if health.total == 0 {
+		return "no registered targets"
+	}
+	if health.healthy < health.total {
+		return fmt.Sprintf("%d of %d targets unhealthy", health.total-health.healthy, health.total)
+	}
+	if health.errors5xx > c.CanaryMax5xx {
+		return fmt.Sprintf("%d 5xx responses (limit %d)", health.errors5xx, c.CanaryMax5xx)
+	}
+	return ""
+}
+
+// revertCanary puts all traffic back on the previously active target group.
+// The new task set is removed by the caller and the previous one stays
+// primary, so the service keeps running the old revision.
+func (d *ECSDeployer) revertCanary(rollout *Rollout, targets *blueGreenTargets) {
+	rollout.RolledBack = true
+	if err := d.shiftTraffic(targets.listenerArn, map[string]int32{targets.active: 100, targets.idle: 0}); err != nil {
+		rollout.add("failed to revert listener weights: %v", err)
+		return
+	}
+	rollout.add("reverted all traffic to %s", targetGroupLabel(targets.active))
+}
+
+// checkCanary reads the target health of the canary target group and its
+// 5xx and request counts since the step started.
+func (d *ECSDeployer) checkCanary(targets *blueGreenTargets, since time.Time) (canaryHealth, error) {
+	var health canaryHealth
+
+	output, err := d.elbv2Client.DescribeTargetHealth(d.ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targets.idle),
+	})
+	if err != nil {
+		return health, fmt.Errorf("failed to describe target health: %w", err)
+	}
+	for _, description := range output.TargetHealthDescriptions {
+		if description.TargetHealth == nil || description.TargetHealth.State == elbv2types.TargetHealthStateEnumDraining {
+			continue
+		}
+		health.total++
+		if description.TargetHealth.State == elbv2types.TargetHealthStateEnumHealthy {
+			health.healthy++
+		}
+	}
+
+	health.errors5xx, err = d.targetGroupMetricSum(targets, "HTTPCode_Target_5XX_Count", since)
+	if err != nil {
+		return health, err
+	}
+	health.requests, err = d.targetGroupMetricSum(targets, "RequestCount", since)
+	if err != nil {
+		return health, err
+	}
+	return health, nil
+}
+
+// targetGroupMetricSum sums an AWS/ApplicationELB metric of the canary target
+// group from since until now.
+func (d *ECSDeployer) targetGroupMetricSum(targets *blueGreenTargets, metricName string, since time.Time) (int, error) {
+	// Metrics are published per minute; round down so the current minute is included
+	start := since.Truncate(time.Minute)
+	end := time.Now()
+	output, err := d.cloudwatchClient.GetMetricStatistics(d.ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/ApplicationELB"),
+		MetricName: aws.String(metricName),
+		Dimensions: []cwtypes.Dimension{
+			{Name: aws.String("TargetGroup"), Value: aws.String(arnResource(targets.idle, "targetgroup/"))},
+			{Name: aws.String("LoadBalancer"), Value: aws.String(arnResource(targets.loadBalancerArn, "app/"))},
+		},
+		StartTime:  aws.Time(start),
+		EndTime:    aws.Time(end),
+		Period:     aws.Int32(60),
+		Statistics: []cwtypes.Statistic{cwtypes.StatisticSum},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", metricName, err)
+	}
+
+	var sum float64
+	for _, datapoint := range output.Datapoints {
+		sum += aws.ToFloat64(datapoint.Sum)
+	}
+	return int(sum), nil
+}
+
+// arnResource returns the part of an ELB ARN starting at marker, which is the
+// form CloudWatch uses for the TargetGroup and LoadBalancer dimensions.
+func arnResource(arn, marker string) string {
+	if i := strings.Index(arn, marker); i >= 0 {
+		return arn[i:]
+	}
+	return arn
+}
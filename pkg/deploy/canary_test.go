@@ -0,0 +1,29 @@
+package deploy
+
+import "testing"
+
+func TestCanaryStepProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		steps    []int32
+		problems int
+	}{
+		{"no steps", nil, 0},
+		{"increasing", []int32{10, 50, 100}, 0},
+		{"single step", []int32{100}, 0},
+		{"zero", []int32{0, 50}, 1},
+		{"above 100", []int32{50, 150}, 1},
+		{"equal steps", []int32{25, 25}, 1},
+		{"decreasing", []int32{50, 20, 10}, 2},
+		{"out of range and decreasing", []int32{50, -1}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := canaryStepProblems(tt.steps)
+			if len(problems) != tt.problems {
+				t.Errorf("canaryStepProblems(%v) = %q, want %d problems", tt.steps, problems, tt.problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package deploy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	appconfig "opsagents/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Capacity providers every cluster is created with.
+const (
+	CapacityProviderFargate     = "FARGATE"
+	CapacityProviderFargateSpot = "FARGATE_SPOT"
+)
+
+// CapacityProvider is one entry of a capacity provider strategy: Base tasks
+// always run on the provider, the rest are split by Weight.
+type CapacityProvider struct {
+	Provider string
+	Base     int32
+	Weight   int32
+}
+
+func capacityProviders(cfg *appconfig.Config) []CapacityProvider {
+	var providers []CapacityProvider
+	for _, provider := range cfg.AWS.ECS.CapacityProviders {
+		providers = append(providers, CapacityProvider{
+			Provider: provider.Provider,
+			Base:     provider.Base,
+			Weight:   provider.Weight,
+		})
+	}
+	return providers
+}
+
+// validateCapacityProviders checks the strategy against the ECS limits.
+func validateCapacityProviders(config ECSConfig) error {
+	var problems []string
+	seen := map[string]bool{}
+	withBase, weighted := 0, 0
+	for _, provider := range config.CapacityProviders {
+		switch provider.Provider {
+		case CapacityProviderFargate, CapacityProviderFargateSpot:
+		default:
+			problems = append(problems, fmt.Sprintf("provider %q must be %s or %s", provider.Provider, CapacityProviderFargate, CapacityProviderFargateSpot))
+		}
+		if seen[provider.Provider] {
+			problems = append(problems, fmt.Sprintf("provider %s is listed twice", provider.Provider))
+		}
+		seen[provider.Provider] = true
+		if provider.Base < 0 || provider.Base > 100000 {
+			problems = append(problems, fmt.Sprintf("base %d of %s must be between 0 and 100000", provider.Base, provider.Provider))
+		}
+		if provider.Weight < 0 || provider.Weight > 1000 {
+			problems = append(problems, fmt.Sprintf("weight %d of %s must be between 0 and 1000", provider.Weight, provider.Provider))
+		}
+		if provider.Base > 0 {
+			withBase++
+		}
+		if provider.Weight > 0 {
+			weighted++
+		}
+	}
+	if withBase > 1 {
+		problems = append(problems, "only one provider may have a base")
+	}
+	if len(config.CapacityProviders) > 0 && weighted == 0 {
+		problems = append(problems, "at least one provider needs a weight above 0")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid capacity providers:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// capacityProviderStrategy is the strategy of the service's tasks, or nil
+// when they use the FARGATE launch type.
+func capacityProviderStrategy(config ECSConfig) []types.CapacityProviderStrategyItem {
+	if len(config.CapacityProviders) == 0 {
+		return nil
+	}
+	strategy := make([]types.CapacityProviderStrategyItem, 0, len(config.CapacityProviders))
+	for _, provider := range config.CapacityProviders {
+		strategy = append(strategy, types.CapacityProviderStrategyItem{
+			CapacityProvider: aws.String(provider.Provider),
+			Base:             provider.Base,
+			Weight:           provider.Weight,
+		})
+	}
+	return strategy
+}
+
+// launchType is FARGATE unless a capacity provider strategy is configured;
+// ECS accepts only one of them.
+func launchType(config ECSConfig) types.LaunchType {
+	if len(config.CapacityProviders) > 0 {
+		return ""
+	}
+	return types.LaunchTypeFargate
+}
+
+// strategyLabel describes a capacity provider strategy, e.g.
+// "FARGATE base 1 weight 1, FARGATE_SPOT weight 3".
+func strategyLabel(strategy []types.CapacityProviderStrategyItem) string {
+	labels := make([]string, 0, len(strategy))
+	for _, item := range strategy {
+		label := aws.ToString(item.CapacityProvider)
+		if item.Base > 0 {
+			label += fmt.Sprintf(" base %d", item.Base)
+		}
+		labels = append(labels, label+fmt.Sprintf(" weight %d", item.Weight))
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ", ")
+}
+
+// capacityLabel describes where the configured tasks run for plans.
+func capacityLabel(config ECSConfig) string {
+	if strategy := capacityProviderStrategy(config); strategy != nil {
+		return "capacity providers " + strategyLabel(strategy)
+	}
+	return "FARGATE launch type"
+}
+
+// serviceCapacityLabel describes where the tasks of an existing service run.
+func serviceCapacityLabel(service types.Service) string {
+	return runsOnLabel(service.CapacityProviderStrategy, service.LaunchType)
+}
+
+// runsOnLabel describes the strategy or launch type of a service or task set.
+func runsOnLabel(strategy []types.CapacityProviderStrategyItem, launchType types.LaunchType) string {
+	if len(strategy) > 0 {
+		return "capacity providers " + strategyLabel(strategy)
+	}
+	if launchType != "" {
+		return fmt.Sprintf("%s launch type", launchType)
+	}
+	return "the cluster's default capacity providers"
+}
+
+// capacityProviderUpdate returns the strategy an existing service moves to
+// and whether it differs from the current one. A service cannot go back to a
+// launch type, so without a configured strategy it moves to plain FARGATE.
+func capacityProviderUpdate(service types.Service, config ECSConfig) ([]types.CapacityProviderStrategyItem, bool) {
+	desired := capacityProviderStrategy(config)
+	if desired == nil {
+		if len(service.CapacityProviderStrategy) == 0 {
+			return nil, false
+		}
+		desired = []types.CapacityProviderStrategyItem{
+			{CapacityProvider: aws.String(CapacityProviderFargate), Weight: 1},
+		}
+	}
+	if len(service.CapacityProviderStrategy) > 0 && strategyLabel(service.CapacityProviderStrategy) == strategyLabel(desired) {
+		return nil, false
+	}
+	return desired, true
+}
+
+// ensureClusterCapacityProviders adds the configured providers to clusters
+// created without them, keeping the cluster's default strategy.
+func (d *ECSDeployer) ensureClusterCapacityProviders(config ECSConfig, cluster *types.Cluster) error {
+	if cluster == nil || len(config.CapacityProviders) == 0 {
+		return nil
+	}
+	registered := map[string]bool{}
+	for _, provider := range cluster.CapacityProviders {
+		registered[provider] = true
+	}
+	providers := append([]string{}, cluster.CapacityProviders...)
+	var missing []string
+	for _, provider := range config.CapacityProviders {
+		if !registered[provider.Provider] {
+			missing = append(missing, provider.Provider)
+			providers = appendUnique(providers, provider.Provider)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	defaultStrategy := cluster.DefaultCapacityProviderStrategy
+	if len(defaultStrategy) == 0 {
+		defaultStrategy = []types.CapacityProviderStrategyItem{
+			{CapacityProvider: aws.String(CapacityProviderFargate), Weight: 1},
+		}
+		providers = appendUnique(providers, CapacityProviderFargate)
+	}
+	fmt.Printf("Adding capacity providers %s to cluster %s\n", strings.Join(missing, ", "), config.ClusterName)
+	_, err := d.ecsClient.PutClusterCapacityProviders(d.ctx, &ecs.PutClusterCapacityProvidersInput{
+		Cluster:                         aws.String(config.ClusterName),
+		CapacityProviders:               providers,
+		DefaultCapacityProviderStrategy: defaultStrategy,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add capacity providers to cluster: %w", err)
+	}
+	return nil
+}
+
+// taskCapacityProvider is the provider a task was placed on.
+func taskCapacityProvider(task types.Task) string {
+	if provider := aws.ToString(task.CapacityProviderName); provider != "" {
+		return provider
+	}
+	return string(task.LaunchType)
+}
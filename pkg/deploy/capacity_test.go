@@ -0,0 +1,76 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCapacityProviders(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []CapacityProvider
+		wantErr   string
+	}{
+		{
+			name: "launch type",
+		},
+		{
+			name: "fargate with spot",
+			providers: []CapacityProvider{
+				{Provider: CapacityProviderFargate, Base: 1, Weight: 1},
+				{Provider: CapacityProviderFargateSpot, Weight: 3},
+			},
+		},
+		{
+			name:      "unknown provider",
+			providers: []CapacityProvider{{Provider: "EC2", Weight: 1}},
+			wantErr:   `provider "EC2" must be FARGATE or FARGATE_SPOT`,
+		},
+		{
+			name: "listed twice",
+			providers: []CapacityProvider{
+				{Provider: CapacityProviderFargateSpot, Weight: 1},
+				{Provider: CapacityProviderFargateSpot, Weight: 2},
+			},
+			wantErr: "provider FARGATE_SPOT is listed twice",
+		},
+		{
+			name:      "base out of range",
+			providers: []CapacityProvider{{Provider: CapacityProviderFargate, Base: 100001, Weight: 1}},
+			wantErr:   "base 100001 of FARGATE must be between 0 and 100000",
+		},
+		{
+			name:      "weight out of range",
+			providers: []CapacityProvider{{Provider: CapacityProviderFargate, Weight: 1001}},
+			wantErr:   "weight 1001 of FARGATE must be between 0 and 1000",
+		},
+		{
+			name: "two bases",
+			providers: []CapacityProvider{
+				{Provider: CapacityProviderFargate, Base: 1, Weight: 1},
+				{Provider: CapacityProviderFargateSpot, Base: 1, Weight: 1},
+			},
+			wantErr: "only one provider may have a base",
+		},
+		{
+			name:      "no weight",
+			providers: []CapacityProvider{{Provider: CapacityProviderFargate, Base: 2}},
+			wantErr:   "at least one provider needs a weight above 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCapacityProviders(ECSConfig{CapacityProviders: tt.providers})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
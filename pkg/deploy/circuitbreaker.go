@@ -0,0 +1,157 @@
+package deploy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// CircuitBreakerError reports a deployment that the ECS deployment circuit
+// breaker stopped because its tasks kept failing.
+type CircuitBreakerError struct {
+	ServiceName  string
+	DeploymentId string
+	Reason       string
+	// RolledBack is set when ECS rolled the service back to TaskDefinition
+	RolledBack     bool
+	TaskDefinition string
+}
+
+func (e *CircuitBreakerError) Error() string {
+	reason := e.Reason
+	if reason == "" {
+		reason = "tasks failed to start"
+	}
+	if e.RolledBack {
+		return fmt.Sprintf("deployment %s of service %s failed and the circuit breaker rolled it back to %s: %s",
+			e.DeploymentId, e.ServiceName, shortTaskDefinition(e.TaskDefinition), reason)
+	}
+	return fmt.Sprintf("deployment %s of service %s failed and was stopped by the circuit breaker: %s",
+		e.DeploymentId, e.ServiceName, reason)
+}
+
+// deploymentConfiguration returns the rolling deployment settings of the
+// service, including the circuit breaker.
+func deploymentConfiguration(config ECSConfig) *types.DeploymentConfiguration {
+	deployment := &types.DeploymentConfiguration{
+		DeploymentCircuitBreaker: &types.DeploymentCircuitBreaker{
+			Enable:   config.CircuitBreaker,
+			Rollback: config.CircuitBreaker && config.CircuitBreakerRollback,
+		},
+	}
+	if config.MinimumHealthyPercent > 0 {
+		deployment.MinimumHealthyPercent = aws.Int32(config.MinimumHealthyPercent)
+	}
+	if config.MaximumPercent > 0 {
+		deployment.MaximumPercent = aws.Int32(config.MaximumPercent)
+	}
+	return deployment
+}
+
+// deploymentLabel describes the rolling deployment settings for plans.
+func deploymentLabel(config ECSConfig) string {
+	breaker := "circuit breaker off"
+	if config.CircuitBreaker && config.CircuitBreakerRollback {
+		breaker = "circuit breaker with rollback"
+	} else if config.CircuitBreaker {
+		breaker = "circuit breaker without rollback"
+	}
+	return fmt.Sprintf("%s, %d%%-%d%% healthy during deployments", breaker, config.MinimumHealthyPercent, config.MaximumPercent)
+}
+
+// healthCheckGracePeriod returns the grace period for the service, or nil to
+// keep the ECS default.
+func healthCheckGracePeriod(config ECSConfig) *int32 {
+	if config.HealthCheckGracePeriod <= 0 {
+		return nil
+	}
+	return aws.Int32(config.HealthCheckGracePeriod)
+}
+
+// waitForDeployment waits until the service's primary deployment has all its
+// tasks running and the older deployments are gone. It returns a
+// CircuitBreakerError as soon as the circuit breaker fails the deployment.
+func (d *ECSDeployer) waitForDeployment(clusterName, serviceName string, timeout time.Duration) error {
+	config := ECSConfig{ClusterName: clusterName, ServiceName: serviceName}
+	service, err := d.describeService(config)
+	if err != nil {
+		return err
+	}
+	watched := primaryDeployment(service)
+	if watched == nil {
+		return fmt.Errorf("service %s has no primary deployment", serviceName)
+	}
+	watchedId := aws.ToString(watched.Id)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var current *types.Deployment
+		for i, deployment := range service.Deployments {
+			if aws.ToString(deployment.Id) == watchedId {
+				current = &service.Deployments[i]
+			}
+		}
+		primary := primaryDeployment(service)
+
+		if current != nil && current.RolloutState == types.DeploymentRolloutStateFailed {
+			failure := &CircuitBreakerError{
+				ServiceName:  serviceName,
+				DeploymentId: watchedId,
+				Reason:       aws.ToString(current.RolloutStateReason),
+			}
+			if primary != nil && aws.ToString(primary.Id) != watchedId {
+				failure.RolledBack = true
+				failure.TaskDefinition = aws.ToString(primary.TaskDefinition)
+			}
+			return d.circuitBreakerFailure(failure)
+		}
+		if primary != nil && aws.ToString(primary.Id) != watchedId {
+			// The failed deployment was already replaced by the rollback
+			return d.circuitBreakerFailure(&CircuitBreakerError{
+				ServiceName:    serviceName,
+				DeploymentId:   watchedId,
+				RolledBack:     true,
+				TaskDefinition: aws.ToString(primary.TaskDefinition),
+			})
+		}
+
+		if primary != nil && len(service.Deployments) == 1 && primary.RunningCount == primary.DesiredCount {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			running, desired := int32(0), int32(0)
+			if primary != nil {
+				running, desired = primary.RunningCount, primary.DesiredCount
+			}
+			return fmt.Errorf("timeout after %s with %d of %d tasks running", timeout, running, desired)
+		}
+		time.Sleep(15 * time.Second)
+
+		service, err = d.describeService(config)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// circuitBreakerFailure records the revision the service was rolled back to.
+func (d *ECSDeployer) circuitBreakerFailure(failure *CircuitBreakerError) error {
+	if failure.RolledBack && d.state != nil && d.state.Service == failure.ServiceName {
+		d.recordState(func(state *DeploymentState) {
+			state.TaskDefinitionArn = failure.TaskDefinition
+		})
+	}
+	return failure
+}
+
+func primaryDeployment(service *types.Service) *types.Deployment {
+	for i, deployment := range service.Deployments {
+		if aws.ToString(deployment.Status) == "PRIMARY" {
+			return &service.Deployments[i]
+		}
+	}
+	return nil
+}
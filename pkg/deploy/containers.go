@@ -0,0 +1,576 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	appconfig "opsagents/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Names of the containers in the default webapp + Neo4j layout.
+const (
+	WebAppContainer   = "webapp"
+	DatabaseContainer = "database"
+
+	// EFSVolumeName is the volume mounts use for the service's EFS file system
+	EFSVolumeName = "efs"
+)
+
+// ContainerSpec describes one container of the task.
+type ContainerSpec struct {
+	Name        string
+	Image       string
+	CPU         int32
+	Memory      int32 // MiB
+	Ports       []int32
+	Environment map[string]string
+	// Secrets maps environment variables to a Secrets Manager ARN or to the
+	// key of a generated secret such as DB_SECRET_ARN
+	Secrets     map[string]string
+	MountPoints []MountSpec
+	Essential   bool
+	Command     []string
+	HealthCheck *HealthCheckSpec
+	DependsOn   []DependencySpec
+	// StartTimeout is how long the container waits for its dependencies,
+	// StopTimeout how long it gets to exit before it is killed (seconds)
+	StartTimeout int32
+	StopTimeout  int32
+}
+
+// MountSpec mounts a volume of the task into a container.
+type MountSpec struct {
+	Volume   string
+	Path     string
+	ReadOnly bool
+}
+
+// HealthCheckSpec is a container health check; zero values use the ECS defaults.
+type HealthCheckSpec struct {
+	Command     []string
+	Interval    int32 // seconds
+	Timeout     int32 // seconds
+	Retries     int32
+	StartPeriod int32 // seconds
+}
+
+// DependencySpec makes a container wait for another one to reach a condition.
+type DependencySpec struct {
+	Container string
+	Condition string // START, COMPLETE, SUCCESS or HEALTHY
+}
+
+// containerSpecs returns the configured containers, or the webapp and Neo4j
+// database built from the flat settings when aws.ecs.containers is empty.
+func containerSpecs(cfg *appconfig.Config) []ContainerSpec {
+	if len(cfg.AWS.ECS.Containers) == 0 {
+		return defaultContainers(cfg)
+	}
+
+	specs := make([]ContainerSpec, 0, len(cfg.AWS.ECS.Containers))
+	for _, container := range cfg.AWS.ECS.Containers {
+		spec := ContainerSpec{
+			Name:         container.Name,
+			Image:        container.Image,
+			CPU:          container.CPU,
+			Memory:       container.Memory,
+			Ports:        container.Ports,
+			Environment:  container.Environment,
+			Secrets:      container.Secrets,
+			Essential:    container.Essential == nil || *container.Essential,
+			Command:      container.Command,
+			StartTimeout: container.StartTimeout,
+			StopTimeout:  container.StopTimeout,
+		}
+		for _, mount := range container.MountPoints {
+			spec.MountPoints = append(spec.MountPoints, MountSpec{Volume: mount.Volume, Path: mount.Path, ReadOnly: mount.ReadOnly})
+		}
+		if len(container.HealthCheck.Command) > 0 {
+			spec.HealthCheck = &HealthCheckSpec{
+				Command:     container.HealthCheck.Command,
+				Interval:    container.HealthCheck.Interval,
+				Timeout:     container.HealthCheck.Timeout,
+				Retries:     container.HealthCheck.Retries,
+				StartPeriod: container.HealthCheck.StartPeriod,
+			}
+		}
+		for _, dependency := range container.DependsOn {
+			spec.DependsOn = append(spec.DependsOn, DependencySpec{Container: dependency.Container, Condition: dependency.Condition})
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// defaultContainers is the original layout: the web app behind the load
+// balancer with the generated secrets, and a Neo4j database storing its data
+// on EFS when that is enabled. The web app starts once the database is
+// healthy, or once it has started when the database has no health check.
+func defaultContainers(cfg *appconfig.Config) []ContainerSpec {
+	ecsConfig := cfg.AWS.ECS
+	health := ecsConfig.ContainerHealth
+
+	webAppEnvironment := map[string]string{"DB_URI": "bolt://localhost:7687"}
+	for key, value := range ecsConfig.Environment {
+		webAppEnvironment[key] = value
+	}
+	webAppEnvironment["MODE"] = ecsConfig.Mode
+
+	// Without generated secrets Neo4j runs without authentication
+	databaseEnvironment := map[string]string{}
+	if !ecsConfig.CreateSecrets {
+		databaseEnvironment["NEO4J_AUTH"] = "none"
+	}
+
+	healthCheck := func(command string) *HealthCheckSpec {
+		if command == "" {
+			return nil
+		}
+		return &HealthCheckSpec{
+			Command:     []string{command},
+			Interval:    health.Interval,
+			Timeout:     health.Timeout,
+			Retries:     health.Retries,
+			StartPeriod: health.StartPeriod,
+		}
+	}
+	databaseHealthCheck := healthCheck(health.DatabaseCommand)
+	databaseCondition := string(types.ContainerConditionStart)
+	if databaseHealthCheck != nil {
+		databaseCondition = string(types.ContainerConditionHealthy)
+	}
+
+	return []ContainerSpec{
+		{
+			Name:        WebAppContainer,
+			Image:       cfg.Images.AppImage,
+			CPU:         ecsConfig.WebAppCPU,
+			Memory:      ecsConfig.WebAppMemory,
+			Ports:       []int32{ecsConfig.WebAppPort},
+			Environment: webAppEnvironment,
+			Secrets: map[string]string{
+				"DB_ADMIN":          "DB_SECRET_ARN",
+				"JWT_SECRET":        "JWT_SECRET_ARN",
+				"SESSION_KEY":       "SESSION_KEY_ARN",
+				"ANTHROPIC_API_KEY": "ANTHROPIC_SECRET_ARN",
+				"GMAIL_USER":        "GMAIL_USER_ARN",
+				"GMAIL_PASS":        "GMAIL_PASS_ARN",
+			},
+			Essential:    true,
+			HealthCheck:  healthCheck(health.WebAppCommand),
+			DependsOn:    []DependencySpec{{Container: DatabaseContainer, Condition: databaseCondition}},
+			StartTimeout: health.StartTimeout,
+			StopTimeout:  health.StopTimeout,
+		},
+		{
+			Name:        DatabaseContainer,
+			Image:       cfg.Images.Neo4jImage,
+			CPU:         ecsConfig.DatabaseCPU,
+			Memory:      ecsConfig.DatabaseMemory,
+			Ports:       []int32{ecsConfig.DatabaseHTTPPort, ecsConfig.DatabasePort},
+			Environment: databaseEnvironment,
+			Secrets:     map[string]string{"NEO4J_PASSWORD": "DB_SECRET_ARN"},
+			MountPoints: []MountSpec{{Volume: EFSVolumeName, Path: "/data"}},
+			Essential:   false,
+			HealthCheck: databaseHealthCheck,
+			StopTimeout: health.StopTimeout,
+		},
+	}
+}
+
+// validateContainers checks the container list before anything is registered.
+func validateContainers(config ECSConfig) error {
+	if len(config.Containers) == 0 {
+		return fmt.Errorf("no containers configured")
+	}
+
+	var problems []string
+	names := map[string]ContainerSpec{}
+	essential := false
+	for i, container := range config.Containers {
+		if container.Name == "" {
+			problems = append(problems, fmt.Sprintf("container %d has no name", i+1))
+			continue
+		}
+		if _, ok := names[container.Name]; ok {
+			problems = append(problems, fmt.Sprintf("container name %s is used twice", container.Name))
+		}
+		names[container.Name] = container
+		if container.Image == "" {
+			problems = append(problems, fmt.Sprintf("container %s has no image", container.Name))
+		}
+		if container.Memory <= 0 {
+			problems = append(problems, fmt.Sprintf("container %s needs memory", container.Name))
+		}
+		for _, mount := range container.MountPoints {
+			if mount.Volume != EFSVolumeName {
+				problems = append(problems, fmt.Sprintf("container %s mounts unknown volume %q (only %q is available)", container.Name, mount.Volume, EFSVolumeName))
+			}
+		}
+		if container.StartTimeout < 0 || container.StartTimeout > 600 {
+			problems = append(problems, fmt.Sprintf("container %s start_timeout must be between 0 and 600 seconds", container.Name))
+		}
+		if container.StopTimeout < 0 || container.StopTimeout > 120 {
+			problems = append(problems, fmt.Sprintf("container %s stop_timeout must be between 0 and 120 seconds on Fargate", container.Name))
+		}
+		essential = essential || container.Essential
+	}
+	if !essential {
+		problems = append(problems, "at least one container must be essential")
+	}
+
+	for _, container := range config.Containers {
+		for _, dependency := range container.DependsOn {
+			target, ok := names[dependency.Container]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("container %s depends on unknown container %s", container.Name, dependency.Container))
+			case !validCondition(dependency.Condition):
+				problems = append(problems, fmt.Sprintf("container %s depends on %s with unknown condition %q", container.Name, dependency.Container, dependency.Condition))
+			case strings.EqualFold(dependency.Condition, string(types.ContainerConditionHealthy)) && target.HealthCheck == nil:
+				problems = append(problems, fmt.Sprintf("container %s waits for %s to be HEALTHY, but %s has no health check", container.Name, dependency.Container, dependency.Container))
+			}
+		}
+	}
+
+	if loadBalancerContainer(config) == "" {
+		problems = append(problems, fmt.Sprintf("no container exposes webapp_port %d for the load balancer", config.WebAppPort))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid containers:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func validCondition(condition string) bool {
+	for _, valid := range types.ContainerConditionStart.Values() {
+		if strings.EqualFold(condition, string(valid)) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadBalancerContainer is the first container exposing the web app port.
+func loadBalancerContainer(config ECSConfig) string {
+	for _, container := range config.Containers {
+		for _, port := range container.Ports {
+			if port == config.WebAppPort {
+				return container.Name
+			}
+		}
+	}
+	return ""
+}
+
+// containerLogGroups returns the log group of every container.
+func containerLogGroups(config ECSConfig) []string {
+	logGroups := make([]string, 0, len(config.Containers))
+	for _, container := range config.Containers {
+		logGroups = append(logGroups, LogGroupName(config.TaskDefinitionName, container.Name))
+	}
+	return logGroups
+}
+
+// taskDefinitionInput renders the task definition for the configured
+// containers. Secrets referring to generated secrets are only added when
+// secretArns has them, and EFS mounts only when the service has a file system.
+func (d *ECSDeployer) taskDefinitionInput(config ECSConfig, secretArns map[string]string) (*ecs.RegisterTaskDefinitionInput, error) {
+	if err := validateContainers(config); err != nil {
+		return nil, err
+	}
+	if err := validateTaskSize(config); err != nil {
+		return nil, err
+	}
+
+	useEFS := config.CreateEFS && config.EFSVolumeId != ""
+	containerDefinitions := make([]types.ContainerDefinition, 0, len(config.Containers))
+	for _, container := range config.Containers {
+		definition := types.ContainerDefinition{
+			Name:        aws.String(container.Name),
+			Image:       aws.String(container.Image),
+			Memory:      aws.Int32(container.Memory),
+			Cpu:         container.CPU,
+			Command:     container.Command,
+			Environment: mapToEnvironment(container.Environment),
+			Secrets:     containerSecrets(container, secretArns),
+			LogConfiguration: &types.LogConfiguration{
+				LogDriver: types.LogDriverAwslogs,
+				Options: map[string]string{
+					"awslogs-group":         LogGroupName(config.TaskDefinitionName, container.Name),
+					"awslogs-region":        os.Getenv("AWS_REGION"),
+					"awslogs-stream-prefix": "ecs",
+				},
+			},
+			Essential: aws.Bool(container.Essential),
+		}
+		for _, port := range container.Ports {
+			definition.PortMappings = append(definition.PortMappings, types.PortMapping{
+				ContainerPort: aws.Int32(port),
+				Protocol:      types.TransportProtocolTcp,
+			})
+		}
+		for _, mount := range container.MountPoints {
+			if mount.Volume == EFSVolumeName && !useEFS {
+				continue
+			}
+			definition.MountPoints = append(definition.MountPoints, types.MountPoint{
+				SourceVolume:  aws.String(mount.Volume),
+				ContainerPath: aws.String(mount.Path),
+				ReadOnly:      aws.Bool(mount.ReadOnly),
+			})
+		}
+		if container.HealthCheck != nil {
+			definition.HealthCheck = containerHealthCheck(container.HealthCheck)
+		}
+		for _, dependency := range container.DependsOn {
+			definition.DependsOn = append(definition.DependsOn, types.ContainerDependency{
+				ContainerName: aws.String(dependency.Container),
+				Condition:     types.ContainerCondition(strings.ToUpper(dependency.Condition)),
+			})
+		}
+		if container.StartTimeout > 0 {
+			definition.StartTimeout = aws.Int32(container.StartTimeout)
+		}
+		if container.StopTimeout > 0 {
+			definition.StopTimeout = aws.Int32(container.StopTimeout)
+		}
+		containerDefinitions = append(containerDefinitions, definition)
+	}
+
+	var volumes []types.Volume
+	if useEFS {
+		volumes = []types.Volume{
+			{
+				Name: aws.String(EFSVolumeName),
+				EfsVolumeConfiguration: &types.EFSVolumeConfiguration{
+					FileSystemId:      aws.String(config.EFSVolumeId),
+					RootDirectory:     aws.String("/"),
+					TransitEncryption: types.EFSTransitEncryptionEnabled,
+				},
+			},
+		}
+	}
+
+	size := taskSize(config)
+	return &ecs.RegisterTaskDefinitionInput{
+		Family:                  aws.String(config.TaskDefinitionName),
+		NetworkMode:             types.NetworkModeAwsvpc,
+		RequiresCompatibilities: []types.Compatibility{types.CompatibilityFargate},
+		Cpu:                     aws.String(fmt.Sprintf("%d", size.CPU)),
+		Memory:                  aws.String(fmt.Sprintf("%d", size.Memory)),
+		ExecutionRoleArn:        aws.String(config.ExecutionRoleArn),
+		TaskRoleArn:             optionalString(config.TaskRoleArn),
+		ContainerDefinitions:    containerDefinitions,
+		Volumes:                 volumes,
+		Tags:                    ecsTags(config.ResourceTags()),
+	}, nil
+}
+
+// resolveSecret returns the ARN a container secret refers to, or "" for a
+// generated secret that is not available.
+func resolveSecret(reference string, secretArns map[string]string) string {
+	if strings.HasPrefix(reference, "arn:") {
+		return reference
+	}
+	return secretArns[reference]
+}
+
+func containerSecrets(container ContainerSpec, secretArns map[string]string) []types.Secret {
+	var secrets []types.Secret
+	for _, name := range sortedTagKeys(container.Secrets) {
+		if arn := resolveSecret(container.Secrets[name], secretArns); arn != "" {
+			secrets = append(secrets, types.Secret{
+				Name:      aws.String(name),
+				ValueFrom: aws.String(arn),
+			})
+		}
+	}
+	return secrets
+}
+
+// taskSecretArns returns the secrets the containers read, which the
+// execution role needs access to.
+func taskSecretArns(config ECSConfig, secretArns map[string]string) []string {
+	var arns []string
+	for _, container := range config.Containers {
+		for _, reference := range container.Secrets {
+			if arn := resolveSecret(reference, secretArns); arn != "" {
+				arns = appendUnique(arns, arn)
+			}
+		}
+	}
+	sort.Strings(arns)
+	return arns
+}
+
+// containerHealthCheck runs plain commands through the shell.
+func containerHealthCheck(spec *HealthCheckSpec) *types.HealthCheck {
+	command := spec.Command
+	if command[0] != "CMD" && command[0] != "CMD-SHELL" {
+		command = []string{"CMD-SHELL", strings.Join(command, " ")}
+	}
+	healthCheck := &types.HealthCheck{Command: command}
+	if spec.Interval > 0 {
+		healthCheck.Interval = aws.Int32(spec.Interval)
+	}
+	if spec.Timeout > 0 {
+		healthCheck.Timeout = aws.Int32(spec.Timeout)
+	}
+	if spec.Retries > 0 {
+		healthCheck.Retries = aws.Int32(spec.Retries)
+	}
+	if spec.StartPeriod > 0 {
+		healthCheck.StartPeriod = aws.Int32(spec.StartPeriod)
+	}
+	return healthCheck
+}
+
+// mapToEnvironment converts an environment map, sorted so that unchanged
+// settings render the same task definition.
+func mapToEnvironment(envMap map[string]string) []types.KeyValuePair {
+	var env []types.KeyValuePair
+	for _, key := range sortedTagKeys(envMap) {
+		env = append(env, types.KeyValuePair{
+			Name:  aws.String(key),
+			Value: aws.String(envMap[key]),
+		})
+	}
+	return env
+}
+
+// healthCheckLabel describes a container health check for status and plans.
+func healthCheckLabel(healthCheck *types.HealthCheck) string {
+	if healthCheck == nil || len(healthCheck.Command) == 0 {
+		return "no health check"
+	}
+	command := healthCheck.Command
+	if command[0] == "CMD" || command[0] == "CMD-SHELL" {
+		command = command[1:]
+	}
+	label := fmt.Sprintf("health check %q", strings.Join(command, " "))
+	if healthCheck.Interval != nil {
+		label += fmt.Sprintf(" every %ds", aws.ToInt32(healthCheck.Interval))
+	}
+	var options []string
+	if healthCheck.Timeout != nil {
+		options = append(options, fmt.Sprintf("timeout %ds", aws.ToInt32(healthCheck.Timeout)))
+	}
+	if healthCheck.Retries != nil {
+		options = append(options, fmt.Sprintf("%d retries", aws.ToInt32(healthCheck.Retries)))
+	}
+	if aws.ToInt32(healthCheck.StartPeriod) > 0 {
+		options = append(options, fmt.Sprintf("start period %ds", aws.ToInt32(healthCheck.StartPeriod)))
+	}
+	if len(options) > 0 {
+		label += " (" + strings.Join(options, ", ") + ")"
+	}
+	return label
+}
+
+// dependsOnLabel describes the startup order of a container.
+func dependsOnLabel(dependencies []types.ContainerDependency) string {
+	if len(dependencies) == 0 {
+		return ""
+	}
+	labels := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		labels = append(labels, fmt.Sprintf("%s %s", aws.ToString(dependency.ContainerName), dependency.Condition))
+	}
+	return "waits for " + strings.Join(labels, ", ")
+}
+
+// containerLabel summarizes the health check, startup order and timeouts of a
+// registered container.
+func containerLabel(container types.ContainerDefinition) string {
+	parts := []string{healthCheckLabel(container.HealthCheck)}
+	if dependsOn := dependsOnLabel(container.DependsOn); dependsOn != "" {
+		parts = append(parts, dependsOn)
+	}
+	if container.StartTimeout != nil {
+		parts = append(parts, fmt.Sprintf("start timeout %ds", aws.ToInt32(container.StartTimeout)))
+	}
+	if container.StopTimeout != nil {
+		parts = append(parts, fmt.Sprintf("stop timeout %ds", aws.ToInt32(container.StopTimeout)))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ContainerStatus describes the containers of the service's current task
+// definition and the health and capacity provider of its running tasks.
+func (d *ECSDeployer) ContainerStatus(config ECSConfig) (string, error) {
+	service, err := d.describeService(config)
+	if err != nil {
+		return "", err
+	}
+	taskDefinition := aws.ToString(service.TaskDefinition)
+	for _, taskSet := range service.TaskSets {
+		if aws.ToString(taskSet.Status) == "PRIMARY" {
+			taskDefinition = aws.ToString(taskSet.TaskDefinition)
+		}
+	}
+
+	var b strings.Builder
+	if taskDefinition != "" {
+		output, err := d.ecsClient.DescribeTaskDefinition(d.ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: aws.String(taskDefinition),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to describe task definition: %w", err)
+		}
+		fmt.Fprintf(&b, "Containers (%s):\n", shortTaskDefinition(taskDefinition))
+		for _, container := range output.TaskDefinition.ContainerDefinitions {
+			fmt.Fprintf(&b, "  - %s: %s\n", aws.ToString(container.Name), containerLabel(container))
+		}
+	}
+
+	tasks, err := d.ecsClient.ListTasks(d.ctx, &ecs.ListTasksInput{
+		Cluster:     aws.String(config.ClusterName),
+		ServiceName: aws.String(config.ServiceName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list tasks: %w", err)
+	}
+	if len(tasks.TaskArns) == 0 {
+		b.WriteString("Tasks: none running\n")
+		return b.String(), nil
+	}
+	described, err := d.ecsClient.DescribeTasks(d.ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(config.ClusterName),
+		Tasks:   tasks.TaskArns,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe tasks: %w", err)
+	}
+	b.WriteString("Tasks:\n")
+	perProvider := map[string]int{}
+	for _, task := range described.Tasks {
+		containers := make([]string, 0, len(task.Containers))
+		for _, container := range task.Containers {
+			containers = append(containers, fmt.Sprintf("%s %s/%s", aws.ToString(container.Name), aws.ToString(container.LastStatus), container.HealthStatus))
+		}
+		provider := taskCapacityProvider(task)
+		perProvider[provider]++
+		fmt.Fprintf(&b, "  - %s (%s) on %s: %s, %s; %s\n",
+			shortTaskDefinition(aws.ToString(task.TaskArn)),
+			shortTaskDefinition(aws.ToString(task.TaskDefinitionArn)),
+			provider,
+			aws.ToString(task.LastStatus),
+			task.HealthStatus,
+			strings.Join(containers, ", "))
+	}
+	counts := make([]string, 0, len(perProvider))
+	for provider, count := range perProvider {
+		counts = append(counts, fmt.Sprintf("%s %d", provider, count))
+	}
+	sort.Strings(counts)
+	fmt.Fprintf(&b, "Tasks per capacity provider: %s\n", strings.Join(counts, ", "))
+	return b.String(), nil
+}
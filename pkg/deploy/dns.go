@@ -0,0 +1,223 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// DNSConfig configures the Route 53 alias record of the load balancer.
+type DNSConfig struct {
+	Enabled      bool
+	HostedZoneId string
+	RecordName   string
+}
+
+// ensureDNSRecord points an alias A record (and AAAA for dual-stack load
+// balancers) in the hosted zone at the load balancer.
+func (d *ECSDeployer) ensureDNSRecord(config ECSConfig, loadBalancerArn string) error {
+	if !config.DNS.Enabled {
+		return nil
+	}
+	if config.DNS.HostedZoneId == "" || config.DNS.RecordName == "" {
+		return fmt.Errorf("aws.ecs.dns needs hosted_zone_id and record_name")
+	}
+
+	loadBalancer, err := d.describeLoadBalancer(loadBalancerArn)
+	if err != nil {
+		return err
+	}
+
+	recordTypes := []r53types.RRType{r53types.RRTypeA}
+	if loadBalancer.IpAddressType == elbv2types.IpAddressTypeDualstack {
+		recordTypes = append(recordTypes, r53types.RRTypeAaaa)
+	}
+
+	existing, err := d.findAliasRecords(config.DNS.HostedZoneId, config.DNS.RecordName)
+	if err != nil {
+		return err
+	}
+	target := normalizeDNSName(aws.ToString(loadBalancer.DNSName))
+	for _, record := range existing {
+		if alias := normalizeDNSName(aws.ToString(record.AliasTarget.DNSName)); alias != target {
+			fmt.Printf("DNS record %s %s points at %s, replacing it\n", config.DNS.RecordName, record.Type, alias)
+		}
+	}
+
+	var changes []r53types.Change
+	for _, recordType := range recordTypes {
+		changes = append(changes, r53types.Change{
+			Action: r53types.ChangeActionUpsert,
+			ResourceRecordSet: &r53types.ResourceRecordSet{
+				Name: aws.String(config.DNS.RecordName),
+				Type: recordType,
+				AliasTarget: &r53types.AliasTarget{
+					DNSName:              loadBalancer.DNSName,
+					HostedZoneId:         loadBalancer.CanonicalHostedZoneId,
+					EvaluateTargetHealth: true,
+				},
+			},
+		})
+	}
+
+	_, err = d.route53Client.ChangeResourceRecordSets(d.ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(config.DNS.HostedZoneId),
+		ChangeBatch: &r53types.ChangeBatch{
+			Comment: aws.String(fmt.Sprintf("Load balancer of %s", config.ServiceName)),
+			Changes: changes,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update DNS record %s: %w", config.DNS.RecordName, err)
+	}
+
+	fmt.Printf("DNS record %s points at %s\n", config.DNS.RecordName, aws.ToString(loadBalancer.DNSName))
+	d.recordState(func(state *DeploymentState) {
+		state.DNSRecordName = config.DNS.RecordName
+		state.DNSHostedZoneId = config.DNS.HostedZoneId
+	})
+	return nil
+}
+
+// findAliasRecords returns the A and AAAA alias records with the given name.
+func (d *ECSDeployer) findAliasRecords(hostedZoneId, recordName string) ([]r53types.ResourceRecordSet, error) {
+	output, err := d.route53Client.ListResourceRecordSets(d.ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(hostedZoneId),
+		StartRecordName: aws.String(recordName),
+		StartRecordType: r53types.RRTypeA,
+		MaxItems:        aws.Int32(2),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DNS records: %w", err)
+	}
+
+	var records []r53types.ResourceRecordSet
+	for _, record := range output.ResourceRecordSets {
+		if normalizeDNSName(aws.ToString(record.Name)) != normalizeDNSName(recordName) || record.AliasTarget == nil {
+			continue
+		}
+		if record.Type == r53types.RRTypeA || record.Type == r53types.RRTypeAaaa {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// deleteDNSRecords removes the alias records of the service. Records that no
+// longer point at one of the given load balancers are left alone, since
+// someone else has taken the name over.
+func (d *ECSDeployer) deleteDNSRecords(hostedZoneId, recordName string, loadBalancerArns []string) error {
+	if hostedZoneId == "" || recordName == "" {
+		return nil
+	}
+
+	targets := map[string]bool{}
+	for _, arn := range loadBalancerArns {
+		if loadBalancer, err := d.describeLoadBalancer(arn); err == nil {
+			targets[normalizeDNSName(aws.ToString(loadBalancer.DNSName))] = true
+		}
+	}
+
+	records, err := d.findAliasRecords(hostedZoneId, recordName)
+	if err != nil {
+		return err
+	}
+
+	var changes []r53types.Change
+	for i, record := range records {
+		if alias := normalizeDNSName(aws.ToString(record.AliasTarget.DNSName)); !targets[alias] {
+			fmt.Printf("Warning: DNS record %s %s points at %s, not deleting it\n", recordName, record.Type, alias)
+			continue
+		}
+		changes = append(changes, r53types.Change{
+			Action:            r53types.ChangeActionDelete,
+			ResourceRecordSet: &records[i],
+		})
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	_, err = d.route53Client.ChangeResourceRecordSets(d.ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZoneId),
+		ChangeBatch:  &r53types.ChangeBatch{Changes: changes},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete DNS record %s: %w", recordName, err)
+	}
+	fmt.Printf("DNS record %s deleted\n", recordName)
+	return nil
+}
+
+func (d *ECSDeployer) describeLoadBalancer(loadBalancerArn string) (*elbv2types.LoadBalancer, error) {
+	output, err := d.elbv2Client.DescribeLoadBalancers(d.ctx, &elasticloadbalancingv2.DescribeLoadBalancersInput{
+		LoadBalancerArns: []string{loadBalancerArn},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe load balancer: %w", err)
+	}
+	if len(output.LoadBalancers) == 0 {
+		return nil, fmt.Errorf("load balancer %s not found", loadBalancerArn)
+	}
+	return &output.LoadBalancers[0], nil
+}
+
+// findLoadBalancer looks up the load balancer of the service by name.
+func (d *ECSDeployer) findLoadBalancer(serviceName string) (*elbv2types.LoadBalancer, error) {
+	output, err := d.elbv2Client.DescribeLoadBalancers(d.ctx, &elasticloadbalancingv2.DescribeLoadBalancersInput{
+		Names: []string{fmt.Sprintf("%s-alb", serviceName)},
+	})
+	if err != nil || len(output.LoadBalancers) == 0 {
+		return nil, fmt.Errorf("load balancer for %s not found", serviceName)
+	}
+	return &output.LoadBalancers[0], nil
+}
+
+// ServiceURL returns the address the service is reachable at: the DNS record
+// if one is configured, otherwise the load balancer's own DNS name.
+func (d *ECSDeployer) ServiceURL(config ECSConfig) (string, error) {
+	scheme := "http"
+	if config.HTTPS.Enabled {
+		scheme = "https"
+	}
+	if config.DNS.Enabled && config.DNS.RecordName != "" {
+		return fmt.Sprintf("%s://%s", scheme, normalizeDNSName(config.DNS.RecordName)), nil
+	}
+
+	var loadBalancer *elbv2types.LoadBalancer
+	if state, err := d.LoadState(config); err == nil && state.LoadBalancerArn != "" {
+		loadBalancer, _ = d.describeLoadBalancer(state.LoadBalancerArn)
+	}
+	if loadBalancer == nil {
+		var err error
+		if loadBalancer, err = d.findLoadBalancer(config.ServiceName); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s://%s", scheme, strings.ToLower(aws.ToString(loadBalancer.DNSName))), nil
+}
+
+// planDNS describes the alias record of the load balancer.
+func (d *ECSDeployer) planDNS(plan *Plan, config ECSConfig) {
+	if !config.DNS.Enabled {
+		return
+	}
+	records, err := d.findAliasRecords(config.DNS.HostedZoneId, config.DNS.RecordName)
+	if err == nil && len(records) > 0 {
+		plan.add("DNS Record", config.DNS.RecordName, PlanUpdate, fmt.Sprintf("alias to %s-alb in %s", config.ServiceName, config.DNS.HostedZoneId))
+		return
+	}
+	plan.add("DNS Record", config.DNS.RecordName, PlanCreate, fmt.Sprintf("alias A record to %s-alb in %s", config.ServiceName, config.DNS.HostedZoneId))
+}
+
+// normalizeDNSName lowercases a DNS name and strips the trailing dot and the
+// dualstack. prefix Route 53 adds to load balancer aliases.
+func normalizeDNSName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	return strings.TrimPrefix(name, "dualstack.")
+}
@@ -3,15 +3,24 @@ package deploy
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"math/big"
 	"os"
+	"strings"
 	"time"
 
+	appconfig "opsagents/internal/config"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
@@ -22,18 +31,38 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
 	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 type ECSDeployer struct {
-	ecsClient     *ecs.Client
-	ec2Client     *ec2.Client
-	elbv2Client   *elasticloadbalancingv2.Client
-	iamClient     *iam.Client
-	logsClient    *cloudwatchlogs.Client
-	secretsClient *secretsmanager.Client
-	efsClient     *efs.Client
-	ctx           context.Context
+	ecsClient        *ecs.Client
+	ec2Client        *ec2.Client
+	elbv2Client      *elasticloadbalancingv2.Client
+	iamClient        *iam.Client
+	logsClient       *cloudwatchlogs.Client
+	secretsClient    *secretsmanager.Client
+	efsClient        *efs.Client
+	taggingClient    *resourcegroupstaggingapi.Client
+	cloudwatchClient *cloudwatch.Client
+	scalingClient    *applicationautoscaling.Client
+	acmClient        *acm.Client
+	route53Client    *route53.Client
+	stsClient        *sts.Client
+	awsConfig        aws.Config
+	ctx              context.Context
+
+	// stateStore and state track the resources created for the service
+	stateStore StateStore
+	state      *DeploymentState
+	// rollout is the timeline of the last canary deployment
+	rollout *Rollout
+	// secrets is what the last CreateSecrets created, reused or updated
+	secrets *SecretsResult
+	// accountId is looked up from STS on first use
+	accountId string
 }
 
 type ECSConfig struct {
@@ -44,24 +73,250 @@ type ECSConfig struct {
 	SubnetIds          []string
 	SecurityGroupIds   []string
 	LoadBalancerName   string
-	WebAppImage        string
-	DatabaseImage      string
-	WebAppPort         int32
-	DatabasePort       int32 // Neo4j Bolt port (7687)
-	DatabaseHTTPPort   int32 // Neo4j HTTP port (7474)
-	WebAppMemory       int32
-	WebAppCPU          int32
-	DatabaseMemory     int32
-	DatabaseCPU        int32
-	Environment        map[string]string
+	// Containers are the containers of the task; the load balancer forwards
+	// to the first one exposing WebAppPort
+	Containers []ContainerSpec
+	WebAppPort int32
 	// New configuration options
 	CreateSecrets bool
 	CreateEFS     bool
 	EFSVolumeId   string
-	Mode          string
+	// EnvironmentName and State select where created resources are recorded
+	EnvironmentName string
+	State           StateConfig
+	// Tags are added to every created resource, DeploymentId identifies this run
+	Tags         map[string]string
+	DeploymentId string
+	// DeploymentStrategy is rolling, blue_green or canary; the blue/green
+	// options, which canary shares, bound the health checks of a new task set
+	// and keep the old one running
+	DeploymentStrategy     string
+	BlueGreenHealthTimeout time.Duration
+	KeepPreviousTaskSet    bool
+	// CanarySteps are the traffic percentages of the canary strategy; each
+	// step is watched for CanaryStepDuration and fails above CanaryMax5xx
+	CanarySteps        []int32
+	CanaryStepDuration time.Duration
+	CanaryMax5xx       int
+	// Rolling deployment settings: the circuit breaker stops (and optionally
+	// rolls back) deployments whose tasks keep failing
+	CircuitBreaker         bool
+	CircuitBreakerRollback bool
+	MinimumHealthyPercent  int32
+	MaximumPercent         int32
+	HealthCheckGracePeriod int32 // seconds
+	// DesiredCount is the initial task count, Scaling lets Application Auto
+	// Scaling manage it afterwards
+	DesiredCount int32
+	Scaling      ScalingConfig
+	// HTTPS adds a 443 listener with an ACM certificate, DNS an alias record
+	// for the load balancer
+	HTTPS HTTPSConfig
+	DNS   DNSConfig
+	// CreateSecurityGroups creates one security group each for the load
+	// balancer, the tasks and EFS unless SecurityGroupIds is set; the
+	// groups of each role are filled in by resolveNetworking
+	CreateSecurityGroups         bool
+	AllowedCIDRs                 []string
+	LoadBalancerSecurityGroupIds []string
+	TaskSecurityGroupIds         []string
+	EFSSecurityGroupIds          []string
+	// LoadBalancerSubnetIds are public subnets for the load balancer,
+	// TaskSubnetIds private subnets with a NAT route for the tasks; both
+	// default to SubnetIds or are discovered by autoDiscoverNetworking
+	LoadBalancerSubnetIds []string
+	TaskSubnetIds         []string
+	AssignPublicIp        bool
+	// IAM configures the execution and task roles; ExecutionRoleArn and
+	// TaskRoleArn are filled in by ensureRoles
+	IAM              IAMConfig
+	ExecutionRoleArn string
+	TaskRoleArn      string
+	// TargetGroup configures the load balancer health check and target group
+	// attributes; existing groups are brought in line on every deployment
+	TargetGroup TargetGroupConfig
+	// CapacityProviders replaces the FARGATE launch type with a capacity
+	// provider strategy, e.g. to run dev and test tasks on FARGATE_SPOT
+	CapacityProviders []CapacityProvider
+	// TaskCPU and TaskMemory override the task size, which defaults to the
+	// sum of the container sizes; it must be a valid Fargate combination
+	TaskCPU    int32
+	TaskMemory int32
+}
+
+// NewECSConfig builds the deployment configuration from the application config.
+func NewECSConfig(cfg *appconfig.Config) ECSConfig {
+	return ECSConfig{
+		ClusterName:        cfg.AWS.ECS.ClusterName,
+		ServiceName:        cfg.AWS.ECS.ServiceName,
+		TaskDefinitionName: cfg.AWS.ECS.TaskDefinitionName,
+		VpcId:              cfg.AWS.ECS.VpcId,
+		SubnetIds:          cfg.AWS.ECS.SubnetIds,
+		SecurityGroupIds:   cfg.AWS.ECS.SecurityGroupIds,
+		LoadBalancerName:   cfg.AWS.ECS.LoadBalancerName,
+		Containers:         containerSpecs(cfg),
+		WebAppPort:         cfg.AWS.ECS.WebAppPort,
+		CreateSecrets:      cfg.AWS.ECS.CreateSecrets,
+		CreateEFS:          cfg.AWS.ECS.CreateEFS,
+		EFSVolumeId:        cfg.AWS.ECS.EFSVolumeId,
+		EnvironmentName:    cfg.Environment,
+		State: StateConfig{
+			Backend:  cfg.State.Backend,
+			Path:     cfg.State.Path,
+			S3Bucket: cfg.State.S3Bucket,
+			S3Prefix: cfg.State.S3Prefix,
+		},
+		Tags:                   cfg.AWS.Tags,
+		DeploymentId:           NewDeploymentId(),
+		DeploymentStrategy:     cfg.AWS.ECS.DeploymentStrategy,
+		BlueGreenHealthTimeout: time.Duration(cfg.AWS.ECS.BlueGreen.HealthCheckTimeout) * time.Second,
+		KeepPreviousTaskSet:    cfg.AWS.ECS.BlueGreen.KeepPreviousTaskSet,
+		CanarySteps:            canarySteps(cfg.AWS.ECS.Canary.Steps),
+		CanaryStepDuration:     time.Duration(cfg.AWS.ECS.Canary.StepDuration) * time.Second,
+		CanaryMax5xx:           cfg.AWS.ECS.Canary.Max5xxCount,
+		CircuitBreaker:         cfg.AWS.ECS.Deployment.CircuitBreaker,
+		CircuitBreakerRollback: cfg.AWS.ECS.Deployment.Rollback,
+		MinimumHealthyPercent:  cfg.AWS.ECS.Deployment.MinimumHealthyPercent,
+		MaximumPercent:         cfg.AWS.ECS.Deployment.MaximumPercent,
+		HealthCheckGracePeriod: cfg.AWS.ECS.Deployment.HealthCheckGracePeriod,
+		DesiredCount:           cfg.AWS.ECS.DesiredCount,
+		Scaling:                scalingConfig(cfg),
+		HTTPS: HTTPSConfig{
+			Enabled:        cfg.AWS.ECS.HTTPS.Enabled,
+			CertificateArn: cfg.AWS.ECS.HTTPS.CertificateArn,
+			DomainName:     cfg.AWS.ECS.HTTPS.DomainName,
+			HostedZoneId:   cfg.AWS.ECS.HTTPS.HostedZoneId,
+			SSLPolicy:      cfg.AWS.ECS.HTTPS.SSLPolicy,
+			RedirectHTTP:   cfg.AWS.ECS.HTTPS.RedirectHTTP,
+		},
+		DNS:                  dnsConfig(cfg),
+		CreateSecurityGroups: cfg.AWS.ECS.SecurityGroups.Create,
+		AllowedCIDRs:         cfg.AWS.ECS.SecurityGroups.AllowedCIDRs,
+
+		LoadBalancerSubnetIds: cfg.AWS.ECS.LoadBalancerSubnetIds,
+		TaskSubnetIds:         cfg.AWS.ECS.TaskSubnetIds,
+		AssignPublicIp:        cfg.AWS.ECS.AssignPublicIp,
+		IAM: IAMConfig{
+			CreateRoles:            cfg.AWS.ECS.IAM.CreateRoles,
+			ExecutionRoleName:      cfg.AWS.ECS.IAM.ExecutionRoleName,
+			TaskRoleName:           cfg.AWS.ECS.IAM.TaskRoleName,
+			TaskRolePolicyArns:     cfg.AWS.ECS.IAM.TaskRolePolicyArns,
+			TaskRoleInlinePolicies: cfg.AWS.ECS.IAM.TaskRoleInlinePolicies,
+		},
+		TargetGroup:       targetGroupConfig(cfg),
+		CapacityProviders: capacityProviders(cfg),
+		TaskCPU:           cfg.AWS.ECS.TaskCPU,
+		TaskMemory:        cfg.AWS.ECS.TaskMemory,
+	}
+}
+
+// ValidateConfig checks the configuration before anything is created, so a
+// deployment does not fail halfway on a setting AWS rejects.
+func ValidateConfig(config ECSConfig) error {
+	var problems []string
+	for _, validate := range []func(ECSConfig) error{
+		validateContainers,
+		validateTaskSize,
+		validateCapacityProviders,
+		validateTargetGroup,
+		validateScaling,
+		validateBlueGreen,
+		validateCanary,
+	} {
+		if err := validate(config); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("configuration check failed:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// dnsConfig falls back to the HTTPS domain and hosted zone, which usually
+// name the same record.
+func dnsConfig(cfg *appconfig.Config) DNSConfig {
+	dns := DNSConfig{
+		Enabled:      cfg.AWS.ECS.DNS.Enabled,
+		HostedZoneId: cfg.AWS.ECS.DNS.HostedZoneId,
+		RecordName:   cfg.AWS.ECS.DNS.RecordName,
+	}
+	if dns.HostedZoneId == "" {
+		dns.HostedZoneId = cfg.AWS.ECS.HTTPS.HostedZoneId
+	}
+	if dns.RecordName == "" {
+		dns.RecordName = cfg.AWS.ECS.HTTPS.DomainName
+	}
+	return dns
+}
+
+func scalingConfig(cfg *appconfig.Config) ScalingConfig {
+	scaling := cfg.AWS.ECS.Scaling
+	result := ScalingConfig{
+		Enabled:           scaling.Enabled,
+		MinTasks:          scaling.MinTasks,
+		MaxTasks:          scaling.MaxTasks,
+		CPUTarget:         scaling.CPUTarget,
+		MemoryTarget:      scaling.MemoryTarget,
+		RequestsPerTarget: scaling.RequestsPerTarget,
+		ScaleInCooldown:   scaling.ScaleInCooldown,
+		ScaleOutCooldown:  scaling.ScaleOutCooldown,
+	}
+	for _, action := range scaling.Scheduled {
+		result.Scheduled = append(result.Scheduled, ScheduledScaling{
+			Name:     action.Name,
+			Schedule: action.Schedule,
+			Timezone: action.Timezone,
+			MinTasks: action.MinTasks,
+			MaxTasks: action.MaxTasks,
+		})
+	}
+	return result
+}
+
+func canarySteps(steps []int) []int32 {
+	result := make([]int32, 0, len(steps))
+	for _, step := range steps {
+		// Out-of-range values are kept out of range for validateCanary
+		// instead of wrapping around
+		if step > math.MaxInt32 {
+			step = math.MaxInt32
+		} else if step < math.MinInt32 {
+			step = math.MinInt32
+		}
+		result = append(result, int32(step))
+	}
+	return result
 }
 
 func NewECSDeployer() (*ECSDeployer, error) {
+	cfg, err := LoadAWSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ECSDeployer{
+		ecsClient:        ecs.NewFromConfig(cfg),
+		ec2Client:        ec2.NewFromConfig(cfg),
+		elbv2Client:      elasticloadbalancingv2.NewFromConfig(cfg),
+		iamClient:        iam.NewFromConfig(cfg),
+		logsClient:       cloudwatchlogs.NewFromConfig(cfg),
+		secretsClient:    secretsmanager.NewFromConfig(cfg),
+		efsClient:        efs.NewFromConfig(cfg),
+		taggingClient:    resourcegroupstaggingapi.NewFromConfig(cfg),
+		cloudwatchClient: cloudwatch.NewFromConfig(cfg),
+		scalingClient:    applicationautoscaling.NewFromConfig(cfg),
+		acmClient:        acm.NewFromConfig(cfg),
+		route53Client:    route53.NewFromConfig(cfg),
+		stsClient:        sts.NewFromConfig(cfg),
+		awsConfig:        cfg,
+		ctx:              context.Background(),
+	}, nil
+}
+
+// LoadAWSConfig loads the AWS config used by the deployer, preferring static
+// credentials from the environment.
+func LoadAWSConfig() (aws.Config, error) {
 	// Load AWS config with explicit environment variable credentials
 	var cfg aws.Config
 	var err error
@@ -94,39 +349,39 @@ func NewECSDeployer() (*ECSDeployer, error) {
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		return cfg, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	return &ECSDeployer{
-		ecsClient:     ecs.NewFromConfig(cfg),
-		ec2Client:     ec2.NewFromConfig(cfg),
-		elbv2Client:   elasticloadbalancingv2.NewFromConfig(cfg),
-		iamClient:     iam.NewFromConfig(cfg),
-		logsClient:    cloudwatchlogs.NewFromConfig(cfg),
-		secretsClient: secretsmanager.NewFromConfig(cfg),
-		efsClient:     efs.NewFromConfig(cfg),
-		ctx:           context.Background(),
-	}, nil
+	return cfg, nil
 }
 
-func (d *ECSDeployer) CreateCluster(clusterName string) error {
+func (d *ECSDeployer) CreateCluster(config ECSConfig) error {
+	clusterName := config.ClusterName
+	if err := validateCapacityProviders(config); err != nil {
+		return err
+	}
 	fmt.Printf("Creating ECS cluster: %s\n", clusterName)
 
 	input := &ecs.CreateClusterInput{
 		ClusterName:       aws.String(clusterName),
-		CapacityProviders: []string{"FARGATE", "FARGATE_SPOT"},
+		Tags:              ecsTags(config.ResourceTags()),
+		CapacityProviders: []string{CapacityProviderFargate, CapacityProviderFargateSpot},
 		DefaultCapacityProviderStrategy: []types.CapacityProviderStrategyItem{
 			{
-				CapacityProvider: aws.String("FARGATE"),
+				CapacityProvider: aws.String(CapacityProviderFargate),
 				Weight:           1,
 			},
 		},
 	}
 
-	_, err := d.ecsClient.CreateCluster(d.ctx, input)
+	output, err := d.ecsClient.CreateCluster(d.ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to create ECS cluster: %w", err)
 	}
+	// Existing clusters are returned as they are, possibly without Spot
+	if err := d.ensureClusterCapacityProviders(config, output.Cluster); err != nil {
+		return err
+	}
 
 	fmt.Printf("ECS cluster %s created successfully\n", clusterName)
 	return nil
@@ -135,85 +390,8 @@ func (d *ECSDeployer) CreateCluster(clusterName string) error {
 func (d *ECSDeployer) CreateTaskDefinition(config ECSConfig) error {
 	fmt.Printf("Creating task definition: %s\n", config.TaskDefinitionName)
 
-	// Create CloudWatch log groups
-	webAppLogGroup := fmt.Sprintf("/ecs/%s-webapp", config.TaskDefinitionName)
-	dbLogGroup := fmt.Sprintf("/ecs/%s-database", config.TaskDefinitionName)
-
-	d.createLogGroup(webAppLogGroup)
-	d.createLogGroup(dbLogGroup)
-
-	// Task execution role ARN - this should exist or be created
-	taskExecutionRoleArn := "arn:aws:iam::" + d.getAccountId() + ":role/ecsTaskExecutionRole"
-
-	containerDefinitions := []types.ContainerDefinition{
-		{
-			Name:   aws.String("webapp"),
-			Image:  aws.String(config.WebAppImage),
-			Memory: aws.Int32(config.WebAppMemory),
-			Cpu:    config.WebAppCPU,
-			PortMappings: []types.PortMapping{
-				{
-					ContainerPort: aws.Int32(config.WebAppPort),
-					Protocol:      types.TransportProtocolTcp,
-				},
-			},
-			Environment: d.buildWebAppEnvironment(config.Environment, config.Mode),
-			LogConfiguration: &types.LogConfiguration{
-				LogDriver: types.LogDriverAwslogs,
-				Options: map[string]string{
-					"awslogs-group":         webAppLogGroup,
-					"awslogs-region":        os.Getenv("AWS_REGION"),
-					"awslogs-stream-prefix": "ecs",
-				},
-			},
-			Essential: aws.Bool(true),
-		},
-		{
-			Name:   aws.String("database"),
-			Image:  aws.String(config.DatabaseImage),
-			Memory: aws.Int32(config.DatabaseMemory),
-			Cpu:    config.DatabaseCPU,
-			PortMappings: []types.PortMapping{
-				{
-					ContainerPort: aws.Int32(7474), // Neo4j HTTP interface
-					Protocol:      types.TransportProtocolTcp,
-				},
-				{
-					ContainerPort: aws.Int32(7687), // Neo4j Bolt protocol
-					Protocol:      types.TransportProtocolTcp,
-				},
-			},
-			Environment: []types.KeyValuePair{
-				{
-					Name:  aws.String("NEO4J_AUTH"),
-					Value: aws.String("none"),
-				},
-			},
-			LogConfiguration: &types.LogConfiguration{
-				LogDriver: types.LogDriverAwslogs,
-				Options: map[string]string{
-					"awslogs-group":         dbLogGroup,
-					"awslogs-region":        os.Getenv("AWS_REGION"),
-					"awslogs-stream-prefix": "ecs",
-				},
-			},
-			Essential: aws.Bool(false),
-		},
-	}
-
-	input := &ecs.RegisterTaskDefinitionInput{
-		Family:                  aws.String(config.TaskDefinitionName),
-		NetworkMode:             types.NetworkModeAwsvpc,
-		RequiresCompatibilities: []types.Compatibility{types.CompatibilityFargate},
-		Cpu:                     aws.String(fmt.Sprintf("%d", config.WebAppCPU+config.DatabaseCPU)),
-		Memory:                  aws.String(fmt.Sprintf("%d", config.WebAppMemory+config.DatabaseMemory)),
-		ExecutionRoleArn:        aws.String(taskExecutionRoleArn),
-		ContainerDefinitions:    containerDefinitions,
-	}
-
-	_, err := d.ecsClient.RegisterTaskDefinition(d.ctx, input)
-	if err != nil {
-		return fmt.Errorf("failed to register task definition: %w", err)
+	if err := d.registerTaskDefinition(config, nil); err != nil {
+		return err
 	}
 
 	fmt.Printf("Task definition %s registered successfully\n", config.TaskDefinitionName)
@@ -223,166 +401,46 @@ func (d *ECSDeployer) CreateTaskDefinition(config ECSConfig) error {
 func (d *ECSDeployer) CreateTaskDefinitionAdvanced(config ECSConfig, secretArns map[string]string) error {
 	fmt.Printf("Creating advanced task definition: %s\n", config.TaskDefinitionName)
 
-	// Create CloudWatch log groups
-	webAppLogGroup := fmt.Sprintf("/ecs/%s-webapp", config.TaskDefinitionName)
-	dbLogGroup := fmt.Sprintf("/ecs/%s-database", config.TaskDefinitionName)
-
-	d.createLogGroup(webAppLogGroup)
-	d.createLogGroup(dbLogGroup)
-
-	// Task execution role ARN - this should exist or be created
-	taskExecutionRoleArn := "arn:aws:iam::" + d.getAccountId() + ":role/ecsTaskExecutionRole"
+	if err := d.registerTaskDefinition(config, secretArns); err != nil {
+		return err
+	}
 
-	// Build web app environment variables and secrets
-	webAppEnv := d.buildWebAppEnvironment(config.Environment, config.Mode)
-	webAppSecrets := []types.Secret{}
+	fmt.Printf("Advanced task definition %s registered successfully\n", config.TaskDefinitionName)
+	return nil
+}
 
-	// Map secrets to environment variables for web app
-	if arn, exists := secretArns["DB_SECRET_ARN"]; exists {
-		webAppSecrets = append(webAppSecrets, types.Secret{
-			Name:      aws.String("DB_ADMIN"),
-			ValueFrom: aws.String(arn),
-		})
-	}
-	if arn, exists := secretArns["JWT_SECRET_ARN"]; exists {
-		webAppSecrets = append(webAppSecrets, types.Secret{
-			Name:      aws.String("JWT_SECRET"),
-			ValueFrom: aws.String(arn),
-		})
+// registerTaskDefinition registers a new revision for the configured
+// containers, with the generated secrets when secretArns is set.
+func (d *ECSDeployer) registerTaskDefinition(config ECSConfig, secretArns map[string]string) error {
+	if err := d.beginState(config); err != nil {
+		return err
 	}
-	if arn, exists := secretArns["SESSION_KEY_ARN"]; exists {
-		webAppSecrets = append(webAppSecrets, types.Secret{
-			Name:      aws.String("SESSION_KEY"),
-			ValueFrom: aws.String(arn),
-		})
-	}
-	if arn, exists := secretArns["ANTHROPIC_SECRET_ARN"]; exists {
-		webAppSecrets = append(webAppSecrets, types.Secret{
-			Name:      aws.String("ANTHROPIC_API_KEY"),
-			ValueFrom: aws.String(arn),
-		})
+	if err := validateContainers(config); err != nil {
+		return err
 	}
-	if arn, exists := secretArns["GMAIL_USER_ARN"]; exists {
-		webAppSecrets = append(webAppSecrets, types.Secret{
-			Name:      aws.String("GMAIL_USER"),
-			ValueFrom: aws.String(arn),
-		})
-	}
-	if arn, exists := secretArns["GMAIL_PASS_ARN"]; exists {
-		webAppSecrets = append(webAppSecrets, types.Secret{
-			Name:      aws.String("GMAIL_PASS"),
-			ValueFrom: aws.String(arn),
-		})
-	}
-
-	// Build database environment variables and secrets
-	dbSecrets := []types.Secret{}
-	if arn, exists := secretArns["DB_SECRET_ARN"]; exists {
-		dbSecrets = append(dbSecrets, types.Secret{
-			Name:      aws.String("NEO4J_PASSWORD"),
-			ValueFrom: aws.String(arn),
-		})
+	if err := validateTaskSize(config); err != nil {
+		return err
 	}
 
-	// Container definitions
-	containerDefinitions := []types.ContainerDefinition{
-		{
-			Name:   aws.String("webapp"),
-			Image:  aws.String(config.WebAppImage),
-			Memory: aws.Int32(config.WebAppMemory),
-			Cpu:    config.WebAppCPU,
-			PortMappings: []types.PortMapping{
-				{
-					ContainerPort: aws.Int32(config.WebAppPort),
-					Protocol:      types.TransportProtocolTcp,
-				},
-			},
-			Environment: webAppEnv,
-			Secrets:     webAppSecrets,
-			LogConfiguration: &types.LogConfiguration{
-				LogDriver: types.LogDriverAwslogs,
-				Options: map[string]string{
-					"awslogs-group":         webAppLogGroup,
-					"awslogs-region":        os.Getenv("AWS_REGION"),
-					"awslogs-stream-prefix": "ecs",
-				},
-			},
-			Essential: aws.Bool(true),
-		},
-		{
-			Name:   aws.String("database"),
-			Image:  aws.String(config.DatabaseImage),
-			Memory: aws.Int32(config.DatabaseMemory),
-			Cpu:    config.DatabaseCPU,
-			PortMappings: []types.PortMapping{
-				{
-					ContainerPort: aws.Int32(7474), // Neo4j HTTP
-					Protocol:      types.TransportProtocolTcp,
-				},
-				{
-					ContainerPort: aws.Int32(7687), // Neo4j Bolt
-					Protocol:      types.TransportProtocolTcp,
-				},
-			},
-			Secrets: dbSecrets,
-			LogConfiguration: &types.LogConfiguration{
-				LogDriver: types.LogDriverAwslogs,
-				Options: map[string]string{
-					"awslogs-group":         dbLogGroup,
-					"awslogs-region":        os.Getenv("AWS_REGION"),
-					"awslogs-stream-prefix": "ecs",
-				},
-			},
-			Essential: aws.Bool(false),
-		},
+	// Create CloudWatch log groups
+	for _, logGroup := range containerLogGroups(config) {
+		d.createLogGroup(logGroup, config.ResourceTags())
 	}
 
-	// Add EFS mount if configured
-	var volumes []types.Volume
-	if config.CreateEFS && config.EFSVolumeId != "" {
-		volumes = []types.Volume{
-			{
-				Name: aws.String("neo4j-data"),
-				EfsVolumeConfiguration: &types.EFSVolumeConfiguration{
-					FileSystemId:      aws.String(config.EFSVolumeId),
-					RootDirectory:     aws.String("/"),
-					TransitEncryption: types.EFSTransitEncryptionEnabled,
-				},
-			},
-		}
-
-		// Add mount point to database container
-		for i := range containerDefinitions {
-			if *containerDefinitions[i].Name == "database" {
-				containerDefinitions[i].MountPoints = []types.MountPoint{
-					{
-						SourceVolume:  aws.String("neo4j-data"),
-						ContainerPath: aws.String("/data"),
-						ReadOnly:      aws.Bool(false),
-					},
-				}
-				break
-			}
-		}
+	config, err := d.ensureRoles(config, secretArns)
+	if err != nil {
+		return err
 	}
 
-	input := &ecs.RegisterTaskDefinitionInput{
-		Family:                  aws.String(config.TaskDefinitionName),
-		NetworkMode:             types.NetworkModeAwsvpc,
-		RequiresCompatibilities: []types.Compatibility{types.CompatibilityFargate},
-		Cpu:                     aws.String(fmt.Sprintf("%d", config.WebAppCPU+config.DatabaseCPU)),
-		Memory:                  aws.String(fmt.Sprintf("%d", config.WebAppMemory+config.DatabaseMemory)),
-		ExecutionRoleArn:        aws.String(taskExecutionRoleArn),
-		ContainerDefinitions:    containerDefinitions,
-		Volumes:                 volumes,
+	input, err := d.taskDefinitionInput(config, secretArns)
+	if err != nil {
+		return err
 	}
-
-	_, err := d.ecsClient.RegisterTaskDefinition(d.ctx, input)
+	output, err := d.ecsClient.RegisterTaskDefinition(d.ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to register task definition: %w", err)
 	}
-
-	fmt.Printf("Advanced task definition %s registered successfully\n", config.TaskDefinitionName)
+	d.recordTaskDefinition(config, output.TaskDefinition)
 	return nil
 }
 
@@ -390,28 +448,45 @@ func (d *ECSDeployer) CreateTaskDefinitionAdvanced(config ECSConfig, secretArns
 func (d *ECSDeployer) DeployAdvanced(config ECSConfig) error {
 	fmt.Printf("Starting advanced deployment for service: %s\n", config.ServiceName)
 
-	// Create secrets if enabled
+	if err := d.beginState(config); err != nil {
+		return err
+	}
+
+	// Create secrets if enabled, reusing existing ones
 	var secretArns map[string]string
 	if config.CreateSecrets {
-		var err error
-		secretArns, err = d.CreateSecrets(config.ServiceName)
+		result, err := d.CreateSecrets(config)
 		if err != nil {
 			return fmt.Errorf("failed to create secrets: %w", err)
 		}
+		secretArns = result.Arns
+		d.recordState(func(state *DeploymentState) {
+			for key, arn := range secretArns {
+				state.Secrets[key] = arn
+			}
+		})
 	}
 
-	// Create EFS if enabled
-	if config.CreateEFS {
-		// Auto-discover VPC and subnets if not provided
-		if config.VpcId == "" || len(config.SubnetIds) == 0 {
-			updatedConfig, err := d.autoDiscoverNetworking(config)
+	// Create EFS if enabled, reusing the file system recorded by an earlier deploy
+	if config.CreateEFS && d.state.EFSFileSystemId != "" {
+		config.EFSVolumeId = d.state.EFSFileSystemId
+		fmt.Printf("Reusing EFS file system recorded in deployment state: %s\n", config.EFSVolumeId)
+		if usesDedicatedSecurityGroups(config) {
+			updatedConfig, err := d.resolveNetworking(config)
 			if err != nil {
-				return fmt.Errorf("failed to auto-discover VPC config: %w", err)
+				return err
 			}
-			config = updatedConfig
+			d.updateMountTargetSecurityGroups(config.EFSVolumeId, updatedConfig.EFSSecurityGroupIds)
 		}
+	} else if config.CreateEFS {
+		// Auto-discover VPC and subnets if not provided, and the security groups
+		updatedConfig, err := d.resolveNetworking(config)
+		if err != nil {
+			return err
+		}
+		config = updatedConfig
 
-		efsId, err := d.CreateEFS(config.ServiceName, config.SubnetIds, config.SecurityGroupIds)
+		efsId, err := d.CreateEFS(config.ServiceName, config.TaskSubnetIds, config.EFSSecurityGroupIds, config.ResourceTags())
 		if err != nil {
 			return fmt.Errorf("failed to create EFS: %w", err)
 		}
@@ -436,6 +511,18 @@ func (d *ECSDeployer) DeployAdvanced(config ECSConfig) error {
 func (d *ECSDeployer) CreateService(config ECSConfig) error {
 	fmt.Printf("Creating ECS service: %s\n", config.ServiceName)
 
+	if err := d.beginState(config); err != nil {
+		return err
+	}
+
+	switch config.DeploymentStrategy {
+	case "", DeploymentRolling:
+	case DeploymentBlueGreen, DeploymentCanary:
+		return d.deployBlueGreen(config, "")
+	default:
+		return fmt.Errorf("unknown deployment strategy %q (expected %s, %s or %s)", config.DeploymentStrategy, DeploymentRolling, DeploymentBlueGreen, DeploymentCanary)
+	}
+
 	// Check if service already exists
 	describeInput := &ecs.DescribeServicesInput{
 		Cluster:  aws.String(config.ClusterName),
@@ -447,26 +534,95 @@ func (d *ECSDeployer) CreateService(config ECSConfig) error {
 		service := describeOutput.Services[0]
 		if *service.Status == "ACTIVE" {
 			fmt.Printf("ECS service %s already exists and is active, updating task definition\n", config.ServiceName)
+			d.recoverLoadBalancerState(config, service)
 			// Update the service with the new task definition
-			_, updateErr := d.ecsClient.UpdateService(d.ctx, &ecs.UpdateServiceInput{
-				Cluster:        aws.String(config.ClusterName),
-				Service:        aws.String(config.ServiceName),
-				TaskDefinition: aws.String(config.TaskDefinitionName),
-			})
+			updateInput := &ecs.UpdateServiceInput{
+				Cluster:                       aws.String(config.ClusterName),
+				Service:                       aws.String(config.ServiceName),
+				TaskDefinition:                aws.String(config.TaskDefinitionName),
+				DeploymentConfiguration:       deploymentConfiguration(config),
+				HealthCheckGracePeriodSeconds: healthCheckGracePeriod(config),
+			}
+			// Apply subnet, public IP and security group changes; services from
+			// before dedicated security groups move to them here
+			config, err = d.resolveNetworking(config)
+			if err != nil {
+				return err
+			}
+			// Health check and attribute drift is fixed in place; a target group
+			// that needs replacing gets the new tasks registered alongside it
+			replacement, err := d.syncServiceTargetGroup(config, service)
+			if err != nil {
+				return err
+			}
+			if replacement != nil {
+				updateInput.LoadBalancers = replacement.loadBalancers(config)
+			}
+			// Moving between launch type and capacity providers, or between
+			// strategies, only applies to tasks started by a new deployment
+			if strategy, changed := capacityProviderUpdate(service, config); changed {
+				fmt.Printf("Moving service %s from %s to %s\n", config.ServiceName, serviceCapacityLabel(service), "capacity providers "+strategyLabel(strategy))
+				updateInput.CapacityProviderStrategy = strategy
+				updateInput.ForceNewDeployment = true
+			}
+			if d.state.LoadBalancerArn != "" {
+				if err := d.setLoadBalancerSecurityGroups(d.state.LoadBalancerArn, config); err != nil {
+					return err
+				}
+			}
+			updateInput.NetworkConfiguration = taskNetworkConfiguration(config)
+			_, updateErr := d.ecsClient.UpdateService(d.ctx, updateInput)
 			if updateErr != nil {
 				return fmt.Errorf("failed to update ECS service: %w", updateErr)
 			}
+			// Refresh the tags so they carry this deployment's ID
+			_, tagErr := d.ecsClient.TagResource(d.ctx, &ecs.TagResourceInput{
+				ResourceArn: service.ServiceArn,
+				Tags:        ecsTags(config.ResourceTags()),
+			})
+			if tagErr != nil {
+				fmt.Printf("Warning: Failed to tag ECS service: %v\n", tagErr)
+			}
+			d.recordState(func(state *DeploymentState) {
+				state.ClusterName = config.ClusterName
+				state.ServiceArn = aws.ToString(service.ServiceArn)
+				state.DeploymentId = config.DeploymentId
+			})
+			if replacement != nil {
+				if err := d.completeTargetGroupReplacement(config, replacement); err != nil {
+					return err
+				}
+				d.recordState(func(state *DeploymentState) {
+					state.TargetGroupArn = replacement.replacement
+				})
+			}
+			// Services created before HTTPS was enabled get their listeners converted here
+			if config.HTTPS.Enabled && d.state.LoadBalancerArn != "" && d.state.TargetGroupArn != "" {
+				listenerArn, err := d.createListener(d.state.LoadBalancerArn, d.state.TargetGroupArn, config)
+				if err != nil {
+					return fmt.Errorf("failed to configure HTTPS listener: %w", err)
+				}
+				d.recordState(func(state *DeploymentState) {
+					state.ListenerArn = listenerArn
+				})
+			}
+			if d.state.LoadBalancerArn != "" {
+				if err := d.ensureDNSRecord(config, d.state.LoadBalancerArn); err != nil {
+					return err
+				}
+			}
+			if err := d.configureScaling(config, d.state.LoadBalancerArn, d.state.TargetGroupArn); err != nil {
+				return fmt.Errorf("failed to configure auto scaling: %w", err)
+			}
 			fmt.Printf("ECS service %s updated successfully\n", config.ServiceName)
 			return nil
 		}
 	}
 
-	// Auto-discover VPC and subnets if not provided
-	if config.VpcId == "" || len(config.SubnetIds) == 0 {
-		config, err = d.autoDiscoverNetworking(config)
-		if err != nil {
-			return fmt.Errorf("failed to auto-discover networking: %w", err)
-		}
+	// Auto-discover VPC and subnets if not provided, and the security groups
+	config, err = d.resolveNetworking(config)
+	if err != nil {
+		return err
 	}
 
 	// Create load balancer first
@@ -474,45 +630,81 @@ func (d *ECSDeployer) CreateService(config ECSConfig) error {
 	if err != nil {
 		return fmt.Errorf("failed to create load balancer: %w", err)
 	}
+	d.recordState(func(state *DeploymentState) {
+		state.LoadBalancerArn = loadBalancerArn
+	})
+	if err := d.ensureDNSRecord(config, loadBalancerArn); err != nil {
+		return err
+	}
 
 	// Create target group for load balancer
-	targetGroupArn, err := d.createTargetGroup(config)
+	targetGroup, replace, err := d.ensureTargetGroup(config, BlueTargetGroupName(config.ServiceName))
 	if err != nil {
 		return fmt.Errorf("failed to create target group: %w", err)
 	}
+	targetGroupArn := aws.ToString(targetGroup.TargetGroupArn)
+	retiredTargetGroupArn := ""
+	if len(replace) > 0 {
+		// No tasks serve from it yet, so the listener can move right away
+		retiredTargetGroupArn = targetGroupArn
+		targetGroupArn, err = d.createReplacementTargetGroup(config, targetGroupArn, replace)
+		if err != nil {
+			return err
+		}
+	}
+	d.recordState(func(state *DeploymentState) {
+		state.TargetGroupArn = targetGroupArn
+	})
 
 	// Create listener to connect load balancer to target group
-	err = d.createListener(loadBalancerArn, targetGroupArn, config)
+	listenerArn, err := d.createListener(loadBalancerArn, targetGroupArn, config)
 	if err != nil {
 		return fmt.Errorf("failed to create listener: %w", err)
 	}
+	d.recordState(func(state *DeploymentState) {
+		state.ListenerArn = listenerArn
+	})
+	if retiredTargetGroupArn != "" {
+		if err := d.deleteTargetGroup(retiredTargetGroupArn); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
 
 	input := &ecs.CreateServiceInput{
-		ServiceName:    aws.String(config.ServiceName),
-		Cluster:        aws.String(config.ClusterName),
-		TaskDefinition: aws.String(config.TaskDefinitionName),
-		DesiredCount:   aws.Int32(1),
-		LaunchType:     types.LaunchTypeFargate,
-		NetworkConfiguration: &types.NetworkConfiguration{
-			AwsvpcConfiguration: &types.AwsVpcConfiguration{
-				Subnets:        config.SubnetIds,
-				SecurityGroups: config.SecurityGroupIds,
-				AssignPublicIp: types.AssignPublicIpEnabled,
-			},
-		},
+		ServiceName:          aws.String(config.ServiceName),
+		Cluster:              aws.String(config.ClusterName),
+		TaskDefinition:       aws.String(config.TaskDefinitionName),
+		DesiredCount:         aws.Int32(initialDesiredCount(config)),
+		LaunchType:           launchType(config),
+		NetworkConfiguration: taskNetworkConfiguration(config),
 		LoadBalancers: []types.LoadBalancer{
 			{
 				TargetGroupArn: aws.String(targetGroupArn),
-				ContainerName:  aws.String("webapp"),
+				ContainerName:  aws.String(loadBalancerContainer(config)),
 				ContainerPort:  aws.Int32(config.WebAppPort),
 			},
 		},
+		CapacityProviderStrategy:      capacityProviderStrategy(config),
+		DeploymentConfiguration:       deploymentConfiguration(config),
+		HealthCheckGracePeriodSeconds: healthCheckGracePeriod(config),
+		Tags:                          ecsTags(config.ResourceTags()),
+		PropagateTags:                 types.PropagateTagsService,
+		EnableECSManagedTags:          true,
 	}
 
-	_, err = d.ecsClient.CreateService(d.ctx, input)
+	output, err := d.ecsClient.CreateService(d.ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to create ECS service: %w", err)
 	}
+	d.recordState(func(state *DeploymentState) {
+		state.ClusterName = config.ClusterName
+		state.ServiceArn = aws.ToString(output.Service.ServiceArn)
+		state.DeploymentId = config.DeploymentId
+	})
+
+	if err := d.configureScaling(config, loadBalancerArn, targetGroupArn); err != nil {
+		return fmt.Errorf("failed to configure auto scaling: %w", err)
+	}
 
 	fmt.Printf("ECS service %s created successfully\n", config.ServiceName)
 	return nil
@@ -534,12 +726,24 @@ func (d *ECSDeployer) GetServiceStatus(clusterName, serviceName string) (string,
 	}
 
 	service := output.Services[0]
-	status := fmt.Sprintf("Service: %s\nStatus: %s\nRunning: %d\nPending: %d\nDesired: %d",
+	status := fmt.Sprintf("Service: %s\nStatus: %s\nRunning: %d\nPending: %d\nDesired: %d\nCapacity: %s",
 		*service.ServiceName,
 		*service.Status,
 		service.RunningCount,
 		service.PendingCount,
-		service.DesiredCount)
+		service.DesiredCount,
+		serviceCapacityLabel(service))
+
+	for _, taskSet := range service.TaskSets {
+		status += fmt.Sprintf("\nTask Set %s: %s, %s, running %d of %d behind %s on %s",
+			aws.ToString(taskSet.Id),
+			aws.ToString(taskSet.Status),
+			shortTaskDefinition(aws.ToString(taskSet.TaskDefinition)),
+			taskSet.RunningCount,
+			taskSet.ComputedDesiredCount,
+			targetGroupLabel(taskSetTargetGroup(taskSet)),
+			runsOnLabel(taskSet.CapacityProviderStrategy, taskSet.LaunchType))
+	}
 
 	return status, nil
 }
@@ -547,13 +751,26 @@ func (d *ECSDeployer) GetServiceStatus(clusterName, serviceName string) (string,
 func (d *ECSDeployer) WaitForServiceStable(clusterName, serviceName string) error {
 	fmt.Printf("Waiting for service %s to be stable...\n", serviceName)
 
-	waiter := ecs.NewServicesStableWaiter(d.ecsClient)
-	input := &ecs.DescribeServicesInput{
-		Cluster:  aws.String(clusterName),
-		Services: []string{serviceName},
+	// Blue/green services have no ECS deployments, their primary task set is checked instead
+	service, err := d.describeService(ECSConfig{ClusterName: clusterName, ServiceName: serviceName})
+	if err == nil && isExternalService(service) {
+		primary := primaryTaskSet(service)
+		if primary == nil {
+			return fmt.Errorf("service %s has no primary task set", serviceName)
+		}
+		if err := d.waitForTaskSetSteady(clusterName, serviceName, aws.ToString(primary.Id), 10*time.Minute); err != nil {
+			return fmt.Errorf("failed waiting for service to be stable: %w", err)
+		}
+		fmt.Printf("Service %s is now stable!\n", serviceName)
+		return nil
 	}
 
-	err := waiter.Wait(d.ctx, input, 10*time.Minute)
+	err = d.waitForDeployment(clusterName, serviceName, 10*time.Minute)
+	var circuitBreaker *CircuitBreakerError
+	if errors.As(err, &circuitBreaker) {
+		// Reported as is so callers can tell a rolled back deployment from a timeout
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("failed waiting for service to be stable: %w", err)
 	}
@@ -562,51 +779,15 @@ func (d *ECSDeployer) WaitForServiceStable(clusterName, serviceName string) erro
 	return nil
 }
 
-func (d *ECSDeployer) createTargetGroup(config ECSConfig) (string, error) {
-	targetGroupName := fmt.Sprintf("%s-tg", config.ServiceName)
-	fmt.Printf("Creating target group for service: %s\n", config.ServiceName)
-
-	// First, check if a target group with this name already exists
-	describeInput := &elasticloadbalancingv2.DescribeTargetGroupsInput{
-		Names: []string{targetGroupName},
-	}
-
-	describeOutput, err := d.elbv2Client.DescribeTargetGroups(d.ctx, describeInput)
-	if err == nil && len(describeOutput.TargetGroups) > 0 {
-		// Target group exists, reuse it regardless of settings
-		// This avoids the complexity of deleting and recreating
-		existingTG := describeOutput.TargetGroups[0]
-		fmt.Printf("Target group %s already exists, reusing it (port: %d, protocol: %s)\n", 
-			targetGroupName, *existingTG.Port, existingTG.Protocol)
-		return *existingTG.TargetGroupArn, nil
-	}
-
-	// Create new target group
-	input := &elasticloadbalancingv2.CreateTargetGroupInput{
-		Name:                       aws.String(targetGroupName),
-		Protocol:                   elbv2types.ProtocolEnumHttp,
-		Port:                       aws.Int32(config.WebAppPort),
-		VpcId:                      aws.String(config.VpcId),
-		TargetType:                 elbv2types.TargetTypeEnumIp,
-		HealthCheckProtocol:        elbv2types.ProtocolEnumHttp,
-		HealthCheckPath:            aws.String("/health"),
-		HealthCheckIntervalSeconds: aws.Int32(30),
-		HealthyThresholdCount:      aws.Int32(2),
-		UnhealthyThresholdCount:    aws.Int32(3),
-	}
-
-	output, err := d.elbv2Client.CreateTargetGroup(d.ctx, input)
-	if err != nil {
-		return "", fmt.Errorf("failed to create target group: %w", err)
-	}
-
-	fmt.Printf("Created target group: %s\n", targetGroupName)
-	return *output.TargetGroups[0].TargetGroupArn, nil
+// LogGroupName returns the CloudWatch log group of a container in the task.
+func LogGroupName(taskDefinitionName, container string) string {
+	return fmt.Sprintf("/ecs/%s-%s", taskDefinitionName, container)
 }
 
-func (d *ECSDeployer) createLogGroup(logGroupName string) error {
+func (d *ECSDeployer) createLogGroup(logGroupName string, tags map[string]string) error {
 	input := &cloudwatchlogs.CreateLogGroupInput{
 		LogGroupName: aws.String(logGroupName),
+		Tags:         tags,
 	}
 
 	_, err := d.logsClient.CreateLogGroup(d.ctx, input)
@@ -618,92 +799,90 @@ func (d *ECSDeployer) createLogGroup(logGroupName string) error {
 	return nil
 }
 
-func (d *ECSDeployer) mapToEnvironment(envMap map[string]string) []types.KeyValuePair {
-	var env []types.KeyValuePair
-	for key, value := range envMap {
-		env = append(env, types.KeyValuePair{
-			Name:  aws.String(key),
-			Value: aws.String(value),
-		})
-	}
-	return env
-}
-
-func (d *ECSDeployer) buildWebAppEnvironment(envMap map[string]string, mode string) []types.KeyValuePair {
-	// Start with the provided environment variables
-	env := d.mapToEnvironment(envMap)
-	
-	// Add MODE environment variable
-	env = append(env, types.KeyValuePair{
-		Name:  aws.String("MODE"),
-		Value: aws.String(mode),
-	})
-
-	// Add DB_URI environment variable with default value
-	env = append(env, types.KeyValuePair{
-		Name:  aws.String("DB_URI"),
-		Value: aws.String("bolt://localhost:7687"),
-	})
+func (d *ECSDeployer) autoDiscoverNetworking(config ECSConfig, out io.Writer) (ECSConfig, error) {
+	fmt.Fprintln(out, "Auto-discovering VPC and subnet configuration...")
 
-	return env
-}
+	configuredSubnets := append(append(append([]string(nil), config.SubnetIds...), config.LoadBalancerSubnetIds...), config.TaskSubnetIds...)
+	if config.VpcId == "" && len(configuredSubnets) > 0 {
+		// Use the VPC of the configured subnets
+		subnetResult, err := d.ec2Client.DescribeSubnets(d.ctx, &ec2.DescribeSubnetsInput{
+			SubnetIds: configuredSubnets[:1],
+		})
+		if err != nil {
+			return config, fmt.Errorf("failed to describe subnet %s: %w", configuredSubnets[0], err)
+		}
+		if len(subnetResult.Subnets) == 0 {
+			return config, fmt.Errorf("subnet %s not found", configuredSubnets[0])
+		}
+		config.VpcId = aws.ToString(subnetResult.Subnets[0].VpcId)
+		fmt.Fprintf(out, "Using VPC of configured subnets: %s\n", config.VpcId)
+	} else if config.VpcId == "" {
+		// Get default VPC
+		vpcResult, err := d.ec2Client.DescribeVpcs(d.ctx, &ec2.DescribeVpcsInput{
+			Filters: []ec2types.Filter{
+				{
+					Name:   aws.String("is-default"),
+					Values: []string{"true"},
+				},
+			},
+		})
+		if err != nil {
+			return config, fmt.Errorf("failed to describe VPCs: %w", err)
+		}
 
-func (d *ECSDeployer) getAccountId() string {
-	// This is a placeholder - in a real implementation, you'd get this from STS
-	// For now, return the account ID from your .env or a default
-	return "944945738659" // Replace with actual account ID retrieval
-}
+		if len(vpcResult.Vpcs) == 0 {
+			return config, fmt.Errorf("no default VPC found")
+		}
 
-func (d *ECSDeployer) autoDiscoverNetworking(config ECSConfig) (ECSConfig, error) {
-	fmt.Println("Auto-discovering VPC and subnet configuration...")
+		defaultVpc := vpcResult.Vpcs[0]
+		config.VpcId = *defaultVpc.VpcId
+		fmt.Fprintf(out, "Found default VPC: %s\n", config.VpcId)
+	}
 
-	// Get default VPC
-	vpcResult, err := d.ec2Client.DescribeVpcs(d.ctx, &ec2.DescribeVpcsInput{
-		Filters: []ec2types.Filter{
-			{
-				Name:   aws.String("is-default"),
-				Values: []string{"true"},
-			},
-		},
-	})
+	// Classify the subnets of the VPC by their route tables
+	routes, err := d.describeSubnetRoutes(config.VpcId)
 	if err != nil {
-		return config, fmt.Errorf("failed to describe VPCs: %w", err)
+		return config, err
 	}
-
-	if len(vpcResult.Vpcs) == 0 {
-		return config, fmt.Errorf("no default VPC found")
+	if len(routes) == 0 {
+		return config, fmt.Errorf("no subnets found in VPC %s", config.VpcId)
 	}
 
-	defaultVpc := vpcResult.Vpcs[0]
-	config.VpcId = *defaultVpc.VpcId
-	fmt.Printf("Found default VPC: %s\n", config.VpcId)
-
-	// Get public subnets from the default VPC
-	subnetResult, err := d.ec2Client.DescribeSubnets(d.ctx, &ec2.DescribeSubnetsInput{
-		Filters: []ec2types.Filter{
-			{
-				Name:   aws.String("vpc-id"),
-				Values: []string{config.VpcId},
-			},
-		},
-	})
-	if err != nil {
-		return config, fmt.Errorf("failed to describe subnets: %w", err)
+	// subnet_ids applies to both roles unless they are configured separately
+	if len(config.LoadBalancerSubnetIds) == 0 {
+		config.LoadBalancerSubnetIds = config.SubnetIds
 	}
-
-	config.SubnetIds = []string{}
-	for _, subnet := range subnetResult.Subnets {
-		config.SubnetIds = append(config.SubnetIds, *subnet.SubnetId)
+	if len(config.TaskSubnetIds) == 0 {
+		config.TaskSubnetIds = config.SubnetIds
+	}
+	if len(config.LoadBalancerSubnetIds) == 0 {
+		config.LoadBalancerSubnetIds = subnetsPerZone(routes, func(route subnetRoute) bool { return route.public })
+		if len(config.LoadBalancerSubnetIds) < 2 {
+			return config, fmt.Errorf("VPC %s needs public subnets in at least two availability zones for the load balancer", config.VpcId)
+		}
+	}
+	if len(config.TaskSubnetIds) == 0 {
+		// Prefer private subnets with NAT, fall back to the public ones
+		config.TaskSubnetIds = subnetsPerZone(routes, func(route subnetRoute) bool { return route.egress && !route.public })
+		if len(config.TaskSubnetIds) == 0 {
+			config.TaskSubnetIds = config.LoadBalancerSubnetIds
+		}
 	}
-
 	if len(config.SubnetIds) == 0 {
-		return config, fmt.Errorf("no subnets found in VPC %s", config.VpcId)
+		config.SubnetIds = append([]string(nil), config.LoadBalancerSubnetIds...)
+		for _, id := range config.TaskSubnetIds {
+			config.SubnetIds = appendUnique(config.SubnetIds, id)
+		}
 	}
 
-	fmt.Printf("Found %d subnets: %v\n", len(config.SubnetIds), config.SubnetIds)
+	fmt.Fprintf(out, "Load balancer subnets: %s\n", subnetLabel(config.LoadBalancerSubnetIds, routes))
+	fmt.Fprintf(out, "Task subnets: %s\n", subnetLabel(config.TaskSubnetIds, routes))
+	if err := validateSubnets(config, routes); err != nil {
+		return config, err
+	}
 
-	// Create or get default security group if not provided
-	if len(config.SecurityGroupIds) == 0 {
+	// Fall back to the default security group unless dedicated ones are created
+	if len(config.SecurityGroupIds) == 0 && !config.CreateSecurityGroups {
 		sgResult, err := d.ec2Client.DescribeSecurityGroups(d.ctx, &ec2.DescribeSecurityGroupsInput{
 			Filters: []ec2types.Filter{
 				{
@@ -722,7 +901,7 @@ func (d *ECSDeployer) autoDiscoverNetworking(config ECSConfig) (ECSConfig, error
 
 		if len(sgResult.SecurityGroups) > 0 {
 			config.SecurityGroupIds = []string{*sgResult.SecurityGroups[0].GroupId}
-			fmt.Printf("Using default security group: %s\n", config.SecurityGroupIds[0])
+			fmt.Fprintf(out, "Using default security group: %s\n", config.SecurityGroupIds[0])
 		}
 	}
 
@@ -744,6 +923,9 @@ func (d *ECSDeployer) createLoadBalancer(config ECSConfig) (string, error) {
 		existingLB := describeOutput.LoadBalancers[0]
 		if existingLB.State.Code == elbv2types.LoadBalancerStateEnumActive {
 			fmt.Printf("Load balancer %s already exists and is active, reusing it\n", loadBalancerName)
+			if err := d.setLoadBalancerSecurityGroups(aws.ToString(existingLB.LoadBalancerArn), config); err != nil {
+				return "", err
+			}
 			return *existingLB.LoadBalancerArn, nil
 		}
 	}
@@ -751,11 +933,12 @@ func (d *ECSDeployer) createLoadBalancer(config ECSConfig) (string, error) {
 	// Create new load balancer
 	input := &elasticloadbalancingv2.CreateLoadBalancerInput{
 		Name:           aws.String(loadBalancerName),
-		Subnets:        config.SubnetIds,
-		SecurityGroups: config.SecurityGroupIds,
+		Subnets:        config.LoadBalancerSubnetIds,
+		SecurityGroups: config.LoadBalancerSecurityGroupIds,
 		Scheme:         elbv2types.LoadBalancerSchemeEnumInternetFacing,
 		Type:           elbv2types.LoadBalancerTypeEnumApplication,
 		IpAddressType:  elbv2types.IpAddressTypeIpv4,
+		Tags:           elbv2Tags(config.ResourceTags()),
 	}
 
 	output, err := d.elbv2Client.CreateLoadBalancer(d.ctx, input)
@@ -769,7 +952,16 @@ func (d *ECSDeployer) createLoadBalancer(config ECSConfig) (string, error) {
 	return loadBalancerArn, nil
 }
 
-func (d *ECSDeployer) createListener(loadBalancerArn, targetGroupArn string, _ ECSConfig) error {
+// createListener creates the listener that forwards to the target group:
+// the HTTPS listener when HTTPS is enabled, otherwise the HTTP one.
+func (d *ECSDeployer) createListener(loadBalancerArn, targetGroupArn string, config ECSConfig) (string, error) {
+	if config.HTTPS.Enabled {
+		return d.createHTTPSListeners(loadBalancerArn, targetGroupArn, config)
+	}
+	return d.createHTTPListener(loadBalancerArn, targetGroupArn, config)
+}
+
+func (d *ECSDeployer) createHTTPListener(loadBalancerArn, targetGroupArn string, config ECSConfig) (string, error) {
 	fmt.Printf("Creating listener for load balancer\n")
 
 	// First, check if a listener already exists for this load balancer on port 80
@@ -796,7 +988,7 @@ func (d *ECSDeployer) createListener(loadBalancerArn, targetGroupArn string, _ E
 					fmt.Printf("Warning: Failed to update existing listener: %v\n", updateErr)
 				} else {
 					fmt.Printf("Listener updated successfully\n")
-					return nil
+					return aws.ToString(listener.ListenerArn), nil
 				}
 			}
 		}
@@ -813,25 +1005,60 @@ func (d *ECSDeployer) createListener(loadBalancerArn, targetGroupArn string, _ E
 				TargetGroupArn: aws.String(targetGroupArn),
 			},
 		},
+		Tags: elbv2Tags(config.ResourceTags()),
 	}
 
-	_, err = d.elbv2Client.CreateListener(d.ctx, input)
+	output, err := d.elbv2Client.CreateListener(d.ctx, input)
 	if err != nil {
-		return fmt.Errorf("failed to create listener: %w", err)
+		return "", fmt.Errorf("failed to create listener: %w", err)
 	}
 
 	fmt.Printf("Listener created successfully\n")
-	return nil
+	if len(output.Listeners) == 0 {
+		return "", nil
+	}
+	return aws.ToString(output.Listeners[0].ListenerArn), nil
 }
 
-
 func (d *ECSDeployer) Cleanup(config ECSConfig) error {
 	fmt.Printf("Starting cleanup of ECS resources for service: %s\n", config.ServiceName)
 
+	// Resources recorded in the deployment state or tagged for this service
+	// take precedence over names derived from the config
+	state, err := d.LoadState(config)
+	if err != nil {
+		fmt.Printf("Warning: %v, falling back to configured resource names\n", err)
+		state = newDeploymentState(config.ServiceName, config.EnvironmentName)
+	}
+	inventory, err := d.Inventory(config, false)
+	if err != nil {
+		fmt.Printf("Warning: %v, tagged resources will not be discovered\n", err)
+	}
+	owned := collectOwnedResources(state, inventory)
+
+	// Only deployments from before state and tagging fall back to names
+	legacy := state.IsEmpty() && len(inventory) == 0
+	if legacy {
+		fmt.Printf("No recorded or tagged resources found, falling back to configured resource names\n")
+	}
+
+	// The state is only forgotten once everything it records is gone, so a
+	// second cleanup still finds what the first one left behind
+	var failed []string
+	warn := func(what string, err error) {
+		fmt.Printf("Warning: Failed to delete %s: %v\n", what, err)
+		failed = append(failed, what)
+	}
+
+	// Auto scaling would otherwise keep the desired count above zero
+	if err := d.removeScaling(config); err != nil {
+		fmt.Printf("Warning: Failed to remove auto scaling: %v\n", err)
+	}
+
 	// Delete ECS service first
-	err := d.deleteService(config.ClusterName, config.ServiceName)
+	err = d.deleteService(config.ClusterName, config.ServiceName)
 	if err != nil {
-		fmt.Printf("Warning: Failed to delete service: %v\n", err)
+		warn("service", err)
 	}
 
 	// Delete task definition
@@ -840,10 +1067,29 @@ func (d *ECSDeployer) Cleanup(config ECSConfig) error {
 		fmt.Printf("Warning: Failed to delete task definition: %v\n", err)
 	}
 
+	// Delete the DNS record while the load balancer it points at still exists
+	dnsRecordName, dnsHostedZoneId := state.DNSRecordName, state.DNSHostedZoneId
+	if dnsRecordName == "" && config.DNS.Enabled {
+		dnsRecordName, dnsHostedZoneId = config.DNS.RecordName, config.DNS.HostedZoneId
+	}
+	loadBalancerArns := owned.loadBalancers
+	if len(loadBalancerArns) == 0 {
+		if loadBalancer, err := d.findLoadBalancer(config.ServiceName); err == nil {
+			loadBalancerArns = []string{aws.ToString(loadBalancer.LoadBalancerArn)}
+		}
+	}
+	if err := d.deleteDNSRecords(dnsHostedZoneId, dnsRecordName, loadBalancerArns); err != nil {
+		warn("DNS record", err)
+	}
+
 	// Delete load balancer and associated resources
-	err = d.deleteLoadBalancerResources(config.ServiceName)
+	if legacy {
+		err = d.deleteLoadBalancerResources(config.ServiceName)
+	} else {
+		err = d.deleteLoadBalancers(owned.loadBalancers, owned.targetGroups)
+	}
 	if err != nil {
-		fmt.Printf("Warning: Failed to delete load balancer resources: %v\n", err)
+		warn("load balancer resources", err)
 	}
 
 	// Delete cluster (if empty)
@@ -853,27 +1099,66 @@ func (d *ECSDeployer) Cleanup(config ECSConfig) error {
 	}
 
 	// Delete log groups
-	err = d.deleteLogGroups(config.TaskDefinitionName)
+	if legacy {
+		err = d.deleteLogGroups(config.TaskDefinitionName)
+	} else {
+		err = d.deleteLogGroupNames(owned.logGroups)
+	}
 	if err != nil {
-		fmt.Printf("Warning: Failed to delete log groups: %v\n", err)
+		warn("log groups", err)
 	}
 
 	// Delete secrets if they were created
-	if config.CreateSecrets {
+	if len(owned.secrets) > 0 {
+		err = d.deleteSecretIds(owned.secrets)
+		if err != nil {
+			warn("secrets", err)
+		}
+	} else if legacy && config.CreateSecrets {
 		err = d.deleteSecrets(config.ServiceName)
 		if err != nil {
-			fmt.Printf("Warning: Failed to delete secrets: %v\n", err)
+			warn("secrets", err)
 		}
 	}
 
 	// Delete EFS if it was created
-	if config.CreateEFS && config.EFSVolumeId != "" {
-		err = d.deleteEFS(config.EFSVolumeId, config.SubnetIds)
+	fileSystems := owned.fileSystems
+	if len(fileSystems) == 0 && config.CreateEFS && config.EFSVolumeId != "" {
+		fileSystems = []string{config.EFSVolumeId}
+	}
+	for _, efsId := range fileSystems {
+		err = d.deleteEFS(efsId, config.SubnetIds)
 		if err != nil {
-			fmt.Printf("Warning: Failed to delete EFS: %v\n", err)
+			warn("EFS "+efsId, err)
 		}
 	}
 
+	// Security groups go last, once the tasks, load balancer and mount targets are gone
+	if len(owned.securityGroups) > 0 {
+		if err := d.deleteSecurityGroups(owned.securityGroups); err != nil {
+			warn("security groups", err)
+		}
+	}
+
+	// Certificates can only be deleted once the load balancer no longer uses them
+	if err := d.deleteCertificates(owned.certificates); err != nil {
+		warn("certificates", err)
+	}
+
+	// Roles are only deleted once no task runs with them
+	roleNames := state.IAMRoles
+	if config.IAM.CreateRoles {
+		roleNames = appendUnique(appendUnique(roleNames, ExecutionRoleName(config)), TaskRoleName(config))
+	}
+	if err := d.deleteRoles(config, roleNames); err != nil {
+		warn("IAM roles", err)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete the %s of %s; the deployment state is kept, run cleanup again once the cause is fixed", strings.Join(failed, ", "), config.ServiceName)
+	}
+	d.forgetState(config)
+
 	fmt.Printf("Cleanup completed for service: %s\n", config.ServiceName)
 	return nil
 }
@@ -887,6 +1172,10 @@ func (d *ECSDeployer) deleteService(clusterName, serviceName string) error {
 		Service:      aws.String(serviceName),
 		DesiredCount: aws.Int32(0),
 	})
+	if isAPIError(err, "ServiceNotFoundException") || isAPIError(err, "ServiceNotActiveException") || isAPIError(err, "ClusterNotFoundException") {
+		fmt.Printf("ECS service %s not found, skipping deletion\n", serviceName)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to scale down service: %w", err)
 	}
@@ -903,9 +1192,11 @@ func (d *ECSDeployer) deleteService(clusterName, serviceName string) error {
 	}
 
 	// Delete the service
+	// Force also removes the task sets of blue/green services
 	_, err = d.ecsClient.DeleteService(d.ctx, &ecs.DeleteServiceInput{
 		Cluster: aws.String(clusterName),
 		Service: aws.String(serviceName),
+		Force:   aws.Bool(true),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete service: %w", err)
@@ -918,17 +1209,15 @@ func (d *ECSDeployer) deleteService(clusterName, serviceName string) error {
 func (d *ECSDeployer) deleteTaskDefinition(taskDefinitionName string) error {
 	fmt.Printf("Deregistering task definition: %s\n", taskDefinitionName)
 
-	// List all revisions of the task definition
-	listOutput, err := d.ecsClient.ListTaskDefinitions(d.ctx, &ecs.ListTaskDefinitionsInput{
-		FamilyPrefix: aws.String(taskDefinitionName),
-		Status:       types.TaskDefinitionStatusActive,
-	})
+	// List all revisions of the task definition; the family is matched exactly
+	// so families sharing its prefix, e.g. app-worker for app, are kept
+	revisions, err := d.listFamilyRevisions(taskDefinitionName, 0)
 	if err != nil {
-		return fmt.Errorf("failed to list task definitions: %w", err)
+		return err
 	}
 
 	// Deregister all revisions
-	for _, taskDefArn := range listOutput.TaskDefinitionArns {
+	for _, taskDefArn := range revisions {
 		_, err := d.ecsClient.DeregisterTaskDefinition(d.ctx, &ecs.DeregisterTaskDefinitionInput{
 			TaskDefinition: aws.String(taskDefArn),
 		})
@@ -946,72 +1235,83 @@ func (d *ECSDeployer) deleteLoadBalancerResources(serviceName string) error {
 	fmt.Printf("Deleting load balancer resources for service: %s\n", serviceName)
 
 	loadBalancerName := fmt.Sprintf("%s-alb", serviceName)
-	targetGroupName := fmt.Sprintf("%s-tg", serviceName)
+
+	var loadBalancerArns, targetGroupArns []string
 
 	// Get load balancer ARN
 	lbOutput, err := d.elbv2Client.DescribeLoadBalancers(d.ctx, &elasticloadbalancingv2.DescribeLoadBalancersInput{
 		Names: []string{loadBalancerName},
 	})
-	if err != nil {
+	if err != nil || len(lbOutput.LoadBalancers) == 0 {
 		fmt.Printf("Load balancer %s not found, skipping deletion\n", loadBalancerName)
-		return nil
+	} else {
+		loadBalancerArns = append(loadBalancerArns, *lbOutput.LoadBalancers[0].LoadBalancerArn)
 	}
 
-	if len(lbOutput.LoadBalancers) == 0 {
-		fmt.Printf("Load balancer %s not found\n", loadBalancerName)
-		return nil
+	// Get target group ARNs, including the green one of blue/green deployments
+	for _, targetGroupName := range []string{BlueTargetGroupName(serviceName), GreenTargetGroupName(serviceName)} {
+		tgOutput, err := d.elbv2Client.DescribeTargetGroups(d.ctx, &elasticloadbalancingv2.DescribeTargetGroupsInput{
+			Names: []string{targetGroupName},
+		})
+		if err != nil || len(tgOutput.TargetGroups) == 0 {
+			fmt.Printf("Target group %s not found, skipping deletion\n", targetGroupName)
+		} else {
+			targetGroupArns = append(targetGroupArns, *tgOutput.TargetGroups[0].TargetGroupArn)
+		}
 	}
 
-	loadBalancerArn := *lbOutput.LoadBalancers[0].LoadBalancerArn
+	return d.deleteLoadBalancers(loadBalancerArns, targetGroupArns)
+}
 
-	// Delete listeners first
-	listenersOutput, err := d.elbv2Client.DescribeListeners(d.ctx, &elasticloadbalancingv2.DescribeListenersInput{
-		LoadBalancerArn: aws.String(loadBalancerArn),
-	})
-	if err == nil {
-		for _, listener := range listenersOutput.Listeners {
-			_, err := d.elbv2Client.DeleteListener(d.ctx, &elasticloadbalancingv2.DeleteListenerInput{
-				ListenerArn: listener.ListenerArn,
-			})
-			if err != nil {
-				fmt.Printf("Warning: Failed to delete listener: %v\n", err)
-			} else {
-				fmt.Printf("Listener deleted: %s\n", *listener.ListenerArn)
+// deleteLoadBalancers deletes load balancers with their listeners, then the
+// target groups.
+func (d *ECSDeployer) deleteLoadBalancers(loadBalancerArns, targetGroupArns []string) error {
+	for _, loadBalancerArn := range loadBalancerArns {
+		// Delete listeners first
+		listenersOutput, err := d.elbv2Client.DescribeListeners(d.ctx, &elasticloadbalancingv2.DescribeListenersInput{
+			LoadBalancerArn: aws.String(loadBalancerArn),
+		})
+		if err == nil {
+			for _, listener := range listenersOutput.Listeners {
+				_, err := d.elbv2Client.DeleteListener(d.ctx, &elasticloadbalancingv2.DeleteListenerInput{
+					ListenerArn: listener.ListenerArn,
+				})
+				if err != nil {
+					fmt.Printf("Warning: Failed to delete listener: %v\n", err)
+				} else {
+					fmt.Printf("Listener deleted: %s\n", *listener.ListenerArn)
+				}
 			}
 		}
-	}
 
-	// Delete load balancer
-	_, err = d.elbv2Client.DeleteLoadBalancer(d.ctx, &elasticloadbalancingv2.DeleteLoadBalancerInput{
-		LoadBalancerArn: aws.String(loadBalancerArn),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to delete load balancer: %w", err)
+		// Delete load balancer
+		_, err = d.elbv2Client.DeleteLoadBalancer(d.ctx, &elasticloadbalancingv2.DeleteLoadBalancerInput{
+			LoadBalancerArn: aws.String(loadBalancerArn),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete load balancer: %w", err)
+		}
+		fmt.Printf("Load balancer %s deleted\n", loadBalancerArn)
 	}
-	fmt.Printf("Load balancer %s deleted\n", loadBalancerName)
-
-	// Wait a bit for load balancer to be deleted before deleting target group
-	fmt.Printf("Waiting for load balancer to be deleted...\n")
-	time.Sleep(30 * time.Second)
 
-	// Delete target group
-	tgOutput, err := d.elbv2Client.DescribeTargetGroups(d.ctx, &elasticloadbalancingv2.DescribeTargetGroupsInput{
-		Names: []string{targetGroupName},
-	})
-	if err != nil {
-		fmt.Printf("Target group %s not found, skipping deletion\n", targetGroupName)
-		return nil
+	if len(loadBalancerArns) > 0 && len(targetGroupArns) > 0 {
+		// Wait a bit for load balancer to be deleted before deleting target group
+		fmt.Printf("Waiting for load balancer to be deleted...\n")
+		time.Sleep(30 * time.Second)
 	}
 
-	if len(tgOutput.TargetGroups) > 0 {
-		targetGroupArn := *tgOutput.TargetGroups[0].TargetGroupArn
-		_, err = d.elbv2Client.DeleteTargetGroup(d.ctx, &elasticloadbalancingv2.DeleteTargetGroupInput{
+	// Delete target groups
+	for _, targetGroupArn := range targetGroupArns {
+		_, err := d.elbv2Client.DeleteTargetGroup(d.ctx, &elasticloadbalancingv2.DeleteTargetGroupInput{
 			TargetGroupArn: aws.String(targetGroupArn),
 		})
+		if isAPIError(err, "TargetGroupNotFound") {
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("failed to delete target group: %w", err)
 		}
-		fmt.Printf("Target group %s deleted\n", targetGroupName)
+		fmt.Printf("Target group %s deleted\n", targetGroupArn)
 	}
 
 	return nil
@@ -1061,115 +1361,33 @@ func (d *ECSDeployer) deleteCluster(clusterName string) error {
 func (d *ECSDeployer) deleteLogGroups(taskDefinitionName string) error {
 	fmt.Printf("Deleting log groups for task definition: %s\n", taskDefinitionName)
 
-	webAppLogGroup := fmt.Sprintf("/ecs/%s-webapp", taskDefinitionName)
-	dbLogGroup := fmt.Sprintf("/ecs/%s-database", taskDefinitionName)
-
-	// Delete web app log group
-	_, err := d.logsClient.DeleteLogGroup(d.ctx, &cloudwatchlogs.DeleteLogGroupInput{
-		LogGroupName: aws.String(webAppLogGroup),
+	return d.deleteLogGroupNames([]string{
+		LogGroupName(taskDefinitionName, WebAppContainer),
+		LogGroupName(taskDefinitionName, DatabaseContainer),
 	})
-	if err != nil {
-		fmt.Printf("Warning: Failed to delete log group %s: %v\n", webAppLogGroup, err)
-	} else {
-		fmt.Printf("Log group %s deleted\n", webAppLogGroup)
-	}
-
-	// Delete database log group
-	_, err = d.logsClient.DeleteLogGroup(d.ctx, &cloudwatchlogs.DeleteLogGroupInput{
-		LogGroupName: aws.String(dbLogGroup),
-	})
-	if err != nil {
-		fmt.Printf("Warning: Failed to delete log group %s: %v\n", dbLogGroup, err)
-	} else {
-		fmt.Printf("Log group %s deleted\n", dbLogGroup)
-	}
-
-	return nil
 }
 
-func (d *ECSDeployer) CreateSecrets(serviceName string) (map[string]string, error) {
-	fmt.Printf("Creating secrets for service: %s\n", serviceName)
-
-	secrets := make(map[string]string)
-
-	// 1. Database secret
-	dbSecret, err := d.generateRandomPassword(32)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate database password: %w", err)
-	}
-	dbSecretArn, err := d.createSecret(fmt.Sprintf("%s-db-password", serviceName), dbSecret, "Database password for Neo4j")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create database secret: %w", err)
-	}
-	secrets["DB_SECRET_ARN"] = dbSecretArn
-
-	// 2. JWT Secret
-	jwtSecret, err := d.generateRandomPassword(64)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate JWT secret: %w", err)
-	}
-	jwtSecretArn, err := d.createSecret(fmt.Sprintf("%s-jwt-secret", serviceName), jwtSecret, "JWT secret for authentication")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create JWT secret: %w", err)
-	}
-	secrets["JWT_SECRET_ARN"] = jwtSecretArn
-
-	// 3. Session Key
-	sessionKey, err := d.generateRandomPassword(32)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate session key: %w", err)
-	}
-	sessionKeyArn, err := d.createSecret(fmt.Sprintf("%s-session-key", serviceName), sessionKey, "Session key for session management")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create session key: %w", err)
-	}
-	secrets["SESSION_KEY_ARN"] = sessionKeyArn
-
-	// 4. Anthropic API Key (from environment variable)
-	if anthropicKey := os.Getenv("ANTHROPIC_API_KEY"); anthropicKey != "" {
-		anthropicArn, err := d.createSecret(fmt.Sprintf("%s-anthropic-key", serviceName), anthropicKey, "Anthropic API key")
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Anthropic API secret: %w", err)
-		}
-		secrets["ANTHROPIC_SECRET_ARN"] = anthropicArn
-	}
-
-	// 5. Gmail User (from environment variable)
-	if gmailUser := os.Getenv("GMAIL_USER"); gmailUser != "" {
-		gmailUserArn, err := d.createSecret(fmt.Sprintf("%s-gmail-user", serviceName), gmailUser, "Gmail user for email integration")
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Gmail user secret: %w", err)
-		}
-		secrets["GMAIL_USER_ARN"] = gmailUserArn
-	}
-
-	// 6. Gmail Password (from environment variable)
-	if gmailPass := os.Getenv("GMAIL_PASS"); gmailPass != "" {
-		gmailPassArn, err := d.createSecret(fmt.Sprintf("%s-gmail-pass", serviceName), gmailPass, "Gmail password for email integration")
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Gmail password secret: %w", err)
+// deleteLogGroupNames deletes the log groups; ones that do not exist count
+// as deleted.
+func (d *ECSDeployer) deleteLogGroupNames(logGroupNames []string) error {
+	var failed []string
+	for _, logGroupName := range logGroupNames {
+		_, err := d.logsClient.DeleteLogGroup(d.ctx, &cloudwatchlogs.DeleteLogGroupInput{
+			LogGroupName: aws.String(logGroupName),
+		})
+		switch {
+		case err == nil:
+			fmt.Printf("Log group %s deleted\n", logGroupName)
+		case isAPIError(err, "ResourceNotFoundException"):
+		default:
+			failed = append(failed, fmt.Sprintf("%s: %v", logGroupName, err))
 		}
-		secrets["GMAIL_PASS_ARN"] = gmailPassArn
 	}
 
-	fmt.Printf("Created %d secrets successfully\n", len(secrets))
-	return secrets, nil
-}
-
-func (d *ECSDeployer) createSecret(name, value, description string) (string, error) {
-	input := &secretsmanager.CreateSecretInput{
-		Name:         aws.String(name),
-		SecretString: aws.String(value),
-		Description:  aws.String(description),
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
 	}
-
-	result, err := d.secretsClient.CreateSecret(d.ctx, input)
-	if err != nil {
-		return "", fmt.Errorf("failed to create secret %s: %w", name, err)
-	}
-
-	fmt.Printf("Created secret: %s\n", name)
-	return *result.ARN, nil
+	return nil
 }
 
 func (d *ECSDeployer) generateRandomPassword(length int) (string, error) {
@@ -1187,25 +1405,21 @@ func (d *ECSDeployer) generateRandomPassword(length int) (string, error) {
 	return string(b), nil
 }
 
-func (d *ECSDeployer) CreateEFS(serviceName string, subnetIds []string, securityGroupIds []string) (string, error) {
+func (d *ECSDeployer) CreateEFS(serviceName string, subnetIds []string, securityGroupIds []string, tags map[string]string) (string, error) {
 	fmt.Printf("Creating EFS file system for service: %s\n", serviceName)
 
+	efsTagMap := map[string]string{"Name": fmt.Sprintf("%s-neo4j-data", serviceName)}
+	for key, value := range tags {
+		efsTagMap[key] = value
+	}
+
 	// Create EFS file system
 	createInput := &efs.CreateFileSystemInput{
 		CreationToken:                aws.String(fmt.Sprintf("%s-efs", serviceName)),
 		PerformanceMode:              efstypes.PerformanceModeGeneralPurpose,
 		ThroughputMode:               efstypes.ThroughputModeProvisioned,
 		ProvisionedThroughputInMibps: aws.Float64(10), // 10 MiB/s
-		Tags: []efstypes.Tag{
-			{
-				Key:   aws.String("Name"),
-				Value: aws.String(fmt.Sprintf("%s-neo4j-data", serviceName)),
-			},
-			{
-				Key:   aws.String("Service"),
-				Value: aws.String(serviceName),
-			},
-		},
+		Tags:                         efsTags(efsTagMap),
 	}
 
 	result, err := d.efsClient.CreateFileSystem(d.ctx, createInput)
@@ -1215,6 +1429,9 @@ func (d *ECSDeployer) CreateEFS(serviceName string, subnetIds []string, security
 
 	efsId := *result.FileSystemId
 	fmt.Printf("Created EFS file system: %s\n", efsId)
+	d.recordState(func(state *DeploymentState) {
+		state.EFSFileSystemId = efsId
+	})
 
 	// Wait for EFS to be available
 	fmt.Printf("Waiting for EFS file system to be available...\n")
@@ -1240,16 +1457,21 @@ func (d *ECSDeployer) CreateEFS(serviceName string, subnetIds []string, security
 	fmt.Printf("EFS file system %s is now available\n", efsId)
 
 	// Create mount targets in all subnets
-	if err := d.createEFSMountTargets(efsId, subnetIds, securityGroupIds); err != nil {
+	mountTargetIds, err := d.createEFSMountTargets(efsId, subnetIds, securityGroupIds)
+	if err != nil {
 		return "", fmt.Errorf("failed to create EFS mount targets: %w", err)
 	}
+	d.recordState(func(state *DeploymentState) {
+		state.EFSMountTargetIds = mountTargetIds
+	})
 
 	return efsId, nil
 }
 
-func (d *ECSDeployer) createEFSMountTargets(efsId string, subnetIds []string, securityGroupIds []string) error {
+func (d *ECSDeployer) createEFSMountTargets(efsId string, subnetIds []string, securityGroupIds []string) ([]string, error) {
 	fmt.Printf("Creating EFS mount targets for file system: %s\n", efsId)
 
+	var mountTargetIds []string
 	for _, subnetId := range subnetIds {
 		input := &efs.CreateMountTargetInput{
 			FileSystemId:   aws.String(efsId),
@@ -1257,41 +1479,50 @@ func (d *ECSDeployer) createEFSMountTargets(efsId string, subnetIds []string, se
 			SecurityGroups: securityGroupIds,
 		}
 
-		_, err := d.efsClient.CreateMountTarget(d.ctx, input)
+		output, err := d.efsClient.CreateMountTarget(d.ctx, input)
 		if err != nil {
 			fmt.Printf("Warning: Failed to create mount target in subnet %s: %v\n", subnetId, err)
 		} else {
 			fmt.Printf("Created EFS mount target in subnet: %s\n", subnetId)
+			mountTargetIds = append(mountTargetIds, aws.ToString(output.MountTargetId))
 		}
 	}
 
-	return nil
+	return mountTargetIds, nil
 }
 
 func (d *ECSDeployer) deleteSecrets(serviceName string) error {
 	fmt.Printf("Deleting secrets for service: %s\n", serviceName)
 
-	secretNames := []string{
-		fmt.Sprintf("%s-db-password", serviceName),
-		fmt.Sprintf("%s-jwt-secret", serviceName),
-		fmt.Sprintf("%s-session-key", serviceName),
-		fmt.Sprintf("%s-anthropic-key", serviceName),
-		fmt.Sprintf("%s-gmail-user", serviceName),
-		fmt.Sprintf("%s-gmail-pass", serviceName),
+	var secretNames []string
+	for _, spec := range secretSpecs(serviceName) {
+		secretNames = append(secretNames, spec.name)
 	}
 
-	for _, secretName := range secretNames {
+	return d.deleteSecretIds(secretNames)
+}
+
+// deleteSecretIds deletes secrets by name or ARN; ones that do not exist
+// count as deleted.
+func (d *ECSDeployer) deleteSecretIds(secretIds []string) error {
+	var failed []string
+	for _, secretName := range secretIds {
 		_, err := d.secretsClient.DeleteSecret(d.ctx, &secretsmanager.DeleteSecretInput{
 			SecretId:                   aws.String(secretName),
 			ForceDeleteWithoutRecovery: aws.Bool(true), // Immediate deletion without recovery period
 		})
-		if err != nil {
-			fmt.Printf("Warning: Failed to delete secret %s: %v\n", secretName, err)
-		} else {
+		switch {
+		case err == nil:
 			fmt.Printf("Deleted secret: %s\n", secretName)
+		case isAPIError(err, "ResourceNotFoundException"):
+		default:
+			failed = append(failed, fmt.Sprintf("%s: %v", secretName, err))
 		}
 	}
 
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
 	return nil
 }
 
@@ -1302,6 +1533,10 @@ func (d *ECSDeployer) deleteEFS(efsId string, _ []string) error {
 	mountTargetsOutput, err := d.efsClient.DescribeMountTargets(d.ctx, &efs.DescribeMountTargetsInput{
 		FileSystemId: aws.String(efsId),
 	})
+	if isAPIError(err, "FileSystemNotFound") {
+		fmt.Printf("EFS file system %s not found, skipping deletion\n", efsId)
+		return nil
+	}
 	if err != nil {
 		fmt.Printf("Warning: Failed to describe mount targets: %v\n", err)
 	} else {
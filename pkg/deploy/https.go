@@ -0,0 +1,417 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	acmtypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// DefaultSSLPolicy allows TLS 1.2 and 1.3 with forward secrecy only.
+const DefaultSSLPolicy = "ELBSecurityPolicy-TLS13-1-2-2021-06"
+
+// HTTPSConfig configures the HTTPS listener of the load balancer.
+type HTTPSConfig struct {
+	Enabled bool
+	// CertificateArn is used as is; without it a certificate for DomainName
+	// is requested and validated through DNS, in HostedZoneId if set
+	CertificateArn string
+	DomainName     string
+	HostedZoneId   string
+	SSLPolicy      string
+	// RedirectHTTP turns the port 80 listener into a redirect to HTTPS
+	RedirectHTTP bool
+}
+
+// listenerPort is the port of the listener that forwards to the service.
+func listenerPort(config ECSConfig) int32 {
+	if config.HTTPS.Enabled {
+		return 443
+	}
+	return 80
+}
+
+// redirectsHTTP reports whether port 80 redirects to HTTPS. Blue/green and
+// canary deployments only shift the weights of the 443 listener, so port 80
+// always redirects there rather than forwarding to a stale target group.
+func redirectsHTTP(config ECSConfig) bool {
+	switch config.DeploymentStrategy {
+	case DeploymentBlueGreen, DeploymentCanary:
+		return true
+	}
+	return config.HTTPS.RedirectHTTP
+}
+
+// findTrafficListener returns the listener that forwards to the service: the
+// HTTPS listener when HTTPS is enabled, otherwise the HTTP one.
+func (d *ECSDeployer) findTrafficListener(loadBalancerArn string, config ECSConfig) (*elbv2types.Listener, error) {
+	if config.HTTPS.Enabled {
+		return d.findListener(loadBalancerArn, 443, elbv2types.ProtocolEnumHttps)
+	}
+	return d.findListener(loadBalancerArn, 80, elbv2types.ProtocolEnumHttp)
+}
+
+func (d *ECSDeployer) findListener(loadBalancerArn string, port int32, protocol elbv2types.ProtocolEnum) (*elbv2types.Listener, error) {
+	output, err := d.elbv2Client.DescribeListeners(d.ctx, &elasticloadbalancingv2.DescribeListenersInput{
+		LoadBalancerArn: aws.String(loadBalancerArn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe listeners: %w", err)
+	}
+	for i, listener := range output.Listeners {
+		if aws.ToInt32(listener.Port) == port && listener.Protocol == protocol {
+			return &output.Listeners[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// createHTTPSListeners sets up the 443 listener with the certificate and
+// then the port 80 listener, as a redirect or forwarding like before.
+// It returns the ARN of the 443 listener.
+func (d *ECSDeployer) createHTTPSListeners(loadBalancerArn, targetGroupArn string, config ECSConfig) (string, error) {
+	certificateArn, err := d.ensureCertificate(config)
+	if err != nil {
+		return "", err
+	}
+
+	listenerArn, err := d.createHTTPSListener(loadBalancerArn, targetGroupArn, certificateArn, config)
+	if err != nil {
+		return "", err
+	}
+
+	if redirectsHTTP(config) {
+		err = d.redirectHTTPListener(loadBalancerArn, config)
+	} else {
+		_, err = d.createHTTPListener(loadBalancerArn, targetGroupArn, config)
+	}
+	if err != nil {
+		return "", err
+	}
+	return listenerArn, nil
+}
+
+// refreshHTTPSListener updates the certificate and SSL policy of an existing
+// 443 listener and the port 80 redirect without touching where 443 forwards.
+func (d *ECSDeployer) refreshHTTPSListener(loadBalancerArn string, config ECSConfig) error {
+	certificateArn, err := d.ensureCertificate(config)
+	if err != nil {
+		return err
+	}
+	if _, err := d.createHTTPSListener(loadBalancerArn, "", certificateArn, config); err != nil {
+		return err
+	}
+	if redirectsHTTP(config) {
+		return d.redirectHTTPListener(loadBalancerArn, config)
+	}
+	return nil
+}
+
+// createHTTPSListener creates the 443 listener or updates the certificate and
+// SSL policy of an existing one. An empty targetGroupArn keeps the actions of
+// an existing listener, e.g. the weights of a blue/green deployment.
+func (d *ECSDeployer) createHTTPSListener(loadBalancerArn, targetGroupArn, certificateArn string, config ECSConfig) (string, error) {
+	sslPolicy := config.HTTPS.SSLPolicy
+	if sslPolicy == "" {
+		sslPolicy = DefaultSSLPolicy
+	}
+	certificates := []elbv2types.Certificate{{CertificateArn: aws.String(certificateArn)}}
+
+	existing, err := d.findListener(loadBalancerArn, 443, elbv2types.ProtocolEnumHttps)
+	if err == nil && existing != nil {
+		fmt.Printf("HTTPS listener already exists on port 443, updating certificate and SSL policy\n")
+		input := &elasticloadbalancingv2.ModifyListenerInput{
+			ListenerArn:  existing.ListenerArn,
+			Certificates: certificates,
+			SslPolicy:    aws.String(sslPolicy),
+		}
+		if targetGroupArn != "" {
+			input.DefaultActions = []elbv2types.Action{
+				{
+					Type:           elbv2types.ActionTypeEnumForward,
+					TargetGroupArn: aws.String(targetGroupArn),
+				},
+			}
+		}
+		if _, err := d.elbv2Client.ModifyListener(d.ctx, input); err != nil {
+			return "", fmt.Errorf("failed to update HTTPS listener: %w", err)
+		}
+		return aws.ToString(existing.ListenerArn), nil
+	}
+
+	output, err := d.elbv2Client.CreateListener(d.ctx, &elasticloadbalancingv2.CreateListenerInput{
+		LoadBalancerArn: aws.String(loadBalancerArn),
+		Protocol:        elbv2types.ProtocolEnumHttps,
+		Port:            aws.Int32(443),
+		Certificates:    certificates,
+		SslPolicy:       aws.String(sslPolicy),
+		DefaultActions: []elbv2types.Action{
+			{
+				Type:           elbv2types.ActionTypeEnumForward,
+				TargetGroupArn: aws.String(targetGroupArn),
+			},
+		},
+		Tags: elbv2Tags(config.ResourceTags()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTPS listener: %w", err)
+	}
+
+	fmt.Printf("HTTPS listener created with SSL policy %s\n", sslPolicy)
+	if len(output.Listeners) == 0 {
+		return "", nil
+	}
+	return aws.ToString(output.Listeners[0].ListenerArn), nil
+}
+
+// redirectHTTPListener makes the port 80 listener answer with a permanent
+// redirect to HTTPS, creating it if needed.
+func (d *ECSDeployer) redirectHTTPListener(loadBalancerArn string, config ECSConfig) error {
+	redirect := []elbv2types.Action{
+		{
+			Type: elbv2types.ActionTypeEnumRedirect,
+			RedirectConfig: &elbv2types.RedirectActionConfig{
+				Protocol:   aws.String("HTTPS"),
+				Port:       aws.String("443"),
+				Host:       aws.String("#{host}"),
+				Path:       aws.String("/#{path}"),
+				Query:      aws.String("#{query}"),
+				StatusCode: elbv2types.RedirectActionStatusCodeEnumHttp301,
+			},
+		},
+	}
+
+	existing, err := d.findListener(loadBalancerArn, 80, elbv2types.ProtocolEnumHttp)
+	if err == nil && existing != nil {
+		fmt.Printf("Listener already exists on port 80, redirecting it to HTTPS\n")
+		_, err := d.elbv2Client.ModifyListener(d.ctx, &elasticloadbalancingv2.ModifyListenerInput{
+			ListenerArn:    existing.ListenerArn,
+			DefaultActions: redirect,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to redirect HTTP listener: %w", err)
+		}
+		return nil
+	}
+
+	_, err = d.elbv2Client.CreateListener(d.ctx, &elasticloadbalancingv2.CreateListenerInput{
+		LoadBalancerArn: aws.String(loadBalancerArn),
+		Protocol:        elbv2types.ProtocolEnumHttp,
+		Port:            aws.Int32(80),
+		DefaultActions:  redirect,
+		Tags:            elbv2Tags(config.ResourceTags()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP redirect listener: %w", err)
+	}
+	fmt.Printf("HTTP listener created, redirecting to HTTPS\n")
+	return nil
+}
+
+// ensureCertificate returns the configured certificate, or an issued or
+// pending certificate for the domain, requesting and validating a new one if
+// there is none.
+func (d *ECSDeployer) ensureCertificate(config ECSConfig) (string, error) {
+	if config.HTTPS.CertificateArn != "" {
+		return config.HTTPS.CertificateArn, nil
+	}
+	domain := config.HTTPS.DomainName
+	if domain == "" {
+		return "", fmt.Errorf("aws.ecs.https needs certificate_arn or domain_name")
+	}
+
+	certificateArn, status, err := d.findCertificate(domain)
+	if err != nil {
+		return "", err
+	}
+	if certificateArn != "" && status == acmtypes.CertificateStatusIssued {
+		fmt.Printf("Certificate for %s already issued, reusing it\n", domain)
+		return certificateArn, nil
+	}
+
+	if certificateArn == "" {
+		fmt.Printf("Requesting ACM certificate for %s\n", domain)
+		output, err := d.acmClient.RequestCertificate(d.ctx, &acm.RequestCertificateInput{
+			DomainName:       aws.String(domain),
+			ValidationMethod: acmtypes.ValidationMethodDns,
+			Tags:             acmTags(config.ResourceTags()),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to request certificate: %w", err)
+		}
+		certificateArn = aws.ToString(output.CertificateArn)
+		d.recordState(func(state *DeploymentState) {
+			state.CertificateArn = certificateArn
+		})
+	} else {
+		fmt.Printf("Certificate for %s is pending validation\n", domain)
+	}
+
+	if err := d.validateCertificate(config, certificateArn); err != nil {
+		return "", err
+	}
+	return certificateArn, nil
+}
+
+// findCertificate looks for an issued or pending certificate for the domain.
+func (d *ECSDeployer) findCertificate(domain string) (string, acmtypes.CertificateStatus, error) {
+	paginator := acm.NewListCertificatesPaginator(d.acmClient, &acm.ListCertificatesInput{
+		CertificateStatuses: []acmtypes.CertificateStatus{
+			acmtypes.CertificateStatusIssued,
+			acmtypes.CertificateStatusPendingValidation,
+		},
+	})
+
+	var pendingArn string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(d.ctx)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to list certificates: %w", err)
+		}
+		for _, summary := range page.CertificateSummaryList {
+			if !strings.EqualFold(aws.ToString(summary.DomainName), domain) {
+				continue
+			}
+			if summary.Status == acmtypes.CertificateStatusIssued {
+				return aws.ToString(summary.CertificateArn), summary.Status, nil
+			}
+			pendingArn = aws.ToString(summary.CertificateArn)
+		}
+	}
+	if pendingArn != "" {
+		return pendingArn, acmtypes.CertificateStatusPendingValidation, nil
+	}
+	return "", "", nil
+}
+
+// validateCertificate creates the DNS validation record in the hosted zone,
+// or prints it when no zone is configured, and waits for the certificate
+// to be issued.
+func (d *ECSDeployer) validateCertificate(config ECSConfig, certificateArn string) error {
+	// ACM fills in the validation record a few seconds after the request
+	var record *acmtypes.ResourceRecord
+	for attempt := 0; attempt < 12 && record == nil; attempt++ {
+		output, err := d.acmClient.DescribeCertificate(d.ctx, &acm.DescribeCertificateInput{
+			CertificateArn: aws.String(certificateArn),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe certificate: %w", err)
+		}
+		if output.Certificate.Status == acmtypes.CertificateStatusIssued {
+			return nil
+		}
+		for _, option := range output.Certificate.DomainValidationOptions {
+			if option.ResourceRecord != nil {
+				record = option.ResourceRecord
+			}
+		}
+		if record == nil {
+			time.Sleep(5 * time.Second)
+		}
+	}
+	if record == nil {
+		return fmt.Errorf("certificate %s has no DNS validation record yet", certificateArn)
+	}
+
+	if config.HTTPS.HostedZoneId != "" {
+		_, err := d.route53Client.ChangeResourceRecordSets(d.ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(config.HTTPS.HostedZoneId),
+			ChangeBatch: &r53types.ChangeBatch{
+				Comment: aws.String(fmt.Sprintf("ACM validation for %s", config.HTTPS.DomainName)),
+				Changes: []r53types.Change{
+					{
+						Action: r53types.ChangeActionUpsert,
+						ResourceRecordSet: &r53types.ResourceRecordSet{
+							Name:            record.Name,
+							Type:            r53types.RRType(record.Type),
+							TTL:             aws.Int64(300),
+							ResourceRecords: []r53types.ResourceRecord{{Value: record.Value}},
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create DNS validation record: %w", err)
+		}
+		fmt.Printf("Created DNS validation record %s in hosted zone %s\n", aws.ToString(record.Name), config.HTTPS.HostedZoneId)
+	} else {
+		fmt.Printf("Create this DNS record to validate the certificate:\n  %s %s %s\n",
+			aws.ToString(record.Name), record.Type, aws.ToString(record.Value))
+	}
+
+	fmt.Printf("Waiting for certificate %s to be issued...\n", certificateArn)
+	waiter := acm.NewCertificateValidatedWaiter(d.acmClient)
+	err := waiter.Wait(d.ctx, &acm.DescribeCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+	}, 30*time.Minute)
+	if err != nil {
+		return fmt.Errorf("certificate was not validated: %w", err)
+	}
+	fmt.Printf("Certificate issued\n")
+	return nil
+}
+
+// planHTTPS describes the certificate and the port 80 listener of an HTTPS
+// load balancer.
+func (d *ECSDeployer) planHTTPS(plan *Plan, config ECSConfig) {
+	if !config.HTTPS.Enabled {
+		return
+	}
+
+	switch {
+	case config.HTTPS.CertificateArn != "":
+		plan.add("Certificate", config.HTTPS.CertificateArn, PlanNoOp, "configured, used as is")
+	case config.HTTPS.DomainName == "":
+		plan.add("Certificate", "", PlanNoOp, "missing: set certificate_arn or domain_name")
+	default:
+		certificateArn, status, err := d.findCertificate(config.HTTPS.DomainName)
+		validation := "DNS validation record printed for manual creation"
+		if config.HTTPS.HostedZoneId != "" {
+			validation = fmt.Sprintf("DNS validation record created in %s", config.HTTPS.HostedZoneId)
+		}
+		if err == nil && status == acmtypes.CertificateStatusIssued {
+			plan.add("Certificate", config.HTTPS.DomainName, PlanNoOp, fmt.Sprintf("issued, reused (%s)", certificateArn))
+		} else if err == nil && certificateArn != "" {
+			plan.add("Certificate", config.HTTPS.DomainName, PlanUpdate, "pending validation; "+validation)
+		} else {
+			plan.add("Certificate", config.HTTPS.DomainName, PlanCreate, "requested from ACM; "+validation)
+		}
+	}
+
+	if redirectsHTTP(config) {
+		plan.add("Listener", fmt.Sprintf("%s-alb:80", config.ServiceName), PlanUpdate, "301 redirect to HTTPS, created if missing")
+	} else {
+		plan.add("Listener", fmt.Sprintf("%s-alb:80", config.ServiceName), PlanUpdate, "forward to the target group alongside HTTPS")
+	}
+}
+
+// deleteCertificates deletes the certificates; ones that do not exist count
+// as deleted.
+func (d *ECSDeployer) deleteCertificates(certificateArns []string) error {
+	var failed []string
+	for _, arn := range certificateArns {
+		_, err := d.acmClient.DeleteCertificate(d.ctx, &acm.DeleteCertificateInput{
+			CertificateArn: aws.String(arn),
+		})
+		switch {
+		case err == nil:
+			fmt.Printf("Certificate %s deleted\n", arn)
+		case isAPIError(err, "ResourceNotFoundException"):
+		default:
+			failed = append(failed, fmt.Sprintf("%s: %v", arn, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
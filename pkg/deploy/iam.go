@@ -0,0 +1,403 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const (
+	// LegacyExecutionRoleName is the shared role deployments used before
+	// roles were managed per service
+	LegacyExecutionRoleName = "ecsTaskExecutionRole"
+
+	executionRolePolicyArn = "arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"
+	secretsPolicyName      = "read-service-secrets"
+	ecsTasksPrincipal      = "ecs-tasks.amazonaws.com"
+)
+
+// IAMConfig configures the task execution role, which ECS uses to pull images,
+// write logs and read secrets, and the task role the application runs as.
+type IAMConfig struct {
+	CreateRoles            bool
+	ExecutionRoleName      string
+	TaskRoleName           string
+	TaskRolePolicyArns     []string
+	TaskRoleInlinePolicies map[string]string // policy name -> JSON document
+}
+
+// ExecutionRoleName returns the configured execution role, <service>-execution-role
+// for managed roles or the shared ecsTaskExecutionRole otherwise.
+func ExecutionRoleName(config ECSConfig) string {
+	switch {
+	case config.IAM.ExecutionRoleName != "":
+		return config.IAM.ExecutionRoleName
+	case config.IAM.CreateRoles:
+		return fmt.Sprintf("%s-execution-role", config.ServiceName)
+	default:
+		return LegacyExecutionRoleName
+	}
+}
+
+// TaskRoleName returns the configured task role, <service>-task-role for
+// managed roles, or "" when the tasks run without a role.
+func TaskRoleName(config ECSConfig) string {
+	if config.IAM.TaskRoleName == "" && config.IAM.CreateRoles {
+		return fmt.Sprintf("%s-task-role", config.ServiceName)
+	}
+	return config.IAM.TaskRoleName
+}
+
+type policyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []policyStatement `json:"Statement"`
+}
+
+type policyStatement struct {
+	Effect    string            `json:"Effect"`
+	Principal map[string]string `json:"Principal,omitempty"`
+	Action    []string          `json:"Action"`
+	Resource  []string          `json:"Resource,omitempty"`
+}
+
+func (p policyDocument) String() string {
+	document, _ := json.Marshal(p)
+	return string(document)
+}
+
+// ecsTasksTrustPolicy lets ECS tasks assume a role.
+func ecsTasksTrustPolicy() string {
+	return policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{{
+			Effect:    "Allow",
+			Principal: map[string]string{"Service": ecsTasksPrincipal},
+			Action:    []string{"sts:AssumeRole"},
+		}},
+	}.String()
+}
+
+// secretsPolicy grants read access to exactly the given secrets.
+func secretsPolicy(resources []string) string {
+	return policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{{
+			Effect:   "Allow",
+			Action:   []string{"secretsmanager:GetSecretValue"},
+			Resource: resources,
+		}},
+	}.String()
+}
+
+// getAccountId returns the account of the deployer's credentials.
+func (d *ECSDeployer) getAccountId() (string, error) {
+	if d.accountId != "" {
+		return d.accountId, nil
+	}
+	output, err := d.stsClient.GetCallerIdentity(d.ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get AWS account ID: %w", err)
+	}
+	d.accountId = aws.ToString(output.Account)
+	return d.accountId, nil
+}
+
+func (d *ECSDeployer) roleArn(roleName string) (string, error) {
+	accountId, err := d.getAccountId()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", accountId, roleName), nil
+}
+
+// ensureRoles creates or verifies the execution and task roles and sets their
+// ARNs on the config for the task definition. The execution role may read
+// the secrets the containers reference.
+func (d *ECSDeployer) ensureRoles(config ECSConfig, secretArns map[string]string) (ECSConfig, error) {
+	executionPolicies := map[string]string{}
+	if secrets := taskSecretArns(config, secretArns); len(secrets) > 0 {
+		executionPolicies[secretsPolicyName] = secretsPolicy(secrets)
+	}
+	arn, err := d.ensureRole(config, ExecutionRoleName(config), "ECS task execution role", []string{executionRolePolicyArn}, executionPolicies)
+	if err != nil {
+		return config, err
+	}
+	config.ExecutionRoleArn = arn
+
+	if name := TaskRoleName(config); name != "" {
+		arn, err := d.ensureRole(config, name, "Application task role", config.IAM.TaskRolePolicyArns, config.IAM.TaskRoleInlinePolicies)
+		if err != nil {
+			return config, err
+		}
+		config.TaskRoleArn = arn
+	}
+	return config, nil
+}
+
+// ensureRole creates a missing role when roles are managed and brings the
+// policies of roles this service owns in line with the config. Other roles
+// are only checked to exist and to trust ECS tasks.
+func (d *ECSDeployer) ensureRole(config ECSConfig, roleName, description string, policyArns []string, inlinePolicies map[string]string) (string, error) {
+	role, err := d.getRole(roleName)
+	if err != nil {
+		return "", err
+	}
+
+	created := false
+	if role == nil {
+		if !config.IAM.CreateRoles {
+			return "", fmt.Errorf("IAM role %s does not exist; create it or enable aws.ecs.iam.create_roles", roleName)
+		}
+		fmt.Printf("Creating IAM role: %s\n", roleName)
+		output, err := d.iamClient.CreateRole(d.ctx, &iam.CreateRoleInput{
+			RoleName:                 aws.String(roleName),
+			AssumeRolePolicyDocument: aws.String(ecsTasksTrustPolicy()),
+			Description:              aws.String(fmt.Sprintf("%s of %s", description, config.ServiceName)),
+			Tags:                     iamTags(config.ResourceTags()),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to create IAM role %s: %w", roleName, err)
+		}
+		role, created = output.Role, true
+		d.recordState(func(state *DeploymentState) {
+			state.IAMRoles = appendUnique(state.IAMRoles, roleName)
+		})
+
+		waiter := iam.NewRoleExistsWaiter(d.iamClient)
+		if err := waiter.Wait(d.ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)}, time.Minute); err != nil {
+			return "", fmt.Errorf("failed to wait for IAM role %s: %w", roleName, err)
+		}
+	} else if !trustsECSTasks(aws.ToString(role.AssumeRolePolicyDocument)) {
+		return "", fmt.Errorf("IAM role %s cannot be assumed by ECS tasks: its trust policy does not allow %s", roleName, ecsTasksPrincipal)
+	}
+
+	if !created && !ownsRole(role, config) {
+		fmt.Printf("Using existing IAM role %s (not managed by this service, policies left unchanged)\n", roleName)
+		return aws.ToString(role.Arn), nil
+	}
+	if err := d.syncRolePolicies(roleName, policyArns, inlinePolicies); err != nil {
+		return "", err
+	}
+	fmt.Printf("IAM role %s is ready\n", roleName)
+	return aws.ToString(role.Arn), nil
+}
+
+// getRole returns nil without an error when the role does not exist.
+func (d *ECSDeployer) getRole(roleName string) (*iamtypes.Role, error) {
+	output, err := d.iamClient.GetRole(d.ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if isAPIError(err, "NoSuchEntity") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get IAM role %s: %w", roleName, err)
+	}
+	return output.Role, nil
+}
+
+// syncRolePolicies attaches the managed policies and puts the inline policies
+// of a role, removing the ones no longer configured.
+func (d *ECSDeployer) syncRolePolicies(roleName string, policyArns []string, inlinePolicies map[string]string) error {
+	attached, err := d.iamClient.ListAttachedRolePolicies(d.ctx, &iam.ListAttachedRolePoliciesInput{
+		RoleName: aws.String(roleName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list policies of IAM role %s: %w", roleName, err)
+	}
+	current := map[string]bool{}
+	for _, policy := range attached.AttachedPolicies {
+		current[aws.ToString(policy.PolicyArn)] = true
+	}
+	wanted := map[string]bool{}
+	for _, policyArn := range policyArns {
+		wanted[policyArn] = true
+		if current[policyArn] {
+			continue
+		}
+		if _, err := d.iamClient.AttachRolePolicy(d.ctx, &iam.AttachRolePolicyInput{
+			RoleName:  aws.String(roleName),
+			PolicyArn: aws.String(policyArn),
+		}); err != nil {
+			return fmt.Errorf("failed to attach %s to IAM role %s: %w", policyArn, roleName, err)
+		}
+		fmt.Printf("Attached %s to IAM role %s\n", policyArn, roleName)
+	}
+	for policyArn := range current {
+		if wanted[policyArn] {
+			continue
+		}
+		if _, err := d.iamClient.DetachRolePolicy(d.ctx, &iam.DetachRolePolicyInput{
+			RoleName:  aws.String(roleName),
+			PolicyArn: aws.String(policyArn),
+		}); err != nil {
+			return fmt.Errorf("failed to detach %s from IAM role %s: %w", policyArn, roleName, err)
+		}
+		fmt.Printf("Detached %s from IAM role %s\n", policyArn, roleName)
+	}
+
+	names, err := d.iamClient.ListRolePolicies(d.ctx, &iam.ListRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return fmt.Errorf("failed to list inline policies of IAM role %s: %w", roleName, err)
+	}
+	for _, name := range sortedTagKeys(inlinePolicies) {
+		if !json.Valid([]byte(inlinePolicies[name])) {
+			return fmt.Errorf("inline policy %s of IAM role %s is not valid JSON", name, roleName)
+		}
+		existing, err := d.iamClient.GetRolePolicy(d.ctx, &iam.GetRolePolicyInput{
+			RoleName:   aws.String(roleName),
+			PolicyName: aws.String(name),
+		})
+		if err == nil && samePolicy(aws.ToString(existing.PolicyDocument), inlinePolicies[name]) {
+			continue
+		}
+		if _, err := d.iamClient.PutRolePolicy(d.ctx, &iam.PutRolePolicyInput{
+			RoleName:       aws.String(roleName),
+			PolicyName:     aws.String(name),
+			PolicyDocument: aws.String(inlinePolicies[name]),
+		}); err != nil {
+			return fmt.Errorf("failed to put inline policy %s on IAM role %s: %w", name, roleName, err)
+		}
+		fmt.Printf("Updated inline policy %s of IAM role %s\n", name, roleName)
+	}
+	for _, name := range names.PolicyNames {
+		if _, ok := inlinePolicies[name]; ok {
+			continue
+		}
+		if _, err := d.iamClient.DeleteRolePolicy(d.ctx, &iam.DeleteRolePolicyInput{
+			RoleName:   aws.String(roleName),
+			PolicyName: aws.String(name),
+		}); err != nil {
+			return fmt.Errorf("failed to delete inline policy %s of IAM role %s: %w", name, roleName, err)
+		}
+		fmt.Printf("Deleted inline policy %s of IAM role %s\n", name, roleName)
+	}
+	return nil
+}
+
+// deleteRoles deletes the roles this service owns, with their policies. Roles
+// without the service's tags are left alone.
+func (d *ECSDeployer) deleteRoles(config ECSConfig, roleNames []string) error {
+	var failed []string
+	for _, roleName := range roleNames {
+		role, err := d.getRole(roleName)
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		if role == nil {
+			continue
+		}
+		if !ownsRole(role, config) {
+			fmt.Printf("IAM role %s is not managed by this service, not deleting it\n", roleName)
+			continue
+		}
+		if err := d.syncRolePolicies(roleName, nil, nil); err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		if _, err := d.iamClient.DeleteRole(d.ctx, &iam.DeleteRoleInput{RoleName: aws.String(roleName)}); err != nil {
+			failed = append(failed, fmt.Sprintf("failed to delete IAM role %s: %v", roleName, err))
+			continue
+		}
+		fmt.Printf("IAM role %s deleted\n", roleName)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// planRoles describes the execution and task roles and sets their (expected)
+// ARNs on the config so the planned task definition references them.
+func (d *ECSDeployer) planRoles(plan *Plan, config ECSConfig, secretArns map[string]string) (ECSConfig, error) {
+	executionDetails := "AmazonECSTaskExecutionRolePolicy"
+	if secrets := taskSecretArns(config, secretArns); len(secrets) > 0 {
+		executionDetails += fmt.Sprintf(", read access to %d secrets", len(secrets))
+	}
+	arn, err := d.planRole(plan, config, ExecutionRoleName(config), executionDetails)
+	if err != nil {
+		return config, err
+	}
+	config.ExecutionRoleArn = arn
+
+	if name := TaskRoleName(config); name != "" {
+		details := fmt.Sprintf("%d managed and %d inline policies", len(config.IAM.TaskRolePolicyArns), len(config.IAM.TaskRoleInlinePolicies))
+		arn, err := d.planRole(plan, config, name, details)
+		if err != nil {
+			return config, err
+		}
+		config.TaskRoleArn = arn
+	}
+	return config, nil
+}
+
+func (d *ECSDeployer) planRole(plan *Plan, config ECSConfig, roleName, details string) (string, error) {
+	role, err := d.getRole(roleName)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case role == nil && config.IAM.CreateRoles:
+		plan.add("IAM Role", roleName, PlanCreate, details)
+		return d.roleArn(roleName)
+	case role == nil:
+		plan.add("IAM Role", roleName, PlanConflict, "does not exist and aws.ecs.iam.create_roles is off")
+		return d.roleArn(roleName)
+	case !trustsECSTasks(aws.ToString(role.AssumeRolePolicyDocument)):
+		plan.add("IAM Role", roleName, PlanConflict, "trust policy does not allow ECS tasks")
+	case ownsRole(role, config):
+		plan.add("IAM Role", roleName, PlanUpdate, "policies synced: "+details)
+	default:
+		plan.add("IAM Role", roleName, PlanNoOp, "existing role, not managed by this service")
+	}
+	return aws.ToString(role.Arn), nil
+}
+
+// ownsRole reports whether the role carries the ownership tags of the service.
+func ownsRole(role *iamtypes.Role, config ECSConfig) bool {
+	tags := map[string]string{}
+	for _, tag := range role.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for key, value := range config.ownershipTags() {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// trustsECSTasks checks the URL-encoded trust policy IAM returns.
+func trustsECSTasks(document string) bool {
+	if decoded, err := url.QueryUnescape(document); err == nil {
+		document = decoded
+	}
+	return strings.Contains(document, ecsTasksPrincipal)
+}
+
+// samePolicy compares the URL-encoded document IAM returns with a configured one.
+func samePolicy(current, wanted string) bool {
+	if decoded, err := url.QueryUnescape(current); err == nil {
+		current = decoded
+	}
+	var a, b interface{}
+	if json.Unmarshal([]byte(current), &a) != nil || json.Unmarshal([]byte(wanted), &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// optionalString leaves optional API fields unset for empty values.
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
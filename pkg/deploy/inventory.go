@@ -0,0 +1,180 @@
+package deploy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	taggingtypes "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+)
+
+// ManagedResource is a resource found through its opsagents tags.
+type ManagedResource struct {
+	ARN  string            `json:"arn"`
+	Type string            `json:"type"`
+	Tags map[string]string `json:"tags"`
+}
+
+// Inventory lists the resources tagged for the configured service and
+// environment, or every resource managed by opsagents when all is set.
+func (d *ECSDeployer) Inventory(config ECSConfig, all bool) ([]ManagedResource, error) {
+	filterTags := config.ownershipTags()
+	if all {
+		filterTags = map[string]string{TagManagedBy: ManagedByValue}
+	}
+
+	var filters []taggingtypes.TagFilter
+	for _, key := range sortedTagKeys(filterTags) {
+		filters = append(filters, taggingtypes.TagFilter{
+			Key:    aws.String(key),
+			Values: []string{filterTags[key]},
+		})
+	}
+
+	var resources []ManagedResource
+	paginator := resourcegroupstaggingapi.NewGetResourcesPaginator(d.taggingClient, &resourcegroupstaggingapi.GetResourcesInput{
+		TagFilters: filters,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(d.ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tagged resources: %w", err)
+		}
+		for _, mapping := range page.ResourceTagMappingList {
+			arn := aws.ToString(mapping.ResourceARN)
+			tags := make(map[string]string, len(mapping.Tags))
+			for _, tag := range mapping.Tags {
+				tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			resources = append(resources, ManagedResource{ARN: arn, Type: resourceType(arn), Tags: tags})
+		}
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Type != resources[j].Type {
+			return resources[i].Type < resources[j].Type
+		}
+		return resources[i].ARN < resources[j].ARN
+	})
+	return resources, nil
+}
+
+// resourceType returns "service:type" for an ARN, e.g. ecs:service or
+// elasticloadbalancing:loadbalancer.
+func resourceType(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return "unknown"
+	}
+	resource := parts[5]
+	if i := strings.IndexAny(resource, "/:"); i >= 0 {
+		resource = resource[:i]
+	}
+	return parts[2] + ":" + resource
+}
+
+// InventorySummary renders the resources grouped by service and environment.
+func InventorySummary(resources []ManagedResource) string {
+	if len(resources) == 0 {
+		return "No resources tagged managed-by=opsagents were found\n"
+	}
+
+	groups := map[string][]ManagedResource{}
+	for _, resource := range resources {
+		group := fmt.Sprintf("%s (%s)", resource.Tags[TagService], resource.Tags[TagEnvironment])
+		groups[group] = append(groups[group], resource)
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d managed resources:\n", len(resources))
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n%s\n", name)
+		for _, resource := range groups[name] {
+			fmt.Fprintf(&b, "  - %s: %s", resource.Type, resource.ARN)
+			if id := resource.Tags[TagDeploymentId]; id != "" {
+				fmt.Fprintf(&b, " (deployment %s)", id)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// ownedResources are the resources Cleanup deletes, merged from the
+// deployment state and the tagged inventory.
+type ownedResources struct {
+	loadBalancers  []string
+	targetGroups   []string
+	logGroups      []string
+	secrets        []string
+	fileSystems    []string
+	certificates   []string
+	securityGroups []string
+}
+
+func collectOwnedResources(state *DeploymentState, inventory []ManagedResource) ownedResources {
+	var owned ownedResources
+	if state.LoadBalancerArn != "" {
+		owned.loadBalancers = appendUnique(owned.loadBalancers, state.LoadBalancerArn)
+	}
+	if state.TargetGroupArn != "" {
+		owned.targetGroups = appendUnique(owned.targetGroups, state.TargetGroupArn)
+	}
+	if state.AlternateTargetGroupArn != "" {
+		owned.targetGroups = appendUnique(owned.targetGroups, state.AlternateTargetGroupArn)
+	}
+	for _, logGroup := range state.LogGroups {
+		owned.logGroups = appendUnique(owned.logGroups, logGroup)
+	}
+	for _, arn := range state.SecretArns() {
+		owned.secrets = appendUnique(owned.secrets, arn)
+	}
+	if state.EFSFileSystemId != "" {
+		owned.fileSystems = appendUnique(owned.fileSystems, state.EFSFileSystemId)
+	}
+	if state.CertificateArn != "" {
+		owned.certificates = appendUnique(owned.certificates, state.CertificateArn)
+	}
+	for _, groupId := range state.SecurityGroupIds {
+		owned.securityGroups = appendUnique(owned.securityGroups, groupId)
+	}
+
+	for _, resource := range inventory {
+		switch resource.Type {
+		case "elasticloadbalancing:loadbalancer":
+			owned.loadBalancers = appendUnique(owned.loadBalancers, resource.ARN)
+		case "elasticloadbalancing:targetgroup":
+			owned.targetGroups = appendUnique(owned.targetGroups, resource.ARN)
+		case "logs:log-group":
+			// arn:aws:logs:region:account:log-group:NAME[:*]
+			name := resource.ARN[strings.Index(resource.ARN, "log-group:")+len("log-group:"):]
+			owned.logGroups = appendUnique(owned.logGroups, strings.TrimSuffix(name, ":*"))
+		case "secretsmanager:secret":
+			owned.secrets = appendUnique(owned.secrets, resource.ARN)
+		case "elasticfilesystem:file-system":
+			owned.fileSystems = appendUnique(owned.fileSystems, resource.ARN[strings.LastIndex(resource.ARN, "/")+1:])
+		case "acm:certificate":
+			owned.certificates = appendUnique(owned.certificates, resource.ARN)
+		case "ec2:security-group":
+			owned.securityGroups = appendUnique(owned.securityGroups, resource.ARN[strings.LastIndex(resource.ARN, "/")+1:])
+		}
+	}
+	return owned
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,52 @@
+package deploy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollectOwnedResources(t *testing.T) {
+	state := newDeploymentState("api", "staging")
+	state.LoadBalancerArn = "arn:aws:elasticloadbalancing:eu-west-1:123456789012:loadbalancer/app/api-alb/1"
+	state.TargetGroupArn = "arn:aws:elasticloadbalancing:eu-west-1:123456789012:targetgroup/api-tg/1"
+	state.AlternateTargetGroupArn = "arn:aws:elasticloadbalancing:eu-west-1:123456789012:targetgroup/api-tg-green/2"
+	state.LogGroups = []string{"/ecs/api"}
+	state.Secrets = map[string]string{"JWT_SECRET_ARN": "arn:jwt", "DB_SECRET_ARN": "arn:db"}
+	state.EFSFileSystemId = "fs-1"
+	state.SecurityGroupIds = []string{"sg-1"}
+
+	inventory := []ManagedResource{
+		// Already recorded in the state
+		{Type: "elasticloadbalancing:loadbalancer", ARN: state.LoadBalancerArn},
+		{Type: "elasticloadbalancing:targetgroup", ARN: state.TargetGroupArn},
+		{Type: "logs:log-group", ARN: "arn:aws:logs:eu-west-1:123456789012:log-group:/ecs/api:*"},
+		{Type: "secretsmanager:secret", ARN: "arn:db"},
+		{Type: "elasticfilesystem:file-system", ARN: "arn:aws:elasticfilesystem:eu-west-1:123456789012:file-system/fs-1"},
+		// Only found through the tags
+		{Type: "logs:log-group", ARN: "arn:aws:logs:eu-west-1:123456789012:log-group:/ecs/api-database"},
+		{Type: "acm:certificate", ARN: "arn:aws:acm:eu-west-1:123456789012:certificate/abc"},
+		{Type: "ec2:security-group", ARN: "arn:aws:ec2:eu-west-1:123456789012:security-group/sg-2"},
+		// Not deleted by Cleanup
+		{Type: "ecs:service", ARN: "arn:aws:ecs:eu-west-1:123456789012:service/cluster/api"},
+	}
+
+	want := ownedResources{
+		loadBalancers:  []string{state.LoadBalancerArn},
+		targetGroups:   []string{state.TargetGroupArn, state.AlternateTargetGroupArn},
+		logGroups:      []string{"/ecs/api", "/ecs/api-database"},
+		secrets:        []string{"arn:db", "arn:jwt"},
+		fileSystems:    []string{"fs-1"},
+		certificates:   []string{"arn:aws:acm:eu-west-1:123456789012:certificate/abc"},
+		securityGroups: []string{"sg-1", "sg-2"},
+	}
+	if got := collectOwnedResources(state, inventory); !reflect.DeepEqual(got, want) {
+		t.Errorf("collectOwnedResources() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCollectOwnedResourcesEmpty(t *testing.T) {
+	got := collectOwnedResources(newDeploymentState("api", "staging"), nil)
+	if !reflect.DeepEqual(got, ownedResources{}) {
+		t.Errorf("collectOwnedResources() = %+v, want nothing", got)
+	}
+}
@@ -0,0 +1,194 @@
+package deploy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// subnetRoute is what the route table of a subnet says about its internet
+// access: public subnets route 0.0.0.0/0 to an internet gateway, private
+// subnets with egress route it to a NAT gateway or similar.
+type subnetRoute struct {
+	id               string
+	availabilityZone string
+	public           bool
+	egress           bool
+}
+
+func (r subnetRoute) label() string {
+	switch {
+	case r.public:
+		return "public"
+	case r.egress:
+		return "private with NAT"
+	default:
+		return "private without internet access"
+	}
+}
+
+// describeSubnetRoutes classifies the subnets of the VPC by their route
+// tables. Subnets without an explicit association use the main route table.
+func (d *ECSDeployer) describeSubnetRoutes(vpcId string) (map[string]subnetRoute, error) {
+	vpcFilter := []ec2types.Filter{{Name: aws.String("vpc-id"), Values: []string{vpcId}}}
+
+	subnets, err := d.ec2Client.DescribeSubnets(d.ctx, &ec2.DescribeSubnetsInput{Filters: vpcFilter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe subnets: %w", err)
+	}
+	tables, err := d.ec2Client.DescribeRouteTables(d.ctx, &ec2.DescribeRouteTablesInput{Filters: vpcFilter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe route tables: %w", err)
+	}
+
+	var main *ec2types.RouteTable
+	associated := map[string]*ec2types.RouteTable{}
+	for i, table := range tables.RouteTables {
+		for _, association := range table.Associations {
+			if aws.ToBool(association.Main) {
+				main = &tables.RouteTables[i]
+			}
+			if association.SubnetId != nil {
+				associated[aws.ToString(association.SubnetId)] = &tables.RouteTables[i]
+			}
+		}
+	}
+
+	routes := map[string]subnetRoute{}
+	for _, subnet := range subnets.Subnets {
+		route := subnetRoute{
+			id:               aws.ToString(subnet.SubnetId),
+			availabilityZone: aws.ToString(subnet.AvailabilityZone),
+		}
+		table := associated[route.id]
+		if table == nil {
+			table = main
+		}
+		if table != nil {
+			route.public, route.egress = defaultRoute(table.Routes)
+		}
+		routes[route.id] = route
+	}
+	return routes, nil
+}
+
+// defaultRoute reports where the active 0.0.0.0/0 route of a table goes.
+func defaultRoute(routes []ec2types.Route) (public, egress bool) {
+	for _, route := range routes {
+		if aws.ToString(route.DestinationCidrBlock) != "0.0.0.0/0" || route.State != ec2types.RouteStateActive {
+			continue
+		}
+		if strings.HasPrefix(aws.ToString(route.GatewayId), "igw-") {
+			return true, false
+		}
+		if route.NatGatewayId != nil || route.TransitGatewayId != nil || route.InstanceId != nil || route.NetworkInterfaceId != nil {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// subnetsPerZone picks one subnet per availability zone, as load balancers
+// and EFS mount targets only take one subnet per zone.
+func subnetsPerZone(routes map[string]subnetRoute, match func(subnetRoute) bool) []string {
+	var candidates []subnetRoute
+	for _, route := range routes {
+		if match(route) {
+			candidates = append(candidates, route)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].availabilityZone != candidates[j].availabilityZone {
+			return candidates[i].availabilityZone < candidates[j].availabilityZone
+		}
+		return candidates[i].id < candidates[j].id
+	})
+
+	var ids []string
+	zones := map[string]bool{}
+	for _, route := range candidates {
+		if !zones[route.availabilityZone] {
+			zones[route.availabilityZone] = true
+			ids = append(ids, route.id)
+		}
+	}
+	return ids
+}
+
+// validateSubnets checks that the load balancer subnets are public and that
+// tasks can reach the internet to pull their images: through a NAT route, or
+// through an internet gateway with a public IP.
+func validateSubnets(config ECSConfig, routes map[string]subnetRoute) error {
+	var problems []string
+	for _, id := range config.LoadBalancerSubnetIds {
+		route, ok := routes[id]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("load balancer subnet %s is not in %s", id, config.VpcId))
+		} else if !route.public {
+			problems = append(problems, fmt.Sprintf("load balancer subnet %s is %s; an internet-facing load balancer needs public subnets", id, route.label()))
+		}
+	}
+	for _, id := range config.TaskSubnetIds {
+		route, ok := routes[id]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("task subnet %s is not in %s", id, config.VpcId))
+		case route.egress:
+		case route.public && !config.AssignPublicIp:
+			problems = append(problems, fmt.Sprintf("task subnet %s is public but assign_public_ip is off, so tasks cannot pull images; use private subnets with a NAT gateway", id))
+		case !route.public:
+			problems = append(problems, fmt.Sprintf("task subnet %s has no NAT or internet gateway route, so tasks cannot pull images", id))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid subnets:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// assignPublicIp is the public IP setting of the service's tasks.
+func assignPublicIp(config ECSConfig) types.AssignPublicIp {
+	if config.AssignPublicIp {
+		return types.AssignPublicIpEnabled
+	}
+	return types.AssignPublicIpDisabled
+}
+
+// taskNetworkConfiguration places tasks in the task subnets with the task
+// security groups.
+func taskNetworkConfiguration(config ECSConfig) *types.NetworkConfiguration {
+	return &types.NetworkConfiguration{
+		AwsvpcConfiguration: &types.AwsVpcConfiguration{
+			Subnets:        config.TaskSubnetIds,
+			SecurityGroups: config.TaskSecurityGroupIds,
+			AssignPublicIp: assignPublicIp(config),
+		},
+	}
+}
+
+// taskNetworkLabel describes where tasks run for plans.
+func taskNetworkLabel(config ECSConfig) string {
+	publicIp := "without public IPs"
+	if config.AssignPublicIp {
+		publicIp = "with public IPs"
+	}
+	return fmt.Sprintf("subnets %s %s", strings.Join(config.TaskSubnetIds, ", "), publicIp)
+}
+
+// subnetLabel lists subnets with their classification for progress output.
+func subnetLabel(ids []string, routes map[string]subnetRoute) string {
+	labels := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if route, ok := routes[id]; ok {
+			labels = append(labels, fmt.Sprintf("%s (%s, %s)", id, route.availabilityZone, route.label()))
+		} else {
+			labels = append(labels, id)
+		}
+	}
+	return strings.Join(labels, ", ")
+}
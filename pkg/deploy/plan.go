@@ -0,0 +1,520 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+type PlanAction string
+
+const (
+	PlanCreate PlanAction = "create"
+	PlanUpdate PlanAction = "update"
+	PlanNoOp   PlanAction = "no-op"
+	// PlanConflict marks a resource that already exists where the deployment
+	// would try to create it, so applying the plan would fail
+	PlanConflict PlanAction = "conflict"
+)
+
+// PlanChange is the planned action for a single resource.
+type PlanChange struct {
+	Resource string     `json:"resource"`
+	Name     string     `json:"name"`
+	Action   PlanAction `json:"action"`
+	Details  string     `json:"details,omitempty"`
+}
+
+// Plan describes what a deployment would change without changing anything.
+type Plan struct {
+	ServiceName string       `json:"service_name"`
+	Changes     []PlanChange `json:"changes"`
+	// TaskDefinition is the RegisterTaskDefinition input that would be sent
+	TaskDefinition *ecs.RegisterTaskDefinitionInput `json:"task_definition"`
+}
+
+func (p *Plan) add(resource, name string, action PlanAction, details string) {
+	p.Changes = append(p.Changes, PlanChange{Resource: resource, Name: name, Action: action, Details: details})
+}
+
+// HasChanges reports whether applying the plan would change anything.
+func (p *Plan) HasChanges() bool {
+	for _, change := range p.Changes {
+		if change.Action != PlanNoOp {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON renders the plan, including the task definition, as indented JSON.
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// String renders the plan as a human readable diff.
+func (p *Plan) String() string {
+	symbols := map[PlanAction]string{
+		PlanCreate:   "+",
+		PlanUpdate:   "~",
+		PlanNoOp:     "=",
+		PlanConflict: "!",
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Deployment plan for service %s:\n", p.ServiceName)
+	counts := map[PlanAction]int{}
+	for _, change := range p.Changes {
+		counts[change.Action]++
+		fmt.Fprintf(&b, "  %s %-8s %s: %s", symbols[change.Action], change.Action, change.Resource, change.Name)
+		if change.Details != "" {
+			fmt.Fprintf(&b, " (%s)", change.Details)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n%d to create, %d to update, %d unchanged", counts[PlanCreate], counts[PlanUpdate], counts[PlanNoOp])
+	if counts[PlanConflict] > 0 {
+		fmt.Fprintf(&b, ", %d conflicts", counts[PlanConflict])
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Plan walks the same steps as a deployment (cluster, DeployAdvanced and
+// CreateService) but only describes existing resources. Progress messages go
+// to progress instead of stdout.
+func (d *ECSDeployer) Plan(config ECSConfig, progress io.Writer) (*Plan, error) {
+	plan := &Plan{ServiceName: config.ServiceName}
+
+	if err := d.beginState(config); err != nil {
+		return nil, err
+	}
+
+	d.planCluster(plan, config)
+
+	// Subnets are classified and validated up front, like resolveNetworking does
+	config, err := d.autoDiscoverNetworking(config, progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to auto-discover VPC config: %w", err)
+	}
+	d.planSecurityGroups(plan, config)
+
+	for _, logGroup := range containerLogGroups(config) {
+		d.planLogGroup(plan, logGroup)
+	}
+
+	var secretArns map[string]string
+	if config.CreateSecrets {
+		secretArns = d.planSecrets(plan, config)
+	}
+
+	if config.CreateEFS {
+		config.EFSVolumeId = d.planEFS(plan, config)
+	}
+
+	config, err = d.planRoles(plan, config, secretArns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mirror DeployAdvanced: generated secrets are only referenced with create_secrets
+	plan.TaskDefinition, err = d.taskDefinitionInput(config, secretArns)
+	if err != nil {
+		return nil, err
+	}
+	d.planTaskDefinition(plan, plan.TaskDefinition)
+
+	if err := d.planService(plan, config); err != nil {
+		return nil, err
+	}
+
+	d.planScaling(plan, config)
+
+	return plan, nil
+}
+
+func (d *ECSDeployer) planScaling(plan *Plan, config ECSConfig) {
+	_, _, registered, err := d.scalableTarget(config)
+	if err != nil {
+		return
+	}
+	name := scalingResourceId(config)
+	if err := validateScaling(config); err != nil {
+		plan.add("Auto Scaling", name, PlanConflict, err.Error())
+		return
+	}
+	switch {
+	case config.Scaling.Enabled && registered:
+		plan.add("Auto Scaling", name, PlanUpdate, scalingLabel(config))
+	case config.Scaling.Enabled:
+		plan.add("Auto Scaling", name, PlanCreate, scalingLabel(config))
+	case registered:
+		plan.add("Auto Scaling", name, PlanUpdate, "removed, scaling is disabled in the config")
+	}
+}
+
+func (d *ECSDeployer) planCluster(plan *Plan, config ECSConfig) {
+	output, err := d.ecsClient.DescribeClusters(d.ctx, &ecs.DescribeClustersInput{
+		Clusters: []string{config.ClusterName},
+	})
+	if err := validateCapacityProviders(config); err != nil {
+		plan.add("ECS Cluster", config.ClusterName, PlanConflict, err.Error())
+		return
+	}
+	if err == nil && len(output.Clusters) > 0 && aws.ToString(output.Clusters[0].Status) == "ACTIVE" {
+		var missing []string
+		for _, provider := range config.CapacityProviders {
+			registered := false
+			for _, existing := range output.Clusters[0].CapacityProviders {
+				registered = registered || existing == provider.Provider
+			}
+			if !registered {
+				missing = append(missing, provider.Provider)
+			}
+		}
+		if len(missing) > 0 {
+			plan.add("ECS Cluster", config.ClusterName, PlanUpdate, fmt.Sprintf("capacity providers %s added", strings.Join(missing, ", ")))
+			return
+		}
+		plan.add("ECS Cluster", config.ClusterName, PlanNoOp, "exists")
+		return
+	}
+	plan.add("ECS Cluster", config.ClusterName, PlanCreate, "FARGATE and FARGATE_SPOT capacity providers")
+}
+
+func (d *ECSDeployer) planLogGroup(plan *Plan, logGroupName string) {
+	output, err := d.logsClient.DescribeLogGroups(d.ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(logGroupName),
+	})
+	if err == nil {
+		for _, group := range output.LogGroups {
+			if aws.ToString(group.LogGroupName) == logGroupName {
+				plan.add("CloudWatch Log Group", logGroupName, PlanNoOp, "exists")
+				return
+			}
+		}
+	}
+	plan.add("CloudWatch Log Group", logGroupName, PlanCreate, "")
+}
+
+// planSecrets returns the secret ARNs for the task definition, using a
+// placeholder for secrets that do not exist yet.
+func (d *ECSDeployer) planSecrets(plan *Plan, config ECSConfig) map[string]string {
+	secretArns := map[string]string{}
+	for _, spec := range secretSpecs(config.ServiceName) {
+		existing, err := d.findSecret(config, spec, d.state.Secrets[spec.key])
+		if err != nil {
+			plan.add("Secret", spec.name, PlanConflict, err.Error())
+			continue
+		}
+
+		value := ""
+		if spec.envVar != "" {
+			value = os.Getenv(spec.envVar)
+		}
+		if existing == nil {
+			switch {
+			case spec.envVar == "":
+				plan.add("Secret", spec.name, PlanCreate, "generated value")
+			case value != "":
+				plan.add("Secret", spec.name, PlanCreate, "from "+spec.envVar)
+			default:
+				continue
+			}
+			secretArns[spec.key] = fmt.Sprintf("<arn of %s, known after apply>", spec.name)
+			continue
+		}
+
+		arn := aws.ToString(existing.ARN)
+		secretArns[spec.key] = arn
+		var changes []string
+		if existing.DeletedDate != nil {
+			changes = append(changes, "restore from scheduled deletion")
+		}
+		if value != "" {
+			current, err := d.secretsClient.GetSecretValue(d.ctx, &secretsmanager.GetSecretValueInput{
+				SecretId: aws.String(arn),
+			})
+			if err != nil || aws.ToString(current.SecretString) != value {
+				changes = append(changes, "new value from "+spec.envVar)
+			}
+		}
+		if len(changes) > 0 {
+			plan.add("Secret", spec.name, PlanUpdate, strings.Join(changes, ", "))
+		} else {
+			plan.add("Secret", spec.name, PlanNoOp, "reused: "+arn)
+		}
+	}
+	return secretArns
+}
+
+// planEFS returns the file system ID for the task definition, or a placeholder
+// when it would be created.
+func (d *ECSDeployer) planEFS(plan *Plan, config ECSConfig) string {
+	creationToken := fmt.Sprintf("%s-efs", config.ServiceName)
+	if d.state.EFSFileSystemId != "" {
+		plan.add("EFS File System", creationToken, PlanNoOp, "recorded in deployment state: "+d.state.EFSFileSystemId)
+		return d.state.EFSFileSystemId
+	}
+
+	output, err := d.efsClient.DescribeFileSystems(d.ctx, &efs.DescribeFileSystemsInput{
+		CreationToken: aws.String(creationToken),
+	})
+	if err == nil && len(output.FileSystems) > 0 {
+		efsId := aws.ToString(output.FileSystems[0].FileSystemId)
+		plan.add("EFS File System", creationToken, PlanConflict, fmt.Sprintf("%s already exists with this creation token", efsId))
+		return efsId
+	}
+
+	plan.add("EFS File System", creationToken, PlanCreate, "generalPurpose, 10 MiB/s provisioned throughput")
+	plan.add("EFS Mount Targets", creationToken, PlanCreate, fmt.Sprintf("one per subnet: %s", strings.Join(config.TaskSubnetIds, ", ")))
+	return "<file system id, known after apply>"
+}
+
+func (d *ECSDeployer) planTaskDefinition(plan *Plan, input *ecs.RegisterTaskDefinitionInput) {
+	family := aws.ToString(input.Family)
+	output, err := d.ecsClient.DescribeTaskDefinition(d.ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(family),
+	})
+	if err != nil || output.TaskDefinition == nil {
+		plan.add("Task Definition", family, PlanCreate, "revision 1")
+		return
+	}
+
+	current := output.TaskDefinition
+	differences := taskDefinitionDifferences(current, input)
+	details := fmt.Sprintf("revision %d -> %d", current.Revision, current.Revision+1)
+	if len(differences) == 0 {
+		details += ", no container changes"
+	} else {
+		details += ", " + strings.Join(differences, "; ")
+	}
+	plan.add("Task Definition", family, PlanUpdate, details)
+}
+
+// taskDefinitionDifferences compares the fields a deployment typically changes.
+func taskDefinitionDifferences(current *types.TaskDefinition, input *ecs.RegisterTaskDefinitionInput) []string {
+	var differences []string
+	if aws.ToString(current.Cpu) != aws.ToString(input.Cpu) {
+		differences = append(differences, fmt.Sprintf("cpu %s -> %s", aws.ToString(current.Cpu), aws.ToString(input.Cpu)))
+	}
+	if aws.ToString(current.Memory) != aws.ToString(input.Memory) {
+		differences = append(differences, fmt.Sprintf("memory %s -> %s", aws.ToString(current.Memory), aws.ToString(input.Memory)))
+	}
+	if aws.ToString(current.ExecutionRoleArn) != aws.ToString(input.ExecutionRoleArn) {
+		differences = append(differences, fmt.Sprintf("execution role %s -> %s", aws.ToString(current.ExecutionRoleArn), aws.ToString(input.ExecutionRoleArn)))
+	}
+	if aws.ToString(current.TaskRoleArn) != aws.ToString(input.TaskRoleArn) {
+		differences = append(differences, fmt.Sprintf("task role %q -> %q", aws.ToString(current.TaskRoleArn), aws.ToString(input.TaskRoleArn)))
+	}
+
+	existing := map[string]types.ContainerDefinition{}
+	for _, container := range current.ContainerDefinitions {
+		existing[aws.ToString(container.Name)] = container
+	}
+
+	for _, container := range input.ContainerDefinitions {
+		name := aws.ToString(container.Name)
+		old, ok := existing[name]
+		if !ok {
+			differences = append(differences, fmt.Sprintf("container %s added", name))
+			continue
+		}
+		delete(existing, name)
+
+		if aws.ToString(old.Image) != aws.ToString(container.Image) {
+			differences = append(differences, fmt.Sprintf("%s image %s -> %s", name, aws.ToString(old.Image), aws.ToString(container.Image)))
+		}
+		if envNames(old.Environment) != envNames(container.Environment) {
+			differences = append(differences, fmt.Sprintf("%s environment changed", name))
+		}
+		if secretNames(old.Secrets) != secretNames(container.Secrets) {
+			differences = append(differences, fmt.Sprintf("%s secrets changed", name))
+		}
+		if healthCheckCommand(old.HealthCheck) != healthCheckCommand(container.HealthCheck) {
+			differences = append(differences, fmt.Sprintf("%s %s", name, healthCheckLabel(container.HealthCheck)))
+		}
+		if dependsOnLabel(old.DependsOn) != dependsOnLabel(container.DependsOn) {
+			differences = append(differences, fmt.Sprintf("%s startup order changed", name))
+		}
+		if aws.ToInt32(old.StartTimeout) != aws.ToInt32(container.StartTimeout) || aws.ToInt32(old.StopTimeout) != aws.ToInt32(container.StopTimeout) {
+			differences = append(differences, fmt.Sprintf("%s timeouts changed", name))
+		}
+	}
+
+	for name := range existing {
+		differences = append(differences, fmt.Sprintf("container %s removed", name))
+	}
+	return differences
+}
+
+// envNames returns a comparable form of the environment, ignoring order.
+func envNames(env []types.KeyValuePair) string {
+	values := make([]string, 0, len(env))
+	for _, pair := range env {
+		values = append(values, aws.ToString(pair.Name)+"="+aws.ToString(pair.Value))
+	}
+	return sortedJoin(values)
+}
+
+// healthCheckCommand ignores the timing values, which ECS fills in with defaults.
+func healthCheckCommand(healthCheck *types.HealthCheck) string {
+	if healthCheck == nil {
+		return ""
+	}
+	return strings.Join(healthCheck.Command, " ")
+}
+
+func secretNames(secrets []types.Secret) string {
+	values := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		values = append(values, aws.ToString(secret.Name))
+	}
+	return sortedJoin(values)
+}
+
+func sortedJoin(values []string) string {
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (d *ECSDeployer) planService(plan *Plan, config ECSConfig) error {
+	if config.DeploymentStrategy == DeploymentBlueGreen || config.DeploymentStrategy == DeploymentCanary {
+		return d.planBlueGreen(plan, config)
+	}
+
+	output, err := d.ecsClient.DescribeServices(d.ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(config.ClusterName),
+		Services: []string{config.ServiceName},
+	})
+	if err == nil && len(output.Services) > 0 && aws.ToString(output.Services[0].Status) == "ACTIVE" {
+		// CreateService only points an existing service at the new revision
+		capacity := capacityLabel(config)
+		if strategy, changed := capacityProviderUpdate(output.Services[0], config); changed {
+			capacity = fmt.Sprintf("%s -> capacity providers %s, forces a new deployment", serviceCapacityLabel(output.Services[0]), strategyLabel(strategy))
+		}
+		plan.add("ECS Service", config.ServiceName, PlanUpdate,
+			fmt.Sprintf("task definition %s -> latest %s revision; %s; %s; %s", shortTaskDefinition(aws.ToString(output.Services[0].TaskDefinition)), config.TaskDefinitionName, capacity, taskNetworkLabel(config), deploymentLabel(config)))
+		plan.add("Load Balancer", fmt.Sprintf("%s-alb", config.ServiceName), PlanNoOp, "not touched for existing services")
+		targetGroupName := BlueTargetGroupName(config.ServiceName)
+		if loadBalancers := output.Services[0].LoadBalancers; len(loadBalancers) > 0 {
+			targetGroupName = targetGroupLabel(aws.ToString(loadBalancers[0].TargetGroupArn))
+		}
+		d.planTargetGroup(plan, config, targetGroupName,
+			fmt.Sprintf("replaced by %s, the listener moves once tasks are healthy in both", alternateTargetGroupName(config, targetGroupName)))
+		if config.HTTPS.Enabled {
+			plan.add("Listener", fmt.Sprintf("%s-alb:443", config.ServiceName), PlanUpdate, fmt.Sprintf("HTTPS forward to %s, created if missing", targetGroupName))
+			d.planHTTPS(plan, config)
+		}
+		d.planDNS(plan, config)
+		return nil
+	}
+
+	loadBalancerName := fmt.Sprintf("%s-alb", config.ServiceName)
+	var loadBalancerArn string
+	lbOutput, err := d.elbv2Client.DescribeLoadBalancers(d.ctx, &elasticloadbalancingv2.DescribeLoadBalancersInput{
+		Names: []string{loadBalancerName},
+	})
+	if err == nil && len(lbOutput.LoadBalancers) > 0 && lbOutput.LoadBalancers[0].State.Code == elbv2types.LoadBalancerStateEnumActive {
+		loadBalancerArn = aws.ToString(lbOutput.LoadBalancers[0].LoadBalancerArn)
+		plan.add("Load Balancer", loadBalancerName, PlanNoOp, "exists and is active")
+	} else {
+		plan.add("Load Balancer", loadBalancerName, PlanCreate, fmt.Sprintf("internet-facing in %s", strings.Join(config.LoadBalancerSubnetIds, ", ")))
+	}
+
+	targetGroupName := fmt.Sprintf("%s-tg", config.ServiceName)
+	d.planTargetGroup(plan, config, targetGroupName,
+		fmt.Sprintf("replaced by %s before the listener forwards to it", alternateTargetGroupName(config, targetGroupName)))
+
+	listenerAction := PlanCreate
+	if loadBalancerArn != "" {
+		if listener, err := d.findTrafficListener(loadBalancerArn, config); err == nil && listener != nil {
+			listenerAction = PlanUpdate
+		}
+	}
+	plan.add("Listener", fmt.Sprintf("%s:%d", loadBalancerName, listenerPort(config)), listenerAction, fmt.Sprintf("forward to %s", targetGroupName))
+	d.planHTTPS(plan, config)
+	d.planDNS(plan, config)
+
+	plan.add("ECS Service", config.ServiceName, PlanCreate,
+		fmt.Sprintf("%d tasks on %s in %s; %s", initialDesiredCount(config), capacityLabel(config), taskNetworkLabel(config), deploymentLabel(config)))
+	return nil
+}
+
+// planBlueGreen describes a blue/green deployment: a new task set behind the
+// idle target group and a listener switch once it is healthy.
+func (d *ECSDeployer) planBlueGreen(plan *Plan, config ECSConfig) error {
+	service, err := d.describeService(config)
+	if err == nil && !isExternalService(service) {
+		plan.add("ECS Service", config.ServiceName, PlanNoOp,
+			"created for rolling deployments; blue/green requires cleanup and a new deployment")
+		return nil
+	}
+
+	targets, targetsErr := d.currentBlueGreenTargets(config)
+	if err != nil || targetsErr != nil {
+		loadBalancerName := fmt.Sprintf("%s-alb", config.ServiceName)
+		plan.add("Load Balancer", loadBalancerName, PlanCreate, "internet-facing, reused if it exists")
+		d.planTargetGroup(plan, config, BlueTargetGroupName(config.ServiceName), "replaced while it has no traffic")
+		d.planTargetGroup(plan, config, GreenTargetGroupName(config.ServiceName), "replaced while it has no traffic")
+		plan.add("Listener", fmt.Sprintf("%s:%d", loadBalancerName, listenerPort(config)), PlanCreate, fmt.Sprintf("weighted forward %s=100, %s=0", BlueTargetGroupName(config.ServiceName), GreenTargetGroupName(config.ServiceName)))
+		d.planHTTPS(plan, config)
+		d.planDNS(plan, config)
+		if err != nil {
+			plan.add("ECS Service", config.ServiceName, PlanCreate, "external deployment controller for task sets")
+		}
+		plan.add("ECS Task Set", config.TaskDefinitionName, PlanCreate,
+			fmt.Sprintf("behind %s on %s, traffic shifts after health checks pass", GreenTargetGroupName(config.ServiceName), capacityLabel(config)))
+		return nil
+	}
+
+	d.planTargetGroup(plan, config, targetGroupLabel(targets.idle), "recreated before the new task set starts behind it")
+	d.planTargetGroup(plan, config, targetGroupLabel(targets.active), "serves traffic, replaced on the deployment after this one")
+	plan.add("ECS Task Set", config.TaskDefinitionName, PlanCreate,
+		fmt.Sprintf("behind idle %s on %s, health checked for up to %s", targetGroupLabel(targets.idle), capacityLabel(config), config.BlueGreenHealthTimeout))
+	shift := fmt.Sprintf("weights %s=0 -> %s=100", targetGroupLabel(targets.active), targetGroupLabel(targets.idle))
+	if config.DeploymentStrategy == DeploymentCanary {
+		shift = fmt.Sprintf("canary to %s in steps %s, %s each, rolled back on unhealthy targets or more than %d 5xx",
+			targetGroupLabel(targets.idle), canaryStepsLabel(config.CanarySteps), config.CanaryStepDuration, config.CanaryMax5xx)
+	}
+	plan.add("Listener", fmt.Sprintf("%s-alb:%d", config.ServiceName, listenerPort(config)), PlanUpdate, shift)
+	d.planHTTPS(plan, config)
+	d.planDNS(plan, config)
+	if primary := primaryTaskSet(service); primary != nil {
+		detail := "deleted after the switch"
+		if config.KeepPreviousTaskSet {
+			detail = "kept running for switch-back"
+		}
+		plan.add("ECS Task Set", aws.ToString(primary.Id), PlanNoOp,
+			fmt.Sprintf("current %s, %s", shortTaskDefinition(aws.ToString(primary.TaskDefinition)), detail))
+	}
+	return nil
+}
+
+func canaryStepsLabel(steps []int32) string {
+	labels := make([]string, 0, len(steps))
+	for _, step := range steps {
+		labels = append(labels, fmt.Sprintf("%d%%", step))
+	}
+	return strings.Join(labels, " -> ")
+}
+
+// shortTaskDefinition turns a task definition ARN into family:revision.
+func shortTaskDefinition(arn string) string {
+	if i := strings.LastIndex(arn, "/"); i >= 0 {
+		return arn[i+1:]
+	}
+	return arn
+}
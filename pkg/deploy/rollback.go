@@ -0,0 +1,264 @@
+package deploy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Revision is one registered revision of the task definition family.
+type Revision struct {
+	Arn          string            `json:"arn"`
+	Revision     int32             `json:"revision"`
+	RegisteredAt time.Time         `json:"registered_at"`
+	Images       map[string]string `json:"images"`
+	// Current is set for the revision the service runs
+	Current bool `json:"current"`
+}
+
+func (r Revision) String() string {
+	containers := make([]string, 0, len(r.Images))
+	for name := range r.Images {
+		containers = append(containers, name)
+	}
+	sort.Strings(containers)
+
+	images := make([]string, 0, len(containers))
+	for _, name := range containers {
+		images = append(images, fmt.Sprintf("%s=%s", name, r.Images[name]))
+	}
+
+	registered := "unknown"
+	if !r.RegisteredAt.IsZero() {
+		registered = r.RegisteredAt.Local().Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf("revision %d, registered %s: %s", r.Revision, registered, strings.Join(images, ", "))
+}
+
+// RollbackResult describes a completed rollback.
+type RollbackResult struct {
+	ServiceName string
+	From        *Revision
+	To          *Revision
+}
+
+func (r *RollbackResult) String() string {
+	from := "unknown revision"
+	if r.From != nil {
+		from = r.From.String()
+	}
+	return fmt.Sprintf("Rolled back service %s\n  from %s\n  to   %s\n", r.ServiceName, from, r.To.String())
+}
+
+// ListRevisions returns the newest ACTIVE revisions of the task definition
+// family, marking the one the service currently runs.
+func (d *ECSDeployer) ListRevisions(config ECSConfig, limit int32) ([]Revision, error) {
+	arns, err := d.listFamilyRevisions(config.TaskDefinitionName, int(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	currentArn, _ := d.currentTaskDefinition(config)
+
+	var revisions []Revision
+	for _, arn := range arns {
+		revision, err := d.describeRevision(arn)
+		if err != nil {
+			return nil, err
+		}
+		revision.Current = arn == currentArn
+		revisions = append(revisions, *revision)
+	}
+	return revisions, nil
+}
+
+// listFamilyRevisions returns up to limit (all when 0) ACTIVE task definition
+// ARNs of exactly this family, newest first. ECS matches FamilyPrefix as a prefix,
+// so family "myapp" would also list "myapp-worker".
+func (d *ECSDeployer) listFamilyRevisions(family string, limit int) ([]string, error) {
+	var arns []string
+	var nextToken *string
+	for {
+		output, err := d.ecsClient.ListTaskDefinitions(d.ctx, &ecs.ListTaskDefinitionsInput{
+			FamilyPrefix: aws.String(family),
+			Status:       types.TaskDefinitionStatusActive,
+			Sort:         types.SortOrderDesc,
+			MaxResults:   aws.Int32(100),
+			NextToken:    nextToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list task definitions: %w", err)
+		}
+		for _, arn := range output.TaskDefinitionArns {
+			if taskDefinitionFamily(arn) != family {
+				continue
+			}
+			arns = append(arns, arn)
+			if len(arns) == limit {
+				return arns, nil
+			}
+		}
+		if output.NextToken == nil {
+			return arns, nil
+		}
+		nextToken = output.NextToken
+	}
+}
+
+// taskDefinitionFamily is the family of a task definition ARN, the part
+// between "task-definition/" and the revision.
+func taskDefinitionFamily(arn string) string {
+	family := arn
+	if i := strings.Index(family, "task-definition/"); i >= 0 {
+		family = family[i+len("task-definition/"):]
+	}
+	if i := strings.LastIndex(family, ":"); i >= 0 {
+		family = family[:i]
+	}
+	return family
+}
+
+// RevisionsSummary renders revisions newest first.
+func RevisionsSummary(config ECSConfig, revisions []Revision) string {
+	if len(revisions) == 0 {
+		return fmt.Sprintf("No active revisions of task definition %s found\n", config.TaskDefinitionName)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Recent revisions of %s:\n", config.TaskDefinitionName)
+	for _, revision := range revisions {
+		marker := " "
+		if revision.Current {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, "%s %s\n", marker, revision.String())
+	}
+	b.WriteString("(* = running in the service)\n")
+	return b.String()
+}
+
+// RollbackTarget resolves the revision a rollback would switch to: the given
+// revision, or the newest active revision older than the current one when
+// toRevision is 0.
+func (d *ECSDeployer) RollbackTarget(config ECSConfig, toRevision int32) (current *Revision, target *Revision, err error) {
+	currentArn, err := d.currentTaskDefinition(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err = d.describeRevision(currentArn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if toRevision > 0 {
+		if toRevision == current.Revision {
+			return nil, nil, fmt.Errorf("service %s already runs revision %d", config.ServiceName, toRevision)
+		}
+		target, err = d.describeRevision(fmt.Sprintf("%s:%d", config.TaskDefinitionName, toRevision))
+		if err != nil {
+			return nil, nil, err
+		}
+		return current, target, nil
+	}
+
+	revisions, err := d.ListRevisions(config, 100)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range revisions {
+		if revisions[i].Revision < current.Revision {
+			return current, &revisions[i], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no active revision of %s older than revision %d", config.TaskDefinitionName, current.Revision)
+}
+
+// Rollback updates the service to an earlier task definition revision and
+// waits for it to become stable.
+func (d *ECSDeployer) Rollback(config ECSConfig, toRevision int32) (*RollbackResult, error) {
+	current, target, err := d.RollbackTarget(config, toRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Rolling back service %s from revision %d to revision %d\n", config.ServiceName, current.Revision, target.Revision)
+
+	if err := d.beginState(config); err != nil {
+		return nil, err
+	}
+
+	// Blue/green services roll back by deploying the old revision as a new task set
+	service, err := d.describeService(config)
+	if err != nil {
+		return nil, err
+	}
+	if isExternalService(service) {
+		// A rollback moves all traffic at once, even for canary services
+		config.DeploymentStrategy = DeploymentBlueGreen
+		if err := d.deployBlueGreen(config, target.Arn); err != nil {
+			return nil, err
+		}
+		target.Current = true
+		return &RollbackResult{ServiceName: config.ServiceName, From: current, To: target}, nil
+	}
+
+	_, err = d.ecsClient.UpdateService(d.ctx, &ecs.UpdateServiceInput{
+		Cluster:        aws.String(config.ClusterName),
+		Service:        aws.String(config.ServiceName),
+		TaskDefinition: aws.String(target.Arn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update ECS service: %w", err)
+	}
+	d.recordState(func(state *DeploymentState) {
+		state.TaskDefinitionArn = target.Arn
+	})
+
+	if err := d.WaitForServiceStable(config.ClusterName, config.ServiceName); err != nil {
+		return nil, err
+	}
+
+	target.Current = true
+	return &RollbackResult{ServiceName: config.ServiceName, From: current, To: target}, nil
+}
+
+// currentTaskDefinition returns the task definition ARN the service runs,
+// which for blue/green services is the one of the primary task set.
+func (d *ECSDeployer) currentTaskDefinition(config ECSConfig) (string, error) {
+	service, err := d.describeService(config)
+	if err != nil {
+		return "", err
+	}
+	if primary := primaryTaskSet(service); primary != nil {
+		return aws.ToString(primary.TaskDefinition), nil
+	}
+	return aws.ToString(service.TaskDefinition), nil
+}
+
+func (d *ECSDeployer) describeRevision(taskDefinition string) (*Revision, error) {
+	output, err := d.ecsClient.DescribeTaskDefinition(d.ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(taskDefinition),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe task definition %s: %w", taskDefinition, err)
+	}
+
+	definition := output.TaskDefinition
+	revision := &Revision{
+		Arn:      aws.ToString(definition.TaskDefinitionArn),
+		Revision: definition.Revision,
+		Images:   map[string]string{},
+	}
+	if definition.RegisteredAt != nil {
+		revision.RegisteredAt = *definition.RegisteredAt
+	}
+	for _, container := range definition.ContainerDefinitions {
+		revision.Images[aws.ToString(container.Name)] = aws.ToString(container.Image)
+	}
+	return revision, nil
+}
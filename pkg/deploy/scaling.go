@@ -0,0 +1,444 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// ScalingConfig configures Application Auto Scaling of the service's task
+// count. A target of 0 disables that target tracking policy.
+type ScalingConfig struct {
+	Enabled           bool
+	MinTasks          int32
+	MaxTasks          int32
+	CPUTarget         float64
+	MemoryTarget      float64
+	RequestsPerTarget float64
+	ScaleInCooldown   int32 // seconds
+	ScaleOutCooldown  int32 // seconds
+	Scheduled         []ScheduledScaling
+}
+
+// ScheduledScaling changes the task count bounds on a schedule, e.g. for
+// business hours.
+type ScheduledScaling struct {
+	Name     string
+	Schedule string // at(...), rate(...) or cron(...)
+	Timezone string
+	MinTasks int32
+	MaxTasks int32
+}
+
+// scalingResourceId is the Application Auto Scaling ID of the service.
+func scalingResourceId(config ECSConfig) string {
+	return fmt.Sprintf("service/%s/%s", config.ClusterName, config.ServiceName)
+}
+
+// scalingPolicyName names the target tracking policy for a metric.
+func scalingPolicyName(config ECSConfig, metric string) string {
+	return fmt.Sprintf("%s-%s", config.ServiceName, metric)
+}
+
+// initialDesiredCount is the task count a new service starts with.
+func initialDesiredCount(config ECSConfig) int32 {
+	desired := config.DesiredCount
+	if desired <= 0 {
+		desired = 1
+	}
+	if config.Scaling.Enabled {
+		if desired < config.Scaling.MinTasks {
+			desired = config.Scaling.MinTasks
+		}
+		if config.Scaling.MaxTasks > 0 && desired > config.Scaling.MaxTasks {
+			desired = config.Scaling.MaxTasks
+		}
+	}
+	return desired
+}
+
+// validateScaling checks the task count bounds and scheduled actions before
+// anything is created, since configureScaling only runs once the service
+// exists.
+func validateScaling(config ECSConfig) error {
+	scaling := config.Scaling
+	if !scaling.Enabled {
+		return nil
+	}
+
+	var problems []string
+	if scaling.MinTasks < 0 || scaling.MaxTasks < scaling.MinTasks || scaling.MaxTasks == 0 {
+		problems = append(problems, fmt.Sprintf("min_tasks %d and max_tasks %d must satisfy 0 <= min_tasks <= max_tasks and max_tasks > 0", scaling.MinTasks, scaling.MaxTasks))
+	}
+	for name, target := range map[string]float64{"cpu_target": scaling.CPUTarget, "memory_target": scaling.MemoryTarget} {
+		if target < 0 || target > 100 {
+			problems = append(problems, fmt.Sprintf("%s %.0f must be between 0 and 100", name, target))
+		}
+	}
+	seen := map[string]bool{}
+	for i, action := range scaling.Scheduled {
+		if action.Name == "" || action.Schedule == "" {
+			problems = append(problems, fmt.Sprintf("scheduled action %d needs a name and a schedule", i+1))
+			continue
+		}
+		if seen[action.Name] {
+			problems = append(problems, fmt.Sprintf("scheduled action %s is listed twice", action.Name))
+		}
+		seen[action.Name] = true
+		if action.MinTasks < 0 || action.MaxTasks < action.MinTasks {
+			problems = append(problems, fmt.Sprintf("scheduled action %s: min_tasks %d and max_tasks %d must satisfy 0 <= min_tasks <= max_tasks", action.Name, action.MinTasks, action.MaxTasks))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid scaling config:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// configureScaling registers the service as a scalable target and puts its
+// target tracking policies and scheduled actions, removing the ones that are
+// no longer configured. With scaling disabled it removes any existing setup.
+// The load balancer and target group are only needed for request count
+// scaling.
+func (d *ECSDeployer) configureScaling(config ECSConfig, loadBalancerArn, targetGroupArn string) error {
+	if !config.Scaling.Enabled {
+		return d.removeScaling(config)
+	}
+
+	if err := validateScaling(config); err != nil {
+		return err
+	}
+	scaling := config.Scaling
+
+	resourceId := scalingResourceId(config)
+	fmt.Printf("Configuring auto scaling for %s: %d-%d tasks\n", config.ServiceName, scaling.MinTasks, scaling.MaxTasks)
+
+	_, err := d.scalingClient.RegisterScalableTarget(d.ctx, &applicationautoscaling.RegisterScalableTargetInput{
+		ServiceNamespace:  astypes.ServiceNamespaceEcs,
+		ResourceId:        aws.String(resourceId),
+		ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+		MinCapacity:       aws.Int32(scaling.MinTasks),
+		MaxCapacity:       aws.Int32(scaling.MaxTasks),
+		Tags:              config.ResourceTags(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register scalable target: %w", err)
+	}
+
+	policies := map[string]*astypes.PredefinedMetricSpecification{}
+	targets := map[string]float64{}
+	if scaling.CPUTarget > 0 {
+		policies["cpu"] = &astypes.PredefinedMetricSpecification{
+			PredefinedMetricType: astypes.MetricTypeECSServiceAverageCPUUtilization,
+		}
+		targets["cpu"] = scaling.CPUTarget
+	}
+	if scaling.MemoryTarget > 0 {
+		policies["memory"] = &astypes.PredefinedMetricSpecification{
+			PredefinedMetricType: astypes.MetricTypeECSServiceAverageMemoryUtilization,
+		}
+		targets["memory"] = scaling.MemoryTarget
+	}
+	if scaling.RequestsPerTarget > 0 {
+		if loadBalancerArn == "" || targetGroupArn == "" {
+			fmt.Printf("Warning: Load balancer not known, skipping request count scaling policy\n")
+		} else {
+			policies["requests"] = &astypes.PredefinedMetricSpecification{
+				PredefinedMetricType: astypes.MetricTypeALBRequestCountPerTarget,
+				// app/<lb name>/<id>/targetgroup/<tg name>/<id>
+				ResourceLabel: aws.String(arnResource(loadBalancerArn, "app/") + "/" + arnResource(targetGroupArn, "targetgroup/")),
+			}
+			targets["requests"] = scaling.RequestsPerTarget
+		}
+	}
+
+	wanted := map[string]bool{}
+	for _, metric := range sortedScalingMetrics(policies) {
+		name := scalingPolicyName(config, metric)
+		wanted[name] = true
+		_, err := d.scalingClient.PutScalingPolicy(d.ctx, &applicationautoscaling.PutScalingPolicyInput{
+			PolicyName:        aws.String(name),
+			ServiceNamespace:  astypes.ServiceNamespaceEcs,
+			ResourceId:        aws.String(resourceId),
+			ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+			PolicyType:        astypes.PolicyTypeTargetTrackingScaling,
+			TargetTrackingScalingPolicyConfiguration: &astypes.TargetTrackingScalingPolicyConfiguration{
+				TargetValue:                   aws.Float64(targets[metric]),
+				PredefinedMetricSpecification: policies[metric],
+				ScaleInCooldown:               aws.Int32(scaling.ScaleInCooldown),
+				ScaleOutCooldown:              aws.Int32(scaling.ScaleOutCooldown),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put scaling policy %s: %w", name, err)
+		}
+		fmt.Printf("Scaling policy %s: target %s %.0f\n", name, metric, targets[metric])
+	}
+
+	existingPolicies, err := d.scalingClient.DescribeScalingPolicies(d.ctx, &applicationautoscaling.DescribeScalingPoliciesInput{
+		ServiceNamespace:  astypes.ServiceNamespaceEcs,
+		ResourceId:        aws.String(resourceId),
+		ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to list scaling policies: %v\n", err)
+	} else {
+		for _, policy := range existingPolicies.ScalingPolicies {
+			name := aws.ToString(policy.PolicyName)
+			if wanted[name] {
+				continue
+			}
+			_, err := d.scalingClient.DeleteScalingPolicy(d.ctx, &applicationautoscaling.DeleteScalingPolicyInput{
+				PolicyName:        policy.PolicyName,
+				ServiceNamespace:  astypes.ServiceNamespaceEcs,
+				ResourceId:        aws.String(resourceId),
+				ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+			})
+			if err != nil {
+				fmt.Printf("Warning: Failed to delete scaling policy %s: %v\n", name, err)
+			} else {
+				fmt.Printf("Deleted scaling policy %s\n", name)
+			}
+		}
+	}
+
+	return d.configureScheduledScaling(config)
+}
+
+func (d *ECSDeployer) configureScheduledScaling(config ECSConfig) error {
+	resourceId := scalingResourceId(config)
+
+	wanted := map[string]bool{}
+	for _, action := range config.Scaling.Scheduled {
+		name := fmt.Sprintf("%s-%s", config.ServiceName, action.Name)
+		wanted[name] = true
+
+		input := &applicationautoscaling.PutScheduledActionInput{
+			ScheduledActionName: aws.String(name),
+			ServiceNamespace:    astypes.ServiceNamespaceEcs,
+			ResourceId:          aws.String(resourceId),
+			ScalableDimension:   astypes.ScalableDimensionECSServiceDesiredCount,
+			Schedule:            aws.String(action.Schedule),
+			ScalableTargetAction: &astypes.ScalableTargetAction{
+				MinCapacity: aws.Int32(action.MinTasks),
+				MaxCapacity: aws.Int32(action.MaxTasks),
+			},
+		}
+		if action.Timezone != "" {
+			input.Timezone = aws.String(action.Timezone)
+		}
+		if _, err := d.scalingClient.PutScheduledAction(d.ctx, input); err != nil {
+			return fmt.Errorf("failed to put scheduled action %s: %w", name, err)
+		}
+		fmt.Printf("Scheduled scaling %s: %s -> %d-%d tasks\n", name, action.Schedule, action.MinTasks, action.MaxTasks)
+	}
+
+	existing, err := d.scalingClient.DescribeScheduledActions(d.ctx, &applicationautoscaling.DescribeScheduledActionsInput{
+		ServiceNamespace:  astypes.ServiceNamespaceEcs,
+		ResourceId:        aws.String(resourceId),
+		ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to list scheduled actions: %v\n", err)
+		return nil
+	}
+	for _, action := range existing.ScheduledActions {
+		name := aws.ToString(action.ScheduledActionName)
+		if wanted[name] {
+			continue
+		}
+		_, err := d.scalingClient.DeleteScheduledAction(d.ctx, &applicationautoscaling.DeleteScheduledActionInput{
+			ScheduledActionName: action.ScheduledActionName,
+			ServiceNamespace:    astypes.ServiceNamespaceEcs,
+			ResourceId:          aws.String(resourceId),
+			ScalableDimension:   astypes.ScalableDimensionECSServiceDesiredCount,
+		})
+		if err != nil {
+			fmt.Printf("Warning: Failed to delete scheduled action %s: %v\n", name, err)
+		} else {
+			fmt.Printf("Deleted scheduled action %s\n", name)
+		}
+	}
+	return nil
+}
+
+// removeScaling deregisters the scalable target, which also deletes its
+// policies and scheduled actions.
+func (d *ECSDeployer) removeScaling(config ECSConfig) error {
+	_, err := d.scalingClient.DeregisterScalableTarget(d.ctx, &applicationautoscaling.DeregisterScalableTargetInput{
+		ServiceNamespace:  astypes.ServiceNamespaceEcs,
+		ResourceId:        aws.String(scalingResourceId(config)),
+		ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+	})
+	if err != nil {
+		var notFound *astypes.ObjectNotFoundException
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to deregister scalable target: %w", err)
+	}
+	fmt.Printf("Removed auto scaling for %s\n", config.ServiceName)
+	return nil
+}
+
+// scalableTarget returns the registered min and max task count, or ok=false
+// if the service has no auto scaling.
+func (d *ECSDeployer) scalableTarget(config ECSConfig) (min, max int32, ok bool, err error) {
+	output, err := d.scalingClient.DescribeScalableTargets(d.ctx, &applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace:  astypes.ServiceNamespaceEcs,
+		ResourceIds:       []string{scalingResourceId(config)},
+		ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+	})
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to describe scalable target: %w", err)
+	}
+	if len(output.ScalableTargets) == 0 {
+		return 0, 0, false, nil
+	}
+	target := output.ScalableTargets[0]
+	return aws.ToInt32(target.MinCapacity), aws.ToInt32(target.MaxCapacity), true, nil
+}
+
+// ScaleService changes the task count of the service. A zero desired, min or
+// max leaves that value unchanged. min and max update the auto scaling
+// bounds and register auto scaling if the service has none yet.
+func (d *ECSDeployer) ScaleService(config ECSConfig, desired, min, max int32) (string, error) {
+	currentMin, currentMax, registered, err := d.scalableTarget(config)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if min > 0 || max > 0 {
+		if min == 0 {
+			min = currentMin
+		}
+		if max == 0 {
+			max = currentMax
+		}
+		if !registered && (min == 0 || max == 0) {
+			return "", fmt.Errorf("service %s has no auto scaling yet; both min_tasks and max_tasks are required", config.ServiceName)
+		}
+		if max < min {
+			return "", fmt.Errorf("max_tasks %d is lower than min_tasks %d", max, min)
+		}
+
+		_, err := d.scalingClient.RegisterScalableTarget(d.ctx, &applicationautoscaling.RegisterScalableTargetInput{
+			ServiceNamespace:  astypes.ServiceNamespaceEcs,
+			ResourceId:        aws.String(scalingResourceId(config)),
+			ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+			MinCapacity:       aws.Int32(min),
+			MaxCapacity:       aws.Int32(max),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to update scalable target: %w", err)
+		}
+		fmt.Fprintf(&b, "Auto scaling bounds of %s set to %d-%d tasks\n", config.ServiceName, min, max)
+		currentMin, currentMax, registered = min, max, true
+	}
+
+	if desired > 0 {
+		if registered && (desired < currentMin || desired > currentMax) {
+			return "", fmt.Errorf("desired count %d is outside the auto scaling bounds %d-%d; change min_tasks/max_tasks as well", desired, currentMin, currentMax)
+		}
+		_, err := d.ecsClient.UpdateService(d.ctx, &ecs.UpdateServiceInput{
+			Cluster:      aws.String(config.ClusterName),
+			Service:      aws.String(config.ServiceName),
+			DesiredCount: aws.Int32(desired),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to update desired count: %w", err)
+		}
+		fmt.Fprintf(&b, "Desired count of %s set to %d tasks\n", config.ServiceName, desired)
+	}
+
+	if b.Len() == 0 {
+		return "", fmt.Errorf("nothing to change: set desired_count, min_tasks or max_tasks")
+	}
+	return b.String(), nil
+}
+
+// ScalingStatus describes the auto scaling setup of the service.
+func (d *ECSDeployer) ScalingStatus(config ECSConfig) (string, error) {
+	min, max, registered, err := d.scalableTarget(config)
+	if err != nil {
+		return "", err
+	}
+	if !registered {
+		return "Auto Scaling: off\n", nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Auto Scaling: %d-%d tasks\n", min, max)
+
+	policies, err := d.scalingClient.DescribeScalingPolicies(d.ctx, &applicationautoscaling.DescribeScalingPoliciesInput{
+		ServiceNamespace:  astypes.ServiceNamespaceEcs,
+		ResourceId:        aws.String(scalingResourceId(config)),
+		ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+	})
+	if err == nil {
+		for _, policy := range policies.ScalingPolicies {
+			detail := string(policy.PolicyType)
+			if tracking := policy.TargetTrackingScalingPolicyConfiguration; tracking != nil && tracking.PredefinedMetricSpecification != nil {
+				detail = fmt.Sprintf("%s target %.0f", tracking.PredefinedMetricSpecification.PredefinedMetricType, aws.ToFloat64(tracking.TargetValue))
+			}
+			fmt.Fprintf(&b, "  - Policy %s: %s\n", aws.ToString(policy.PolicyName), detail)
+		}
+	}
+
+	actions, err := d.scalingClient.DescribeScheduledActions(d.ctx, &applicationautoscaling.DescribeScheduledActionsInput{
+		ServiceNamespace:  astypes.ServiceNamespaceEcs,
+		ResourceId:        aws.String(scalingResourceId(config)),
+		ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+	})
+	if err == nil {
+		for _, action := range actions.ScheduledActions {
+			bounds := ""
+			if action.ScalableTargetAction != nil {
+				bounds = fmt.Sprintf(" -> %d-%d tasks", aws.ToInt32(action.ScalableTargetAction.MinCapacity), aws.ToInt32(action.ScalableTargetAction.MaxCapacity))
+			}
+			fmt.Fprintf(&b, "  - Scheduled %s: %s%s\n", aws.ToString(action.ScheduledActionName), aws.ToString(action.Schedule), bounds)
+		}
+	}
+	return b.String(), nil
+}
+
+// scalingLabel describes the configured scaling for plans and summaries.
+func scalingLabel(config ECSConfig) string {
+	scaling := config.Scaling
+	var policies []string
+	if scaling.CPUTarget > 0 {
+		policies = append(policies, fmt.Sprintf("CPU %.0f%%", scaling.CPUTarget))
+	}
+	if scaling.MemoryTarget > 0 {
+		policies = append(policies, fmt.Sprintf("memory %.0f%%", scaling.MemoryTarget))
+	}
+	if scaling.RequestsPerTarget > 0 {
+		policies = append(policies, fmt.Sprintf("%.0f requests per task", scaling.RequestsPerTarget))
+	}
+	label := fmt.Sprintf("%d-%d tasks", scaling.MinTasks, scaling.MaxTasks)
+	if len(policies) > 0 {
+		label += ", target tracking " + strings.Join(policies, ", ")
+	}
+	if len(scaling.Scheduled) > 0 {
+		label += fmt.Sprintf(", %d scheduled actions", len(scaling.Scheduled))
+	}
+	return label
+}
+
+func sortedScalingMetrics(policies map[string]*astypes.PredefinedMetricSpecification) []string {
+	var metrics []string
+	for _, metric := range []string{"cpu", "memory", "requests"} {
+		if policies[metric] != nil {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
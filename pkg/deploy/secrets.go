@@ -0,0 +1,281 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// TagSecretKey tags each secret with its key (DB_SECRET_ARN, ...), so it can
+// be found by its tags when neither the recorded ARN nor the name match.
+const TagSecretKey = "secret-key"
+
+// secretSpec is one secret of an advanced deployment. Generated secrets get
+// a random value when they are created and keep it afterwards; the others
+// follow the value of their environment variable.
+type secretSpec struct {
+	key         string
+	name        string
+	description string
+	length      int    // length of a generated value
+	envVar      string // source of the value, empty for generated secrets
+}
+
+// secretSpecs lists the secrets CreateSecrets manages for a service.
+func secretSpecs(serviceName string) []secretSpec {
+	return []secretSpec{
+		{key: "DB_SECRET_ARN", name: serviceName + "-db-password", description: "Database password for Neo4j", length: 32},
+		{key: "JWT_SECRET_ARN", name: serviceName + "-jwt-secret", description: "JWT secret for authentication", length: 64},
+		{key: "SESSION_KEY_ARN", name: serviceName + "-session-key", description: "Session key for session management", length: 32},
+		{key: "ANTHROPIC_SECRET_ARN", name: serviceName + "-anthropic-key", description: "Anthropic API key", envVar: "ANTHROPIC_API_KEY"},
+		{key: "GMAIL_USER_ARN", name: serviceName + "-gmail-user", description: "Gmail user for email integration", envVar: "GMAIL_USER"},
+		{key: "GMAIL_PASS_ARN", name: serviceName + "-gmail-pass", description: "Gmail password for email integration", envVar: "GMAIL_PASS"},
+	}
+}
+
+// SecretsResult is what CreateSecrets did with each secret.
+type SecretsResult struct {
+	// Arns maps the secret keys (DB_SECRET_ARN, ...) to the secret ARNs
+	Arns    map[string]string
+	Created []string
+	Reused  []string
+	Updated []string
+}
+
+func (r *SecretsResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Secrets: %d created, %d reused, %d updated\n", len(r.Created), len(r.Reused), len(r.Updated))
+	for _, group := range []struct {
+		label string
+		names []string
+	}{
+		{"Created", r.Created},
+		{"Reused", r.Reused},
+		{"Updated", r.Updated},
+	} {
+		if len(group.names) > 0 {
+			fmt.Fprintf(&b, "  %s: %s\n", group.label, strings.Join(group.names, ", "))
+		}
+	}
+	return b.String()
+}
+
+// LastSecrets returns what the last CreateSecrets run by this deployer did,
+// or nil if it did not run.
+func (d *ECSDeployer) LastSecrets() *SecretsResult {
+	return d.secrets
+}
+
+// CreateSecrets makes sure the service's secrets exist. Existing secrets are
+// found through the ARNs in the deployment state, by name or by their tags
+// and reused; only missing ones get a generated value, and environment-sourced
+// secrets are updated when their variable changed. Environment-sourced secrets whose
+// variable is not set are reused if they exist and skipped otherwise.
+func (d *ECSDeployer) CreateSecrets(config ECSConfig) (*SecretsResult, error) {
+	fmt.Printf("Ensuring secrets for service: %s\n", config.ServiceName)
+
+	result := &SecretsResult{Arns: map[string]string{}}
+	for _, spec := range secretSpecs(config.ServiceName) {
+		var knownArn string
+		if d.state != nil {
+			knownArn = d.state.Secrets[spec.key]
+		}
+		existing, err := d.findSecret(config, spec, knownArn)
+		if err != nil {
+			return nil, err
+		}
+
+		value := ""
+		if spec.envVar != "" {
+			value = os.Getenv(spec.envVar)
+		}
+
+		if existing == nil {
+			if spec.envVar != "" && value == "" {
+				continue
+			}
+			if spec.envVar == "" {
+				value, err = d.generateRandomPassword(spec.length)
+				if err != nil {
+					return nil, fmt.Errorf("failed to generate %s: %w", spec.name, err)
+				}
+			}
+			tags := config.ResourceTags()
+			tags[TagSecretKey] = spec.key
+			arn, err := d.createSecret(spec.name, value, spec.description, tags)
+			if err != nil {
+				return nil, err
+			}
+			result.Arns[spec.key] = arn
+			result.Created = append(result.Created, spec.name)
+			continue
+		}
+
+		arn := aws.ToString(existing.ARN)
+		if existing.DeletedDate != nil {
+			if err := d.restoreSecret(spec.name, arn); err != nil {
+				return nil, err
+			}
+		}
+		result.Arns[spec.key] = arn
+
+		if value == "" {
+			fmt.Printf("Reusing secret: %s\n", spec.name)
+			result.Reused = append(result.Reused, spec.name)
+			continue
+		}
+		updated, err := d.updateSecretValue(spec.name, arn, value)
+		if err != nil {
+			return nil, err
+		}
+		if updated {
+			result.Updated = append(result.Updated, spec.name)
+		} else {
+			fmt.Printf("Reusing secret: %s\n", spec.name)
+			result.Reused = append(result.Reused, spec.name)
+		}
+	}
+
+	d.secrets = result
+	fmt.Print(result.String())
+	return result, nil
+}
+
+// findSecret describes a secret by its recorded ARN, by its name, or by the
+// service's ownership tags and its secret key, and returns nil when none of
+// them finds it.
+func (d *ECSDeployer) findSecret(config ECSConfig, spec secretSpec, knownArn string) (*secretsmanager.DescribeSecretOutput, error) {
+	describe := func(secretId string) (*secretsmanager.DescribeSecretOutput, error) {
+		output, err := d.secretsClient.DescribeSecret(d.ctx, &secretsmanager.DescribeSecretInput{
+			SecretId: aws.String(secretId),
+		})
+		if isAPIError(err, "ResourceNotFoundException") {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe secret %s: %w", spec.name, err)
+		}
+		return output, nil
+	}
+
+	for _, secretId := range []string{knownArn, spec.name} {
+		if secretId == "" {
+			continue
+		}
+		if output, err := describe(secretId); output != nil || err != nil {
+			return output, err
+		}
+	}
+
+	taggedArn, err := d.findTaggedSecret(config, spec)
+	if err != nil || taggedArn == "" {
+		return nil, err
+	}
+	return describe(taggedArn)
+}
+
+// findTaggedSecret returns the ARN of a secret carrying the service's
+// ownership tags and the spec's secret key, or "" when there is none. Secrets
+// tagged before the secret key tag existed match by their name suffix.
+func (d *ECSDeployer) findTaggedSecret(config ECSConfig, spec secretSpec) (string, error) {
+	owner := config.ownershipTags()
+	suffix := strings.TrimPrefix(spec.name, config.ServiceName)
+
+	// Filters on tag keys and tag values are independent, so the exact
+	// ownership tags are checked below
+	input := &secretsmanager.ListSecretsInput{
+		Filters: []smtypes.Filter{
+			{Key: smtypes.FilterNameStringTypeTagKey, Values: []string{TagService}},
+			{Key: smtypes.FilterNameStringTypeTagValue, Values: []string{config.ServiceName}},
+		},
+		IncludePlannedDeletion: aws.Bool(true),
+	}
+	for {
+		output, err := d.secretsClient.ListSecrets(d.ctx, input)
+		if err != nil {
+			return "", fmt.Errorf("failed to list secrets: %w", err)
+		}
+		for _, secret := range output.SecretList {
+			tags := map[string]string{}
+			for _, tag := range secret.Tags {
+				tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			owned := true
+			for tagKey, value := range owner {
+				if tags[tagKey] != value {
+					owned = false
+					break
+				}
+			}
+			if !owned {
+				continue
+			}
+			if key, tagged := tags[TagSecretKey]; tagged && key == spec.key ||
+				!tagged && strings.HasSuffix(aws.ToString(secret.Name), suffix) {
+				return aws.ToString(secret.ARN), nil
+			}
+		}
+		if output.NextToken == nil {
+			return "", nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// restoreSecret cancels the scheduled deletion of a secret, which would
+// otherwise block both its use and creating it again under the same name.
+func (d *ECSDeployer) restoreSecret(name, arn string) error {
+	_, err := d.secretsClient.RestoreSecret(d.ctx, &secretsmanager.RestoreSecretInput{
+		SecretId: aws.String(arn),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore secret %s scheduled for deletion: %w", name, err)
+	}
+	fmt.Printf("Restored secret scheduled for deletion: %s\n", name)
+	return nil
+}
+
+// updateSecretValue stores value as the secret's current version unless it
+// already is, and reports whether it changed.
+func (d *ECSDeployer) updateSecretValue(name, arn, value string) (bool, error) {
+	output, err := d.secretsClient.GetSecretValue(d.ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(arn),
+	})
+	if err != nil && !isAPIError(err, "ResourceNotFoundException") {
+		return false, fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	if err == nil && aws.ToString(output.SecretString) == value {
+		return false, nil
+	}
+
+	_, err = d.secretsClient.PutSecretValue(d.ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(arn),
+		SecretString: aws.String(value),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update secret %s: %w", name, err)
+	}
+	fmt.Printf("Updated secret: %s\n", name)
+	return true, nil
+}
+
+func (d *ECSDeployer) createSecret(name, value, description string, tags map[string]string) (string, error) {
+	input := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(name),
+		SecretString: aws.String(value),
+		Description:  aws.String(description),
+		Tags:         secretsTags(tags),
+	}
+
+	result, err := d.secretsClient.CreateSecret(d.ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create secret %s: %w", name, err)
+	}
+
+	fmt.Printf("Created secret: %s\n", name)
+	return *result.ARN, nil
+}
@@ -0,0 +1,377 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/smithy-go"
+)
+
+// Security group roles; each service gets one group per role.
+const (
+	securityGroupLoadBalancer = "alb"
+	securityGroupTask         = "task"
+	securityGroupEFS          = "efs"
+)
+
+// SecurityGroupName returns the name of the service's security group for a role.
+func SecurityGroupName(serviceName, role string) string {
+	return fmt.Sprintf("%s-%s-sg", serviceName, role)
+}
+
+// usesDedicatedSecurityGroups reports whether the deployer manages the
+// security groups instead of using the configured ones.
+func usesDedicatedSecurityGroups(config ECSConfig) bool {
+	return config.CreateSecurityGroups && len(config.SecurityGroupIds) == 0
+}
+
+// resolveNetworking fills in and validates the VPC and the subnets of the
+// load balancer and the tasks, and the security groups of the load balancer,
+// the tasks and EFS.
+func (d *ECSDeployer) resolveNetworking(config ECSConfig) (ECSConfig, error) {
+	config, err := d.autoDiscoverNetworking(config, os.Stdout)
+	if err != nil {
+		return config, fmt.Errorf("failed to auto-discover networking: %w", err)
+	}
+	if !usesDedicatedSecurityGroups(config) {
+		config.LoadBalancerSecurityGroupIds = config.SecurityGroupIds
+		config.TaskSecurityGroupIds = config.SecurityGroupIds
+		config.EFSSecurityGroupIds = config.SecurityGroupIds
+		return config, nil
+	}
+	return d.ensureSecurityGroups(config)
+}
+
+// ensureSecurityGroups creates or reuses the service's security groups: the
+// load balancer accepts 80/443 from the allowed CIDRs, the tasks accept the
+// webapp port only from the load balancer and EFS accepts NFS only from the
+// tasks.
+func (d *ECSDeployer) ensureSecurityGroups(config ECSConfig) (ECSConfig, error) {
+	fmt.Printf("Ensuring security groups for service: %s\n", config.ServiceName)
+
+	albId, err := d.ensureSecurityGroup(config, securityGroupLoadBalancer,
+		fmt.Sprintf("Load balancer of %s", config.ServiceName))
+	if err != nil {
+		return config, err
+	}
+	var albPermissions []ec2types.IpPermission
+	for _, port := range []int32{80, 443} {
+		var ranges []ec2types.IpRange
+		for _, cidr := range config.AllowedCIDRs {
+			ranges = append(ranges, ec2types.IpRange{CidrIp: aws.String(cidr), Description: aws.String("Allowed clients")})
+		}
+		albPermissions = append(albPermissions, ec2types.IpPermission{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int32(port),
+			ToPort:     aws.Int32(port),
+			IpRanges:   ranges,
+		})
+	}
+	if err := d.syncIngress(albId, albPermissions); err != nil {
+		return config, err
+	}
+
+	taskId, err := d.ensureSecurityGroup(config, securityGroupTask,
+		fmt.Sprintf("Tasks of %s", config.ServiceName))
+	if err != nil {
+		return config, err
+	}
+	if err := d.syncIngress(taskId, []ec2types.IpPermission{groupPermission(config.WebAppPort, albId, "From the load balancer")}); err != nil {
+		return config, err
+	}
+
+	config.LoadBalancerSecurityGroupIds = []string{albId}
+	config.TaskSecurityGroupIds = []string{taskId}
+	groupIds := []string{albId, taskId}
+
+	if config.CreateEFS {
+		efsId, err := d.ensureSecurityGroup(config, securityGroupEFS,
+			fmt.Sprintf("EFS of %s", config.ServiceName))
+		if err != nil {
+			return config, err
+		}
+		if err := d.syncIngress(efsId, []ec2types.IpPermission{groupPermission(2049, taskId, "NFS from the tasks")}); err != nil {
+			return config, err
+		}
+		config.EFSSecurityGroupIds = []string{efsId}
+		groupIds = append(groupIds, efsId)
+	}
+
+	d.recordState(func(state *DeploymentState) {
+		for _, id := range groupIds {
+			state.SecurityGroupIds = appendUnique(state.SecurityGroupIds, id)
+		}
+	})
+	return config, nil
+}
+
+func groupPermission(port int32, sourceGroupId, description string) ec2types.IpPermission {
+	return ec2types.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int32(port),
+		ToPort:     aws.Int32(port),
+		UserIdGroupPairs: []ec2types.UserIdGroupPair{
+			{GroupId: aws.String(sourceGroupId), Description: aws.String(description)},
+		},
+	}
+}
+
+// ensureSecurityGroup returns the ID of the service's security group for a
+// role, creating it in the VPC if it does not exist.
+func (d *ECSDeployer) ensureSecurityGroup(config ECSConfig, role, description string) (string, error) {
+	name := SecurityGroupName(config.ServiceName, role)
+	existing, err := d.findSecurityGroup(config.VpcId, name)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		fmt.Printf("Security group %s already exists, reusing it\n", name)
+		return aws.ToString(existing.GroupId), nil
+	}
+
+	tags := map[string]string{"Name": name}
+	for key, value := range config.ResourceTags() {
+		tags[key] = value
+	}
+	output, err := d.ec2Client.CreateSecurityGroup(d.ctx, &ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(name),
+		Description: aws.String(description),
+		VpcId:       aws.String(config.VpcId),
+		TagSpecifications: []ec2types.TagSpecification{
+			{ResourceType: ec2types.ResourceTypeSecurityGroup, Tags: ec2Tags(tags)},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create security group %s: %w", name, err)
+	}
+	fmt.Printf("Security group %s created: %s\n", name, aws.ToString(output.GroupId))
+	return aws.ToString(output.GroupId), nil
+}
+
+func (d *ECSDeployer) findSecurityGroup(vpcId, name string) (*ec2types.SecurityGroup, error) {
+	output, err := d.ec2Client.DescribeSecurityGroups(d.ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{vpcId}},
+			{Name: aws.String("group-name"), Values: []string{name}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe security groups: %w", err)
+	}
+	if len(output.SecurityGroups) == 0 {
+		return nil, nil
+	}
+	return &output.SecurityGroups[0], nil
+}
+
+// syncIngress makes the ingress rules of the group match the wanted ones:
+// missing rules are added and rules on the same ports from other sources are
+// revoked.
+func (d *ECSDeployer) syncIngress(groupId string, wanted []ec2types.IpPermission) error {
+	output, err := d.ec2Client.DescribeSecurityGroups(d.ctx, &ec2.DescribeSecurityGroupsInput{
+		GroupIds: []string{groupId},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe security group %s: %w", groupId, err)
+	}
+	if len(output.SecurityGroups) == 0 {
+		return fmt.Errorf("security group %s not found", groupId)
+	}
+	current := output.SecurityGroups[0].IpPermissions
+
+	var missing, stale []ec2types.IpPermission
+	for _, permission := range wanted {
+		have := permissionSources(current, aws.ToInt32(permission.FromPort))
+		want := permissionSources([]ec2types.IpPermission{permission}, aws.ToInt32(permission.FromPort))
+		add := ec2types.IpPermission{IpProtocol: permission.IpProtocol, FromPort: permission.FromPort, ToPort: permission.ToPort}
+		for _, r := range permission.IpRanges {
+			if !have[aws.ToString(r.CidrIp)] {
+				add.IpRanges = append(add.IpRanges, r)
+			}
+		}
+		for _, pair := range permission.UserIdGroupPairs {
+			if !have[aws.ToString(pair.GroupId)] {
+				add.UserIdGroupPairs = append(add.UserIdGroupPairs, pair)
+			}
+		}
+		if len(add.IpRanges) > 0 || len(add.UserIdGroupPairs) > 0 {
+			missing = append(missing, add)
+		}
+
+		for _, existing := range current {
+			if aws.ToInt32(existing.FromPort) != aws.ToInt32(permission.FromPort) {
+				continue
+			}
+			remove := ec2types.IpPermission{IpProtocol: existing.IpProtocol, FromPort: existing.FromPort, ToPort: existing.ToPort}
+			for _, r := range existing.IpRanges {
+				if !want[aws.ToString(r.CidrIp)] {
+					remove.IpRanges = append(remove.IpRanges, ec2types.IpRange{CidrIp: r.CidrIp})
+				}
+			}
+			for _, pair := range existing.UserIdGroupPairs {
+				if !want[aws.ToString(pair.GroupId)] {
+					remove.UserIdGroupPairs = append(remove.UserIdGroupPairs, ec2types.UserIdGroupPair{GroupId: pair.GroupId})
+				}
+			}
+			if len(remove.IpRanges) > 0 || len(remove.UserIdGroupPairs) > 0 {
+				stale = append(stale, remove)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		_, err := d.ec2Client.AuthorizeSecurityGroupIngress(d.ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String(groupId),
+			IpPermissions: missing,
+		})
+		if err != nil && !isAPIError(err, "InvalidPermission.Duplicate") {
+			return fmt.Errorf("failed to authorize ingress for %s: %w", groupId, err)
+		}
+	}
+	if len(stale) > 0 {
+		_, err := d.ec2Client.RevokeSecurityGroupIngress(d.ctx, &ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       aws.String(groupId),
+			IpPermissions: stale,
+		})
+		if err != nil {
+			fmt.Printf("Warning: Failed to revoke stale ingress rules of %s: %v\n", groupId, err)
+		} else {
+			fmt.Printf("Revoked %d stale ingress rules of %s\n", len(stale), groupId)
+		}
+	}
+	return nil
+}
+
+// permissionSources returns the CIDRs and security groups allowed on a port.
+func permissionSources(permissions []ec2types.IpPermission, port int32) map[string]bool {
+	sources := map[string]bool{}
+	for _, permission := range permissions {
+		if aws.ToInt32(permission.FromPort) != port {
+			continue
+		}
+		for _, r := range permission.IpRanges {
+			sources[aws.ToString(r.CidrIp)] = true
+		}
+		for _, pair := range permission.UserIdGroupPairs {
+			sources[aws.ToString(pair.GroupId)] = true
+		}
+	}
+	return sources
+}
+
+// setLoadBalancerSecurityGroups moves an existing load balancer to the
+// dedicated security group.
+func (d *ECSDeployer) setLoadBalancerSecurityGroups(loadBalancerArn string, config ECSConfig) error {
+	if !usesDedicatedSecurityGroups(config) || len(config.LoadBalancerSecurityGroupIds) == 0 {
+		return nil
+	}
+	_, err := d.elbv2Client.SetSecurityGroups(d.ctx, &elasticloadbalancingv2.SetSecurityGroupsInput{
+		LoadBalancerArn: aws.String(loadBalancerArn),
+		SecurityGroups:  config.LoadBalancerSecurityGroupIds,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set load balancer security groups: %w", err)
+	}
+	return nil
+}
+
+// updateMountTargetSecurityGroups moves the mount targets of an existing file
+// system to the given security groups.
+func (d *ECSDeployer) updateMountTargetSecurityGroups(efsId string, securityGroupIds []string) {
+	output, err := d.efsClient.DescribeMountTargets(d.ctx, &efs.DescribeMountTargetsInput{
+		FileSystemId: aws.String(efsId),
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to describe mount targets: %v\n", err)
+		return
+	}
+	for _, mountTarget := range output.MountTargets {
+		_, err := d.efsClient.ModifyMountTargetSecurityGroups(d.ctx, &efs.ModifyMountTargetSecurityGroupsInput{
+			MountTargetId:  mountTarget.MountTargetId,
+			SecurityGroups: securityGroupIds,
+		})
+		if err != nil {
+			fmt.Printf("Warning: Failed to update security groups of mount target %s: %v\n", aws.ToString(mountTarget.MountTargetId), err)
+		}
+	}
+}
+
+// deleteSecurityGroups deletes the groups once nothing uses them anymore.
+// Network interfaces of deleted tasks, load balancers and mount targets take
+// a few minutes to go away, so groups still in use are retried.
+func (d *ECSDeployer) deleteSecurityGroups(groupIds []string) error {
+	var failed []string
+	remaining := groupIds
+	deadline := time.Now().Add(10 * time.Minute)
+	for len(remaining) > 0 {
+		var inUse []string
+		for _, groupId := range remaining {
+			_, err := d.ec2Client.DeleteSecurityGroup(d.ctx, &ec2.DeleteSecurityGroupInput{
+				GroupId: aws.String(groupId),
+			})
+			switch {
+			case err == nil:
+				fmt.Printf("Security group %s deleted\n", groupId)
+			case isAPIError(err, "InvalidGroup.NotFound"):
+			case isAPIError(err, "DependencyViolation"):
+				inUse = append(inUse, groupId)
+			default:
+				failed = append(failed, fmt.Sprintf("%s: %v", groupId, err))
+			}
+		}
+		if len(inUse) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			failed = append(failed, fmt.Sprintf("still in use: %v", inUse))
+			break
+		}
+		fmt.Printf("Waiting for %d security groups to be released...\n", len(inUse))
+		time.Sleep(20 * time.Second)
+		remaining = inUse
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func isAPIError(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
+}
+
+// planSecurityGroups describes the service's security groups.
+func (d *ECSDeployer) planSecurityGroups(plan *Plan, config ECSConfig) {
+	if !usesDedicatedSecurityGroups(config) {
+		if len(config.SecurityGroupIds) > 0 {
+			plan.add("Security Group", strings.Join(config.SecurityGroupIds, ", "), PlanNoOp, "configured, used for the load balancer, tasks and EFS")
+		}
+		return
+	}
+
+	groups := []struct{ role, detail string }{
+		{securityGroupLoadBalancer, fmt.Sprintf("80/443 from %s", strings.Join(config.AllowedCIDRs, ", "))},
+		{securityGroupTask, fmt.Sprintf("%d from the load balancer", config.WebAppPort)},
+	}
+	if config.CreateEFS {
+		groups = append(groups, struct{ role, detail string }{securityGroupEFS, "2049 from the tasks"})
+	}
+	for _, group := range groups {
+		name := SecurityGroupName(config.ServiceName, group.role)
+		if existing, err := d.findSecurityGroup(config.VpcId, name); err == nil && existing != nil {
+			plan.add("Security Group", name, PlanNoOp, "exists, ingress synced to "+group.detail)
+		} else {
+			plan.add("Security Group", name, PlanCreate, "ingress "+group.detail)
+		}
+	}
+}
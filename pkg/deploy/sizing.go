@@ -0,0 +1,329 @@
+package deploy
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// FargateSize is a task-level CPU (in CPU units, 1024 per vCPU) and memory
+// (in MiB) combination.
+type FargateSize struct {
+	CPU    int32
+	Memory int32
+}
+
+func (s FargateSize) String() string {
+	return fmt.Sprintf("%d CPU / %d MiB", s.CPU, s.Memory)
+}
+
+// Fargate on-demand Linux/x86 prices in us-east-1, only used to compare sizes.
+const (
+	fargateVCPUHour = 0.04048
+	fargateGBHour   = 0.004445
+)
+
+// hourlyCost is the on-demand price of one task of this size.
+func (s FargateSize) hourlyCost() float64 {
+	return float64(s.CPU)/1024*fargateVCPUHour + float64(s.Memory)/1024*fargateGBHour
+}
+
+// fargateSizes lists the valid Fargate task sizes, cheapest CPU first.
+func fargateSizes() []FargateSize {
+	ranges := []struct {
+		cpu, minMemory, maxMemory, step int32
+	}{
+		{256, 512, 2048, 512},
+		{512, 1024, 4096, 1024},
+		{1024, 2048, 8192, 1024},
+		{2048, 4096, 16384, 1024},
+		{4096, 8192, 30720, 1024},
+		{8192, 16384, 61440, 4096},
+		{16384, 32768, 122880, 8192},
+	}
+	var sizes []FargateSize
+	for _, r := range ranges {
+		for memory := r.minMemory; memory <= r.maxMemory; memory += r.step {
+			// 256 CPU allows 512, 1024 and 2048 MiB only
+			if r.cpu == 256 && memory == 1536 {
+				continue
+			}
+			sizes = append(sizes, FargateSize{CPU: r.cpu, Memory: memory})
+		}
+	}
+	return sizes
+}
+
+func isFargateSize(size FargateSize) bool {
+	for _, valid := range fargateSizes() {
+		if valid == size {
+			return true
+		}
+	}
+	return false
+}
+
+// smallestFargateSize is the cheapest valid size with at least the given CPU
+// and memory, or false when nothing is large enough.
+func smallestFargateSize(cpu, memory float64) (FargateSize, bool) {
+	var best FargateSize
+	found := false
+	for _, size := range fargateSizes() {
+		if float64(size.CPU) < cpu || float64(size.Memory) < memory {
+			continue
+		}
+		if !found || size.hourlyCost() < best.hourlyCost() {
+			best, found = size, true
+		}
+	}
+	return best, found
+}
+
+// largestFargateSizeWithin is the most expensive valid size with at most the
+// given CPU and memory.
+func largestFargateSizeWithin(size FargateSize) (FargateSize, bool) {
+	var best FargateSize
+	found := false
+	for _, valid := range fargateSizes() {
+		if valid.CPU > size.CPU || valid.Memory > size.Memory {
+			continue
+		}
+		if !found || valid.hourlyCost() > best.hourlyCost() {
+			best, found = valid, true
+		}
+	}
+	return best, found
+}
+
+// taskSize is the task-level size: TaskCPU and TaskMemory when set, otherwise
+// the sums over the containers.
+func taskSize(config ECSConfig) FargateSize {
+	size := FargateSize{CPU: config.TaskCPU, Memory: config.TaskMemory}
+	var cpu, memory int32
+	for _, container := range config.Containers {
+		cpu += container.CPU
+		memory += container.Memory
+	}
+	if size.CPU == 0 {
+		size.CPU = cpu
+	}
+	if size.Memory == 0 {
+		size.Memory = memory
+	}
+	return size
+}
+
+// validateTaskSize checks the task size against the Fargate combinations and
+// suggests the nearest valid sizes, so an invalid config fails before
+// anything is created rather than in RegisterTaskDefinition.
+func validateTaskSize(config ECSConfig) error {
+	var containerCPU, containerMemory int32
+	for _, container := range config.Containers {
+		containerCPU += container.CPU
+		containerMemory += container.Memory
+	}
+	size := taskSize(config)
+
+	var problems []string
+	if size.CPU < containerCPU {
+		problems = append(problems, fmt.Sprintf("task_cpu %d is less than the %d CPU units of the containers", size.CPU, containerCPU))
+	}
+	if size.Memory < containerMemory {
+		problems = append(problems, fmt.Sprintf("task_memory %d is less than the %d MiB of the containers", size.Memory, containerMemory))
+	}
+	if !isFargateSize(size) {
+		var nearest []string
+		if up, ok := smallestFargateSize(float64(size.CPU), float64(size.Memory)); ok {
+			nearest = append(nearest, fmt.Sprintf("%s (fits)", up))
+		}
+		if down, ok := largestFargateSizeWithin(size); ok && down.CPU >= containerCPU && down.Memory >= containerMemory {
+			nearest = append(nearest, down.String())
+		}
+		problem := fmt.Sprintf("%s is not a valid Fargate task size", size)
+		if len(nearest) > 0 {
+			problem += "; nearest valid sizes: " + strings.Join(nearest, " or ")
+		}
+		problems = append(problems, problem+"; set aws.ecs.task_cpu and aws.ecs.task_memory or change the container sizes")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid task size:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Utilization targets for recommendations: peaks above them leave too little
+// headroom for load spikes or, for memory, risk tasks being killed.
+const (
+	cpuPeakTarget    = 0.8
+	memoryPeakTarget = 0.8
+)
+
+// Recommendation is a task size proposed from Container Insights utilization.
+type Recommendation struct {
+	ServiceName string
+	Days        int
+	Hours       int
+	Current     FargateSize
+	Recommended FargateSize
+	// Utilization of the current size in percent
+	CPUAverage    float64
+	CPUPeak       float64
+	MemoryAverage float64
+	MemoryPeak    float64
+	// ContainerCPU and ContainerMemory are what the containers reserve; a
+	// smaller task needs smaller containers
+	ContainerCPU    int32
+	ContainerMemory int32
+}
+
+func (r *Recommendation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Task size for %s, from %d hours of Container Insights data over the last %d days:\n", r.ServiceName, r.Hours, r.Days)
+	fmt.Fprintf(&b, "  Current: %s ($%.2f per task per month on demand)\n", r.Current, r.Current.hourlyCost()*730)
+	fmt.Fprintf(&b, "  CPU: %.0f%% average, %.0f%% peak\n", r.CPUAverage, r.CPUPeak)
+	fmt.Fprintf(&b, "  Memory: %.0f%% average, %.0f%% peak\n", r.MemoryAverage, r.MemoryPeak)
+
+	change := (r.Recommended.hourlyCost() - r.Current.hourlyCost()) / r.Current.hourlyCost() * 100
+	switch {
+	case r.Recommended == r.Current:
+		fmt.Fprintf(&b, "Recommendation: keep %s, its peaks stay below %.0f%% CPU and %.0f%% memory\n", r.Current, cpuPeakTarget*100, memoryPeakTarget*100)
+		return b.String()
+	case change < 0:
+		fmt.Fprintf(&b, "Recommendation: %s, about %.0f%% cheaper, with peaks still below %.0f%% CPU and %.0f%% memory\n", r.Recommended, -change, cpuPeakTarget*100, memoryPeakTarget*100)
+	default:
+		fmt.Fprintf(&b, "Recommendation: %s, about %.0f%% more expensive, because peaks above %.0f%% CPU or %.0f%% memory leave too little headroom\n", r.Recommended, change, cpuPeakTarget*100, memoryPeakTarget*100)
+	}
+	fmt.Fprintf(&b, "Apply it with aws.ecs.task_cpu: %d and aws.ecs.task_memory: %d", r.Recommended.CPU, r.Recommended.Memory)
+	if r.Recommended.CPU < r.ContainerCPU || r.Recommended.Memory < r.ContainerMemory {
+		fmt.Fprintf(&b, ", after lowering the container sizes (now %d CPU / %d MiB in total)", r.ContainerCPU, r.ContainerMemory)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Recommend proposes the cheapest Fargate size whose CPU and memory keep the
+// service's peak utilization of the last days below the targets.
+func (d *ECSDeployer) Recommend(config ECSConfig, days int) (*Recommendation, error) {
+	if days < 1 || days > 30 {
+		return nil, fmt.Errorf("days must be between 1 and 30, got %d", days)
+	}
+	service, err := d.describeService(config)
+	if err != nil {
+		return nil, err
+	}
+	taskDefinition := aws.ToString(service.TaskDefinition)
+	if primary := primaryTaskSet(service); primary != nil {
+		taskDefinition = aws.ToString(primary.TaskDefinition)
+	}
+	output, err := d.ecsClient.DescribeTaskDefinition(d.ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(taskDefinition),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe task definition: %w", err)
+	}
+	cpu, _ := strconv.Atoi(aws.ToString(output.TaskDefinition.Cpu))
+	memory, _ := strconv.Atoi(aws.ToString(output.TaskDefinition.Memory))
+
+	since := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	cpuAverage, cpuPeak, hours, err := d.serviceUtilization(config, "Cpu", since)
+	if err != nil {
+		return nil, err
+	}
+	memoryAverage, memoryPeak, _, err := d.serviceUtilization(config, "Memory", since)
+	if err != nil {
+		return nil, err
+	}
+
+	recommendation := &Recommendation{
+		ServiceName:   config.ServiceName,
+		Days:          days,
+		Hours:         hours,
+		Current:       FargateSize{CPU: int32(cpu), Memory: int32(memory)},
+		CPUAverage:    cpuAverage * 100,
+		CPUPeak:       cpuPeak * 100,
+		MemoryAverage: memoryAverage * 100,
+		MemoryPeak:    memoryPeak * 100,
+	}
+	for _, container := range config.Containers {
+		recommendation.ContainerCPU += container.CPU
+		recommendation.ContainerMemory += container.Memory
+	}
+
+	neededCPU := cpuPeak * float64(cpu) / cpuPeakTarget
+	neededMemory := memoryPeak * float64(memory) / memoryPeakTarget
+	recommended, ok := smallestFargateSize(neededCPU, neededMemory)
+	if !ok {
+		sizes := fargateSizes()
+		recommended = sizes[len(sizes)-1]
+	}
+	// Stay put when the current size is just as cheap and fits
+	if current := recommendation.Current; isFargateSize(current) && float64(current.CPU) >= neededCPU && float64(current.Memory) >= neededMemory &&
+		current.hourlyCost() <= recommended.hourlyCost() {
+		recommended = current
+	}
+	recommendation.Recommended = recommended
+	return recommendation, nil
+}
+
+// serviceUtilization reads the hourly Container Insights utilization of the
+// service for "Cpu" or "Memory" as a fraction of what its tasks reserve. It
+// returns the average and the peak over all hours with data.
+func (d *ECSDeployer) serviceUtilization(config ECSConfig, resource string, since time.Time) (average, peak float64, hours int, err error) {
+	utilized, err := d.containerInsightsMetric(config, resource+"Utilized", since)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	reserved, err := d.containerInsightsMetric(config, resource+"Reserved", since)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var sum float64
+	for hour, used := range utilized {
+		capacity, ok := reserved[hour]
+		if !ok || aws.ToFloat64(capacity.Average) <= 0 {
+			continue
+		}
+		sum += aws.ToFloat64(used.Average) / aws.ToFloat64(capacity.Average)
+		peak = math.Max(peak, aws.ToFloat64(used.Maximum)/aws.ToFloat64(capacity.Average))
+		hours++
+	}
+	if hours == 0 {
+		return 0, 0, 0, fmt.Errorf("no Container Insights %s data for service %s; enable Container Insights on cluster %s and try again once it has collected data",
+			strings.ToLower(resource), config.ServiceName, config.ClusterName)
+	}
+	return sum / float64(hours), peak, hours, nil
+}
+
+// containerInsightsMetric returns the hourly datapoints of a service metric
+// in the ECS/ContainerInsights namespace, keyed by hour.
+func (d *ECSDeployer) containerInsightsMetric(config ECSConfig, metricName string, since time.Time) (map[time.Time]cwtypes.Datapoint, error) {
+	output, err := d.cloudwatchClient.GetMetricStatistics(d.ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("ECS/ContainerInsights"),
+		MetricName: aws.String(metricName),
+		Dimensions: []cwtypes.Dimension{
+			{Name: aws.String("ClusterName"), Value: aws.String(config.ClusterName)},
+			{Name: aws.String("ServiceName"), Value: aws.String(config.ServiceName)},
+		},
+		StartTime:  aws.Time(since.Truncate(time.Hour)),
+		EndTime:    aws.Time(time.Now()),
+		Period:     aws.Int32(3600),
+		Statistics: []cwtypes.Statistic{cwtypes.StatisticAverage, cwtypes.StatisticMaximum},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", metricName, err)
+	}
+
+	datapoints := map[time.Time]cwtypes.Datapoint{}
+	for _, datapoint := range output.Datapoints {
+		datapoints[aws.ToTime(datapoint.Timestamp)] = datapoint
+	}
+	return datapoints, nil
+}
@@ -0,0 +1,415 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	StateBackendLocal = "local"
+	StateBackendS3    = "s3"
+
+	defaultStatePath = ".opsagents/state"
+)
+
+// StateConfig selects where deployment state is stored.
+type StateConfig struct {
+	Backend  string
+	Path     string
+	S3Bucket string
+	S3Prefix string
+}
+
+// DeploymentState records the resources created for one service in one
+// environment, so later deploys and cleanups act on what actually exists
+// instead of guessing names.
+type DeploymentState struct {
+	Service     string `json:"service"`
+	Environment string `json:"environment"`
+	// DeploymentId is the ID of the last deployment that created or updated the service
+	DeploymentId string `json:"deployment_id,omitempty"`
+
+	ClusterName       string            `json:"cluster_name,omitempty"`
+	ServiceArn        string            `json:"service_arn,omitempty"`
+	TaskDefinitionArn string            `json:"task_definition_arn,omitempty"`
+	LoadBalancerArn   string            `json:"load_balancer_arn,omitempty"`
+	TargetGroupArn    string            `json:"target_group_arn,omitempty"`
+	ListenerArn       string            `json:"listener_arn,omitempty"`
+	LogGroups         []string          `json:"log_groups,omitempty"`
+	Secrets           map[string]string `json:"secrets,omitempty"`
+	EFSFileSystemId   string            `json:"efs_file_system_id,omitempty"`
+	EFSMountTargetIds []string          `json:"efs_mount_target_ids,omitempty"`
+	// AlternateTargetGroupArn is the green target group of blue/green deployments
+	AlternateTargetGroupArn string `json:"alternate_target_group_arn,omitempty"`
+	// CertificateArn is set only for ACM certificates requested by a deployment
+	CertificateArn string `json:"certificate_arn,omitempty"`
+	// DNSRecordName is the alias record pointing at the load balancer
+	DNSRecordName   string `json:"dns_record_name,omitempty"`
+	DNSHostedZoneId string `json:"dns_hosted_zone_id,omitempty"`
+	// SecurityGroupIds are the dedicated groups of the load balancer, tasks and EFS
+	SecurityGroupIds []string `json:"security_group_ids,omitempty"`
+	// IAMRoles are the execution and task roles created by a deployment
+	IAMRoles []string `json:"iam_roles,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsEmpty reports whether no resources have been recorded.
+func (s *DeploymentState) IsEmpty() bool {
+	return s.ServiceArn == "" && s.TaskDefinitionArn == "" && s.LoadBalancerArn == "" &&
+		s.TargetGroupArn == "" && s.ListenerArn == "" && len(s.Secrets) == 0 &&
+		s.EFSFileSystemId == "" && len(s.LogGroups) == 0 &&
+		s.AlternateTargetGroupArn == "" && s.CertificateArn == "" && s.DNSRecordName == "" &&
+		len(s.SecurityGroupIds) == 0 && len(s.IAMRoles) == 0
+}
+
+// Summary lists the recorded resources.
+func (s *DeploymentState) Summary() string {
+	if s.IsEmpty() {
+		return fmt.Sprintf("No resources recorded for %s in %s", s.Service, s.Environment)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Tracked resources for %s in %s (updated %s):\n", s.Service, s.Environment, s.UpdatedAt.Format(time.RFC3339))
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "  - %s: %s\n", name, value)
+		}
+	}
+	field("Deployment", s.DeploymentId)
+	field("Cluster", s.ClusterName)
+	field("Service", s.ServiceArn)
+	field("Task Definition", s.TaskDefinitionArn)
+	field("Load Balancer", s.LoadBalancerArn)
+	field("Target Group", s.TargetGroupArn)
+	field("Alternate Target Group", s.AlternateTargetGroupArn)
+	field("Listener", s.ListenerArn)
+	field("Certificate", s.CertificateArn)
+	field("Security Groups", strings.Join(s.SecurityGroupIds, ", "))
+	field("IAM Roles", strings.Join(s.IAMRoles, ", "))
+	if s.DNSRecordName != "" {
+		field("DNS Record", fmt.Sprintf("%s (zone %s)", s.DNSRecordName, s.DNSHostedZoneId))
+	}
+	field("Log Groups", strings.Join(s.LogGroups, ", "))
+	field("EFS File System", s.EFSFileSystemId)
+	field("EFS Mount Targets", strings.Join(s.EFSMountTargetIds, ", "))
+
+	keys := make([]string, 0, len(s.Secrets))
+	for key := range s.Secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field("Secret "+key, s.Secrets[key])
+	}
+	return b.String()
+}
+
+// SecretArns returns the recorded secret ARNs in a stable order.
+func (s *DeploymentState) SecretArns() []string {
+	arns := make([]string, 0, len(s.Secrets))
+	for _, arn := range s.Secrets {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	return arns
+}
+
+func (s *DeploymentState) addLogGroup(name string) {
+	for _, existing := range s.LogGroups {
+		if existing == name {
+			return
+		}
+	}
+	s.LogGroups = append(s.LogGroups, name)
+}
+
+// StateStore persists deployment state.
+type StateStore interface {
+	// Load returns the stored state, or an empty state if there is none
+	Load(ctx context.Context, service, environment string) (*DeploymentState, error)
+	Save(ctx context.Context, state *DeploymentState) error
+	Delete(ctx context.Context, service, environment string) error
+}
+
+// NewStateStore creates the store selected by the state config.
+func NewStateStore(config StateConfig, awsConfig aws.Config) (StateStore, error) {
+	switch config.Backend {
+	case "", StateBackendLocal:
+		path := config.Path
+		if path == "" {
+			path = defaultStatePath
+		}
+		return &FileStateStore{Dir: path}, nil
+	case StateBackendS3:
+		if config.S3Bucket == "" {
+			return nil, fmt.Errorf("state.s3_bucket must be set for the s3 state backend")
+		}
+		return &S3StateStore{
+			client: s3.NewFromConfig(awsConfig),
+			bucket: config.S3Bucket,
+			prefix: config.S3Prefix,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown state backend %q (expected %s or %s)", config.Backend, StateBackendLocal, StateBackendS3)
+	}
+}
+
+func stateKey(service, environment string) string {
+	return fmt.Sprintf("%s/%s.json", environment, service)
+}
+
+func newDeploymentState(service, environment string) *DeploymentState {
+	return &DeploymentState{Service: service, Environment: environment, Secrets: map[string]string{}}
+}
+
+func decodeState(data []byte, service, environment string) (*DeploymentState, error) {
+	state := newDeploymentState(service, environment)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state for %s: %w", service, err)
+	}
+	if state.Secrets == nil {
+		state.Secrets = map[string]string{}
+	}
+	return state, nil
+}
+
+// FileStateStore keeps one JSON file per service and environment.
+type FileStateStore struct {
+	Dir string
+}
+
+func (f *FileStateStore) path(service, environment string) string {
+	return filepath.Join(f.Dir, filepath.FromSlash(stateKey(service, environment)))
+}
+
+func (f *FileStateStore) Load(_ context.Context, service, environment string) (*DeploymentState, error) {
+	data, err := os.ReadFile(f.path(service, environment))
+	if errors.Is(err, os.ErrNotExist) {
+		return newDeploymentState(service, environment), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	return decodeState(data, service, environment)
+}
+
+func (f *FileStateStore) Save(_ context.Context, state *DeploymentState) error {
+	path := f.path(state.Service, state.Environment)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	// Write to a temporary file first so an interrupted save keeps the old state
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+func (f *FileStateStore) Delete(_ context.Context, service, environment string) error {
+	err := os.Remove(f.path(service, environment))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete state file: %w", err)
+	}
+	return nil
+}
+
+// S3StateStore keeps the state files in an S3 bucket so a team or CI shares them.
+type S3StateStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *S3StateStore) key(service, environment string) string {
+	key := stateKey(service, environment)
+	if s.prefix != "" {
+		key = strings.TrimSuffix(s.prefix, "/") + "/" + key
+	}
+	return key
+}
+
+func (s *S3StateStore) Load(ctx context.Context, service, environment string) (*DeploymentState, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(service, environment)),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return newDeploymentState(service, environment), nil
+		}
+		return nil, fmt.Errorf("failed to read state from s3://%s: %w", s.bucket, err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state from s3://%s: %w", s.bucket, err)
+	}
+	return decodeState(data, service, environment)
+}
+
+func (s *S3StateStore) Save(ctx context.Context, state *DeploymentState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(s.key(state.Service, state.Environment)),
+		Body:                 bytes.NewReader(data),
+		ContentType:          aws.String("application/json"),
+		ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write state to s3://%s: %w", s.bucket, err)
+	}
+	return nil
+}
+
+func (s *S3StateStore) Delete(ctx context.Context, service, environment string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(service, environment)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete state from s3://%s: %w", s.bucket, err)
+	}
+	return nil
+}
+
+// LoadState returns the recorded state of the configured service.
+func (d *ECSDeployer) LoadState(config ECSConfig) (*DeploymentState, error) {
+	if err := d.beginState(config); err != nil {
+		return nil, err
+	}
+	return d.state, nil
+}
+
+// beginState loads the state of the configured service unless it is already
+// loaded, so every deploy step records into the same state.
+func (d *ECSDeployer) beginState(config ECSConfig) error {
+	if d.state != nil && d.state.Service == config.ServiceName && d.state.Environment == config.EnvironmentName {
+		return nil
+	}
+
+	if d.stateStore == nil {
+		store, err := NewStateStore(config.State, d.awsConfig)
+		if err != nil {
+			return fmt.Errorf("failed to open state store: %w", err)
+		}
+		d.stateStore = store
+	}
+
+	state, err := d.stateStore.Load(d.ctx, config.ServiceName, config.EnvironmentName)
+	if err != nil {
+		return fmt.Errorf("failed to load deployment state: %w", err)
+	}
+	d.state = state
+	return nil
+}
+
+// recordState applies update to the loaded state and saves it right away, so
+// a failed deployment still leaves a record of what was created.
+func (d *ECSDeployer) recordState(update func(state *DeploymentState)) {
+	if d.state == nil {
+		return
+	}
+
+	update(d.state)
+	d.state.UpdatedAt = time.Now().UTC()
+	if err := d.stateStore.Save(d.ctx, d.state); err != nil {
+		fmt.Printf("Warning: Failed to save deployment state: %v\n", err)
+	}
+}
+
+// recoverLoadBalancerState looks up the load balancer and target group of an
+// existing service when the deployment state does not have them, e.g. when
+// deploying from another machine or for a service deployed before state was
+// kept, and records what it finds.
+func (d *ECSDeployer) recoverLoadBalancerState(config ECSConfig, service types.Service) {
+	if d.state.LoadBalancerArn == "" {
+		loadBalancer, err := d.findLoadBalancer(config.ServiceName)
+		if err != nil {
+			fmt.Printf("Warning: %v; load balancer updates are skipped\n", err)
+		} else {
+			fmt.Printf("Load balancer not in deployment state, found %s\n", aws.ToString(loadBalancer.LoadBalancerName))
+			d.recordState(func(state *DeploymentState) {
+				state.LoadBalancerArn = aws.ToString(loadBalancer.LoadBalancerArn)
+			})
+		}
+	}
+
+	if d.state.TargetGroupArn == "" {
+		targetGroupArn := ""
+		if len(service.LoadBalancers) > 0 {
+			targetGroupArn = aws.ToString(service.LoadBalancers[0].TargetGroupArn)
+		}
+		if targetGroupArn == "" {
+			targetGroup, err := d.describeTargetGroup(BlueTargetGroupName(config.ServiceName))
+			if err != nil {
+				fmt.Printf("Warning: Failed to look up target group: %v\n", err)
+			} else if targetGroup != nil {
+				targetGroupArn = aws.ToString(targetGroup.TargetGroupArn)
+			}
+		}
+		if targetGroupArn == "" {
+			fmt.Printf("Warning: target group for %s not found; listener and scaling updates are skipped\n", config.ServiceName)
+			return
+		}
+		fmt.Printf("Target group not in deployment state, found %s\n", targetGroupArn)
+		d.recordState(func(state *DeploymentState) {
+			state.TargetGroupArn = targetGroupArn
+		})
+	}
+}
+
+// recordTaskDefinition records a registered task definition and its log groups.
+func (d *ECSDeployer) recordTaskDefinition(config ECSConfig, taskDefinition *types.TaskDefinition) {
+	if taskDefinition == nil {
+		return
+	}
+	d.recordState(func(state *DeploymentState) {
+		state.TaskDefinitionArn = aws.ToString(taskDefinition.TaskDefinitionArn)
+		for _, logGroup := range containerLogGroups(config) {
+			state.addLogGroup(logGroup)
+		}
+	})
+}
+
+// forgetState removes the state after a cleanup.
+func (d *ECSDeployer) forgetState(config ECSConfig) {
+	if d.stateStore == nil {
+		return
+	}
+	if err := d.stateStore.Delete(d.ctx, config.ServiceName, config.EnvironmentName); err != nil {
+		fmt.Printf("Warning: Failed to delete deployment state: %v\n", err)
+	}
+	d.state = nil
+}
@@ -0,0 +1,36 @@
+package deploy
+
+import "testing"
+
+func TestDeploymentStateIsEmpty(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(state *DeploymentState)
+		want   bool
+	}{
+		{"new state", func(state *DeploymentState) {}, true},
+		{"service", func(state *DeploymentState) { state.ServiceArn = "arn:service" }, false},
+		{"task definition", func(state *DeploymentState) { state.TaskDefinitionArn = "arn:task" }, false},
+		{"load balancer", func(state *DeploymentState) { state.LoadBalancerArn = "arn:alb" }, false},
+		{"target group", func(state *DeploymentState) { state.TargetGroupArn = "arn:tg" }, false},
+		{"alternate target group", func(state *DeploymentState) { state.AlternateTargetGroupArn = "arn:tg-green" }, false},
+		{"listener", func(state *DeploymentState) { state.ListenerArn = "arn:listener" }, false},
+		{"log group", func(state *DeploymentState) { state.addLogGroup("/ecs/api") }, false},
+		{"secret", func(state *DeploymentState) { state.Secrets["DB_SECRET_ARN"] = "arn:db" }, false},
+		{"file system", func(state *DeploymentState) { state.EFSFileSystemId = "fs-1" }, false},
+		{"certificate", func(state *DeploymentState) { state.CertificateArn = "arn:cert" }, false},
+		{"dns record", func(state *DeploymentState) { state.DNSRecordName = "api.example.com" }, false},
+		{"security group", func(state *DeploymentState) { state.SecurityGroupIds = []string{"sg-1"} }, false},
+		{"iam role", func(state *DeploymentState) { state.IAMRoles = []string{"api-execution-role"} }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newDeploymentState("api", "staging")
+			tt.record(state)
+			if got := state.IsEmpty(); got != tt.want {
+				t.Errorf("IsEmpty() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
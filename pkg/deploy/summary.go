@@ -0,0 +1,92 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeploymentSummary lists the resources a deployment creates or updates.
+func DeploymentSummary(config ECSConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "This will create or update the following resources:\n")
+	fmt.Fprintf(&b, "  - ECS Cluster: %s (created if missing)\n", config.ClusterName)
+	fmt.Fprintf(&b, "  - Task Definition: %s (new revision)\n", config.TaskDefinitionName)
+	for _, container := range config.Containers {
+		fmt.Fprintf(&b, "    - %s: %s\n", container.Name, container.Image)
+	}
+	fmt.Fprintf(&b, "  - ECS Service: %s (created, or updated to the new revision; %s)\n", config.ServiceName, capacityLabel(config))
+	fmt.Fprintf(&b, "  - Load Balancer: %s-alb (created with a new service)\n", config.ServiceName)
+	if usesDedicatedSecurityGroups(config) {
+		fmt.Fprintf(&b, "  - Security Groups: %s, %s", SecurityGroupName(config.ServiceName, securityGroupLoadBalancer), SecurityGroupName(config.ServiceName, securityGroupTask))
+		if config.CreateEFS {
+			fmt.Fprintf(&b, ", %s", SecurityGroupName(config.ServiceName, securityGroupEFS))
+		}
+		fmt.Fprintf(&b, " (created if missing)\n")
+	}
+	if config.DeploymentStrategy == DeploymentBlueGreen || config.DeploymentStrategy == DeploymentCanary {
+		fmt.Fprintf(&b, "  - Target Groups: %s and %s (blue/green; %s)\n", BlueTargetGroupName(config.ServiceName), GreenTargetGroupName(config.ServiceName), targetGroupSettingsLabel(config))
+		fmt.Fprintf(&b, "  - ECS Task Set: new revision behind the idle target group; traffic moves once it is healthy\n")
+	} else {
+		fmt.Fprintf(&b, "  - Target Group: %s-tg (%s; created if missing, otherwise updated or replaced)\n", config.ServiceName, targetGroupSettingsLabel(config))
+	}
+	if config.HTTPS.Enabled {
+		certificate := config.HTTPS.CertificateArn
+		if certificate == "" {
+			certificate = fmt.Sprintf("ACM certificate for %s (requested if missing)", config.HTTPS.DomainName)
+		}
+		fmt.Fprintf(&b, "  - HTTPS Listener: %s-alb:443 with %s\n", config.ServiceName, certificate)
+		if redirectsHTTP(config) {
+			fmt.Fprintf(&b, "  - HTTP Listener: %s-alb:80 redirecting to HTTPS\n", config.ServiceName)
+		}
+	}
+	if config.DNS.Enabled {
+		fmt.Fprintf(&b, "  - DNS Record: %s (alias to the load balancer in %s)\n", config.DNS.RecordName, config.DNS.HostedZoneId)
+	}
+	if config.Scaling.Enabled {
+		fmt.Fprintf(&b, "  - Auto Scaling: %s\n", scalingLabel(config))
+	}
+	fmt.Fprintf(&b, "  - CloudWatch Log Groups: %s\n", strings.Join(containerLogGroups(config), ", "))
+	if config.IAM.CreateRoles {
+		fmt.Fprintf(&b, "  - IAM Roles: %s, %s (created if missing, policies synced)\n", ExecutionRoleName(config), TaskRoleName(config))
+	}
+	if config.CreateSecrets {
+		fmt.Fprintf(&b, "  - Secrets Manager secrets: %s-*\n", config.ServiceName)
+	}
+	if config.CreateEFS && config.EFSVolumeId == "" {
+		fmt.Fprintf(&b, "  - EFS file system: %s-efs with mount targets\n", config.ServiceName)
+	}
+	return b.String()
+}
+
+// CleanupSummary lists the resources Cleanup deletes.
+func CleanupSummary(config ECSConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "This will delete the following resources:\n")
+	fmt.Fprintf(&b, "  - ECS Service: %s and its auto scaling policies\n", config.ServiceName)
+	fmt.Fprintf(&b, "  - ECS Cluster: %s (if empty)\n", config.ClusterName)
+	fmt.Fprintf(&b, "  - Task Definition: %s (all revisions)\n", config.TaskDefinitionName)
+	fmt.Fprintf(&b, "  - Load Balancer and Target Groups\n")
+	if config.DNS.Enabled {
+		fmt.Fprintf(&b, "  - DNS Record: %s, if it still points at the load balancer\n", config.DNS.RecordName)
+	}
+	fmt.Fprintf(&b, "  - CloudWatch Log Groups\n")
+	if config.HTTPS.Enabled && config.HTTPS.CertificateArn == "" {
+		fmt.Fprintf(&b, "  - ACM certificate for %s, if a deployment requested it\n", config.HTTPS.DomainName)
+	}
+	if config.CreateSecrets {
+		fmt.Fprintf(&b, "  - Secrets Manager secrets: %s-* (deleted immediately, without recovery)\n", config.ServiceName)
+	}
+	if config.CreateEFS {
+		fmt.Fprintf(&b, "  - EFS file system and ALL DATA on it\n")
+	}
+	if config.IAM.CreateRoles {
+		fmt.Fprintf(&b, "  - IAM Roles: %s, %s, if this service created them\n", ExecutionRoleName(config), TaskRoleName(config))
+	}
+	if usesDedicatedSecurityGroups(config) {
+		fmt.Fprintf(&b, "  - Security Groups: %s-*-sg, once nothing uses them\n", config.ServiceName)
+	}
+	fmt.Fprintf(&b, "Resources are found through the deployment state and the tags %s=%s, %s=%s, %s=%s;\n",
+		TagManagedBy, ManagedByValue, TagService, config.ServiceName, TagEnvironment, config.EnvironmentName)
+	fmt.Fprintf(&b, "names such as %s-alb are only used for deployments made before tagging.\n", config.ServiceName)
+	return b.String()
+}
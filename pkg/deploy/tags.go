@@ -0,0 +1,122 @@
+package deploy
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	acmtypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	efstypes "github.com/aws/aws-sdk-go-v2/service/efs/types"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Tags applied to every resource a deployment creates. Inventory and Cleanup
+// find resources by these tags instead of by name.
+const (
+	TagManagedBy    = "managed-by"
+	TagService      = "service"
+	TagEnvironment  = "environment"
+	TagDeploymentId = "deployment-id"
+
+	ManagedByValue = "opsagents"
+)
+
+// NewDeploymentId returns an ID for one deployment run.
+func NewDeploymentId() string {
+	return time.Now().UTC().Format("20060102-150405")
+}
+
+// ResourceTags returns the tags for resources created by this deployment. The
+// user-defined tags from the config cannot override the ownership tags.
+func (c ECSConfig) ResourceTags() map[string]string {
+	tags := make(map[string]string, len(c.Tags)+4)
+	for key, value := range c.Tags {
+		tags[key] = value
+	}
+	tags[TagManagedBy] = ManagedByValue
+	tags[TagService] = c.ServiceName
+	tags[TagEnvironment] = c.EnvironmentName
+	if c.DeploymentId != "" {
+		tags[TagDeploymentId] = c.DeploymentId
+	}
+	return tags
+}
+
+// ownershipTags returns the tags that identify the resources of this service
+// in this environment.
+func (c ECSConfig) ownershipTags() map[string]string {
+	return map[string]string{
+		TagManagedBy:   ManagedByValue,
+		TagService:     c.ServiceName,
+		TagEnvironment: c.EnvironmentName,
+	}
+}
+
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func ecsTags(tags map[string]string) []types.Tag {
+	var result []types.Tag
+	for _, key := range sortedTagKeys(tags) {
+		result = append(result, types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return result
+}
+
+func elbv2Tags(tags map[string]string) []elbv2types.Tag {
+	var result []elbv2types.Tag
+	for _, key := range sortedTagKeys(tags) {
+		result = append(result, elbv2types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return result
+}
+
+func secretsTags(tags map[string]string) []smtypes.Tag {
+	var result []smtypes.Tag
+	for _, key := range sortedTagKeys(tags) {
+		result = append(result, smtypes.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return result
+}
+
+func efsTags(tags map[string]string) []efstypes.Tag {
+	var result []efstypes.Tag
+	for _, key := range sortedTagKeys(tags) {
+		result = append(result, efstypes.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return result
+}
+
+func acmTags(tags map[string]string) []acmtypes.Tag {
+	var result []acmtypes.Tag
+	for _, key := range sortedTagKeys(tags) {
+		result = append(result, acmtypes.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return result
+}
+
+func ec2Tags(tags map[string]string) []ec2types.Tag {
+	var result []ec2types.Tag
+	for _, key := range sortedTagKeys(tags) {
+		result = append(result, ec2types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return result
+}
+
+func iamTags(tags map[string]string) []iamtypes.Tag {
+	var result []iamtypes.Tag
+	for _, key := range sortedTagKeys(tags) {
+		result = append(result, iamtypes.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return result
+}
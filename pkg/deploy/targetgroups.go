@@ -0,0 +1,544 @@
+package deploy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	appconfig "opsagents/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// TargetGroupConfig configures the health checks and attributes of the
+// service's target groups.
+type TargetGroupConfig struct {
+	HealthCheckPath string
+	// Matcher is the HTTP codes of a healthy response, e.g. 200 or 200-299
+	Matcher            string
+	Interval           int32 // seconds
+	Timeout            int32 // seconds
+	HealthyThreshold   int32
+	UnhealthyThreshold int32
+	// DeregistrationDelay is how long draining targets keep their requests,
+	// SlowStart how long new targets ramp up; both in seconds, 0 disables
+	DeregistrationDelay int32
+	SlowStart           int32
+	// Stickiness pins clients to a target with a load balancer cookie
+	Stickiness         bool
+	StickinessDuration int32 // seconds
+}
+
+func targetGroupConfig(cfg *appconfig.Config) TargetGroupConfig {
+	targetGroup := cfg.AWS.ECS.TargetGroup
+	return TargetGroupConfig{
+		HealthCheckPath:     targetGroup.HealthCheckPath,
+		Matcher:             targetGroup.Matcher,
+		Interval:            targetGroup.Interval,
+		Timeout:             targetGroup.Timeout,
+		HealthyThreshold:    targetGroup.HealthyThreshold,
+		UnhealthyThreshold:  targetGroup.UnhealthyThreshold,
+		DeregistrationDelay: targetGroup.DeregistrationDelay,
+		SlowStart:           targetGroup.SlowStart,
+		Stickiness:          targetGroup.Stickiness,
+		StickinessDuration:  targetGroup.StickinessDuration,
+	}
+}
+
+var matcherPattern = regexp.MustCompile(`^\d{3}(-\d{3})?(,\d{3}(-\d{3})?)*$`)
+
+// validateTargetGroup checks the settings against the limits of Application
+// Load Balancer target groups.
+func validateTargetGroup(config ECSConfig) error {
+	settings := config.TargetGroup
+	var problems []string
+	if !strings.HasPrefix(settings.HealthCheckPath, "/") {
+		problems = append(problems, fmt.Sprintf("health_check_path %q must start with /", settings.HealthCheckPath))
+	}
+	if !matcherPattern.MatchString(settings.Matcher) {
+		problems = append(problems, fmt.Sprintf("matcher %q must be HTTP codes like 200, 200-299 or 200,302", settings.Matcher))
+	}
+	if settings.Interval < 5 || settings.Interval > 300 {
+		problems = append(problems, fmt.Sprintf("interval %d must be between 5 and 300 seconds", settings.Interval))
+	}
+	if settings.Timeout < 2 || settings.Timeout > 120 {
+		problems = append(problems, fmt.Sprintf("timeout %d must be between 2 and 120 seconds", settings.Timeout))
+	} else if settings.Timeout >= settings.Interval {
+		problems = append(problems, fmt.Sprintf("timeout %d must be shorter than the interval of %d seconds", settings.Timeout, settings.Interval))
+	}
+	if settings.HealthyThreshold < 2 || settings.HealthyThreshold > 10 {
+		problems = append(problems, fmt.Sprintf("healthy_threshold %d must be between 2 and 10", settings.HealthyThreshold))
+	}
+	if settings.UnhealthyThreshold < 2 || settings.UnhealthyThreshold > 10 {
+		problems = append(problems, fmt.Sprintf("unhealthy_threshold %d must be between 2 and 10", settings.UnhealthyThreshold))
+	}
+	if settings.DeregistrationDelay < 0 || settings.DeregistrationDelay > 3600 {
+		problems = append(problems, fmt.Sprintf("deregistration_delay %d must be between 0 and 3600 seconds", settings.DeregistrationDelay))
+	}
+	if settings.SlowStart != 0 && (settings.SlowStart < 30 || settings.SlowStart > 900) {
+		problems = append(problems, fmt.Sprintf("slow_start %d must be 0 or between 30 and 900 seconds", settings.SlowStart))
+	}
+	if settings.Stickiness && (settings.StickinessDuration < 1 || settings.StickinessDuration > 604800) {
+		problems = append(problems, fmt.Sprintf("stickiness_duration %d must be between 1 and 604800 seconds", settings.StickinessDuration))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid target group settings:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// targetGroupAttributes are the attributes the target groups should have.
+func targetGroupAttributes(config ECSConfig) map[string]string {
+	settings := config.TargetGroup
+	attributes := map[string]string{
+		"deregistration_delay.timeout_seconds": strconv.Itoa(int(settings.DeregistrationDelay)),
+		"slow_start.duration_seconds":          strconv.Itoa(int(settings.SlowStart)),
+		"stickiness.enabled":                   strconv.FormatBool(settings.Stickiness),
+	}
+	if settings.Stickiness {
+		attributes["stickiness.type"] = "lb_cookie"
+		attributes["stickiness.lb_cookie.duration_seconds"] = strconv.Itoa(int(settings.StickinessDuration))
+	}
+	return attributes
+}
+
+// targetGroupSettingsLabel describes the configured target group for plans
+// and summaries.
+func targetGroupSettingsLabel(config ECSConfig) string {
+	settings := config.TargetGroup
+	label := fmt.Sprintf("HTTP:%d, health check %s (%s) every %ds", config.WebAppPort, settings.HealthCheckPath, settings.Matcher, settings.Interval)
+	if settings.Stickiness {
+		label += fmt.Sprintf(", sticky for %ds", settings.StickinessDuration)
+	}
+	if settings.SlowStart > 0 {
+		label += fmt.Sprintf(", slow start %ds", settings.SlowStart)
+	}
+	return label
+}
+
+// targetGroupReplacements lists the differences of an existing target group
+// that cannot be modified in place.
+func targetGroupReplacements(config ECSConfig, group elbv2types.TargetGroup) []string {
+	var differences []string
+	if port := aws.ToInt32(group.Port); port != config.WebAppPort {
+		differences = append(differences, fmt.Sprintf("port %d -> %d", port, config.WebAppPort))
+	}
+	if group.Protocol != elbv2types.ProtocolEnumHttp {
+		differences = append(differences, fmt.Sprintf("protocol %s -> HTTP", group.Protocol))
+	}
+	if group.TargetType != elbv2types.TargetTypeEnumIp {
+		differences = append(differences, fmt.Sprintf("target type %s -> ip", group.TargetType))
+	}
+	if vpcId := aws.ToString(group.VpcId); config.VpcId != "" && vpcId != config.VpcId {
+		differences = append(differences, fmt.Sprintf("VPC %s -> %s", vpcId, config.VpcId))
+	}
+	return differences
+}
+
+// healthCheckDifferences lists the health check settings of an existing
+// target group that differ from the config.
+func healthCheckDifferences(config ECSConfig, group elbv2types.TargetGroup) []string {
+	settings := config.TargetGroup
+	var differences []string
+	compare := func(name string, current, desired any) {
+		if current != desired {
+			differences = append(differences, fmt.Sprintf("%s %v -> %v", name, current, desired))
+		}
+	}
+	matcher := ""
+	if group.Matcher != nil {
+		matcher = aws.ToString(group.Matcher.HttpCode)
+	}
+	compare("health check path", aws.ToString(group.HealthCheckPath), settings.HealthCheckPath)
+	compare("health check protocol", string(group.HealthCheckProtocol), string(elbv2types.ProtocolEnumHttp))
+	compare("health check port", aws.ToString(group.HealthCheckPort), "traffic-port")
+	compare("matcher", matcher, settings.Matcher)
+	compare("interval", aws.ToInt32(group.HealthCheckIntervalSeconds), settings.Interval)
+	compare("timeout", aws.ToInt32(group.HealthCheckTimeoutSeconds), settings.Timeout)
+	compare("healthy threshold", aws.ToInt32(group.HealthyThresholdCount), settings.HealthyThreshold)
+	compare("unhealthy threshold", aws.ToInt32(group.UnhealthyThresholdCount), settings.UnhealthyThreshold)
+	return differences
+}
+
+// attributeDifferences lists the attributes that differ from the config.
+func attributeDifferences(config ECSConfig, current map[string]string) []string {
+	desired := targetGroupAttributes(config)
+	var differences []string
+	for _, key := range sortedTagKeys(desired) {
+		if current[key] != desired[key] {
+			differences = append(differences, fmt.Sprintf("%s %s -> %s", key, current[key], desired[key]))
+		}
+	}
+	return differences
+}
+
+// describeTargetGroup returns the named target group, or nil if it does not
+// exist.
+func (d *ECSDeployer) describeTargetGroup(name string) (*elbv2types.TargetGroup, error) {
+	output, err := d.elbv2Client.DescribeTargetGroups(d.ctx, &elasticloadbalancingv2.DescribeTargetGroupsInput{
+		Names: []string{name},
+	})
+	if isAPIError(err, "TargetGroupNotFound") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe target group %s: %w", name, err)
+	}
+	if len(output.TargetGroups) == 0 {
+		return nil, nil
+	}
+	return &output.TargetGroups[0], nil
+}
+
+func (d *ECSDeployer) describeTargetGroupAttributes(targetGroupArn string) (map[string]string, error) {
+	output, err := d.elbv2Client.DescribeTargetGroupAttributes(d.ctx, &elasticloadbalancingv2.DescribeTargetGroupAttributesInput{
+		TargetGroupArn: aws.String(targetGroupArn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe target group attributes: %w", err)
+	}
+	attributes := map[string]string{}
+	for _, attribute := range output.Attributes {
+		attributes[aws.ToString(attribute.Key)] = aws.ToString(attribute.Value)
+	}
+	return attributes, nil
+}
+
+// ensureTargetGroup creates the named target group or brings the health check
+// and attributes of an existing one in line with the config. Port, protocol,
+// target type and VPC cannot change in place: an unused group is recreated,
+// for one in use the differences are returned so the caller can move traffic
+// to a replacement.
+func (d *ECSDeployer) ensureTargetGroup(config ECSConfig, name string) (*elbv2types.TargetGroup, []string, error) {
+	if err := validateTargetGroup(config); err != nil {
+		return nil, nil, err
+	}
+
+	existing, err := d.describeTargetGroup(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing == nil {
+		group, err := d.createTargetGroup(config, name)
+		return group, nil, err
+	}
+
+	replace := targetGroupReplacements(config, *existing)
+	if len(replace) > 0 && len(existing.LoadBalancerArns) == 0 {
+		fmt.Printf("Target group %s differs in %s and is not in use, recreating it\n", name, strings.Join(replace, ", "))
+		if err := d.deleteTargetGroup(aws.ToString(existing.TargetGroupArn)); err != nil {
+			return nil, nil, err
+		}
+		group, err := d.createTargetGroup(config, name)
+		return group, nil, err
+	}
+
+	if err := d.syncTargetGroup(config, *existing); err != nil {
+		return nil, nil, err
+	}
+	if len(replace) > 0 {
+		fmt.Printf("Target group %s differs in %s and is in use, it needs a replacement\n", name, strings.Join(replace, ", "))
+	}
+	return existing, replace, nil
+}
+
+func (d *ECSDeployer) createTargetGroup(config ECSConfig, name string) (*elbv2types.TargetGroup, error) {
+	fmt.Printf("Creating target group %s for service: %s\n", name, config.ServiceName)
+
+	settings := config.TargetGroup
+	output, err := d.elbv2Client.CreateTargetGroup(d.ctx, &elasticloadbalancingv2.CreateTargetGroupInput{
+		Name:                       aws.String(name),
+		Protocol:                   elbv2types.ProtocolEnumHttp,
+		Port:                       aws.Int32(config.WebAppPort),
+		VpcId:                      aws.String(config.VpcId),
+		TargetType:                 elbv2types.TargetTypeEnumIp,
+		HealthCheckProtocol:        elbv2types.ProtocolEnumHttp,
+		HealthCheckPath:            aws.String(settings.HealthCheckPath),
+		Matcher:                    &elbv2types.Matcher{HttpCode: aws.String(settings.Matcher)},
+		HealthCheckIntervalSeconds: aws.Int32(settings.Interval),
+		HealthCheckTimeoutSeconds:  aws.Int32(settings.Timeout),
+		HealthyThresholdCount:      aws.Int32(settings.HealthyThreshold),
+		UnhealthyThresholdCount:    aws.Int32(settings.UnhealthyThreshold),
+		Tags:                       elbv2Tags(config.ResourceTags()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create target group: %w", err)
+	}
+	if len(output.TargetGroups) == 0 {
+		return nil, fmt.Errorf("target group %s was not returned after creation", name)
+	}
+	group := output.TargetGroups[0]
+
+	// Attributes cannot be set on creation
+	if err := d.setTargetGroupAttributes(aws.ToString(group.TargetGroupArn), config); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Created target group: %s\n", name)
+	return &group, nil
+}
+
+// syncTargetGroup modifies the health check and attributes of an existing
+// target group where they differ from the config.
+func (d *ECSDeployer) syncTargetGroup(config ECSConfig, group elbv2types.TargetGroup) error {
+	name := aws.ToString(group.TargetGroupName)
+	arn := aws.ToString(group.TargetGroupArn)
+	updated := false
+
+	if differences := healthCheckDifferences(config, group); len(differences) > 0 {
+		fmt.Printf("Updating health check of target group %s: %s\n", name, strings.Join(differences, ", "))
+		settings := config.TargetGroup
+		_, err := d.elbv2Client.ModifyTargetGroup(d.ctx, &elasticloadbalancingv2.ModifyTargetGroupInput{
+			TargetGroupArn:             aws.String(arn),
+			HealthCheckProtocol:        elbv2types.ProtocolEnumHttp,
+			HealthCheckPort:            aws.String("traffic-port"),
+			HealthCheckPath:            aws.String(settings.HealthCheckPath),
+			Matcher:                    &elbv2types.Matcher{HttpCode: aws.String(settings.Matcher)},
+			HealthCheckIntervalSeconds: aws.Int32(settings.Interval),
+			HealthCheckTimeoutSeconds:  aws.Int32(settings.Timeout),
+			HealthyThresholdCount:      aws.Int32(settings.HealthyThreshold),
+			UnhealthyThresholdCount:    aws.Int32(settings.UnhealthyThreshold),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update health check of target group %s: %w", name, err)
+		}
+		updated = true
+	}
+
+	current, err := d.describeTargetGroupAttributes(arn)
+	if err != nil {
+		return err
+	}
+	if differences := attributeDifferences(config, current); len(differences) > 0 {
+		fmt.Printf("Updating attributes of target group %s: %s\n", name, strings.Join(differences, ", "))
+		if err := d.setTargetGroupAttributes(arn, config); err != nil {
+			return err
+		}
+		updated = true
+	}
+
+	if !updated {
+		fmt.Printf("Target group %s matches the configured settings\n", name)
+	}
+	return nil
+}
+
+func (d *ECSDeployer) setTargetGroupAttributes(targetGroupArn string, config ECSConfig) error {
+	desired := targetGroupAttributes(config)
+	attributes := make([]elbv2types.TargetGroupAttribute, 0, len(desired))
+	for _, key := range sortedTagKeys(desired) {
+		attributes = append(attributes, elbv2types.TargetGroupAttribute{
+			Key:   aws.String(key),
+			Value: aws.String(desired[key]),
+		})
+	}
+	_, err := d.elbv2Client.ModifyTargetGroupAttributes(d.ctx, &elasticloadbalancingv2.ModifyTargetGroupAttributesInput{
+		TargetGroupArn: aws.String(targetGroupArn),
+		Attributes:     attributes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set target group attributes: %w", err)
+	}
+	return nil
+}
+
+func (d *ECSDeployer) deleteTargetGroup(targetGroupArn string) error {
+	_, err := d.elbv2Client.DeleteTargetGroup(d.ctx, &elasticloadbalancingv2.DeleteTargetGroupInput{
+		TargetGroupArn: aws.String(targetGroupArn),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete target group %s: %w", targetGroupLabel(targetGroupArn), err)
+	}
+	fmt.Printf("Target group %s deleted\n", targetGroupLabel(targetGroupArn))
+	return nil
+}
+
+// alternateTargetGroupName is where the target group of a rolling service
+// moves when it has to be replaced. The blue and green names take turns, so
+// plan and cleanup know both.
+func alternateTargetGroupName(config ECSConfig, name string) string {
+	if name == GreenTargetGroupName(config.ServiceName) {
+		return BlueTargetGroupName(config.ServiceName)
+	}
+	return GreenTargetGroupName(config.ServiceName)
+}
+
+// createReplacementTargetGroup creates the target group that replaces one in
+// use whose settings cannot be modified in place.
+func (d *ECSDeployer) createReplacementTargetGroup(config ECSConfig, currentArn string, differences []string) (string, error) {
+	current := targetGroupLabel(currentArn)
+	name := alternateTargetGroupName(config, current)
+	fmt.Printf("Replacing target group %s with %s (%s)\n", current, name, strings.Join(differences, ", "))
+
+	group, replace, err := d.ensureTargetGroup(config, name)
+	if err != nil {
+		return "", err
+	}
+	if len(replace) > 0 {
+		return "", fmt.Errorf("target groups %s and %s are both in use and differ from the config (%s); run cleanup first", current, name, strings.Join(replace, ", "))
+	}
+	return aws.ToString(group.TargetGroupArn), nil
+}
+
+// targetGroupReplacement is a rolling service moving to a new target group.
+type targetGroupReplacement struct {
+	loadBalancerArn string
+	current         string
+	replacement     string
+}
+
+// loadBalancers registers the tasks with both target groups while the
+// listener moves, so traffic always has healthy targets.
+func (r *targetGroupReplacement) loadBalancers(config ECSConfig) []types.LoadBalancer {
+	var loadBalancers []types.LoadBalancer
+	for _, arn := range []string{r.current, r.replacement} {
+		loadBalancers = append(loadBalancers, types.LoadBalancer{
+			TargetGroupArn: aws.String(arn),
+			ContainerName:  aws.String(loadBalancerContainer(config)),
+			ContainerPort:  aws.Int32(config.WebAppPort),
+		})
+	}
+	return loadBalancers
+}
+
+// syncServiceTargetGroup corrects the target group of an existing rolling
+// service. It returns a replacement when the group cannot be modified in
+// place; the caller registers the updated tasks with both groups and then
+// completes it.
+func (d *ECSDeployer) syncServiceTargetGroup(config ECSConfig, service types.Service) (*targetGroupReplacement, error) {
+	if len(service.LoadBalancers) == 0 {
+		return nil, nil
+	}
+	currentArn := aws.ToString(service.LoadBalancers[0].TargetGroupArn)
+	group, replace, err := d.ensureTargetGroup(config, targetGroupLabel(currentArn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update target group: %w", err)
+	}
+	if len(replace) == 0 {
+		return nil, nil
+	}
+
+	replacementArn, err := d.createReplacementTargetGroup(config, currentArn, replace)
+	if err != nil {
+		return nil, err
+	}
+	return &targetGroupReplacement{
+		loadBalancerArn: group.LoadBalancerArns[0],
+		current:         currentArn,
+		replacement:     replacementArn,
+	}, nil
+}
+
+// completeTargetGroupReplacement waits for the tasks registered with both
+// target groups, moves the listener to the replacement, lets the service go
+// of the old group and deletes it.
+func (d *ECSDeployer) completeTargetGroupReplacement(config ECSConfig, r *targetGroupReplacement) error {
+	current, replacement := targetGroupLabel(r.current), targetGroupLabel(r.replacement)
+
+	err := d.waitForDeployment(config.ClusterName, config.ServiceName, 10*time.Minute)
+	if err == nil {
+		err = d.waitForTargetsHealthy(r.replacement, 5*time.Minute)
+	}
+	if err != nil {
+		return fmt.Errorf("target group replacement stopped, traffic stays on %s: %w", current, err)
+	}
+
+	if _, err := d.createListener(r.loadBalancerArn, r.replacement, config); err != nil {
+		return fmt.Errorf("failed to move listener to target group %s: %w", replacement, err)
+	}
+	fmt.Printf("Listener moved from %s to %s\n", current, replacement)
+
+	_, err = d.ecsClient.UpdateService(d.ctx, &ecs.UpdateServiceInput{
+		Cluster: aws.String(config.ClusterName),
+		Service: aws.String(config.ServiceName),
+		LoadBalancers: []types.LoadBalancer{
+			{
+				TargetGroupArn: aws.String(r.replacement),
+				ContainerName:  aws.String(loadBalancerContainer(config)),
+				ContainerPort:  aws.Int32(config.WebAppPort),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to detach target group %s from the service: %w", current, err)
+	}
+	if err := d.waitForDeployment(config.ClusterName, config.ServiceName, 10*time.Minute); err != nil {
+		fmt.Printf("Warning: Target group %s was kept, delete it once the service is stable: %v\n", current, err)
+		return nil
+	}
+	if err := d.deleteTargetGroup(r.current); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	return nil
+}
+
+// replaceIdleTargetGroup recreates the idle target group of a blue/green
+// service with the configured settings. It carries no traffic, so only the
+// task sets kept behind it for switch-back are lost.
+func (d *ECSDeployer) replaceIdleTargetGroup(config ECSConfig, targets *blueGreenTargets, differences []string) (string, error) {
+	name := targetGroupLabel(targets.idle)
+	if service, err := d.describeService(config); err == nil {
+		if primary := primaryTaskSet(service); primary != nil && taskSetTargetGroup(*primary) == targets.idle {
+			fmt.Printf("Warning: Target group %s differs in %s but the primary task set runs behind it; it is replaced once traffic moves off it\n", name, strings.Join(differences, ", "))
+			return targets.idle, nil
+		}
+		for _, taskSet := range service.TaskSets {
+			if taskSetTargetGroup(taskSet) == targets.idle {
+				d.deleteTaskSet(config, aws.ToString(taskSet.Id))
+			}
+		}
+	}
+
+	fmt.Printf("Replacing idle target group %s (%s)\n", name, strings.Join(differences, ", "))
+	// The listener must not reference the group for it to be deleted
+	if err := d.shiftTraffic(targets.listenerArn, map[string]int32{targets.active: 100}); err != nil {
+		return "", err
+	}
+	if err := d.deleteTargetGroup(targets.idle); err != nil {
+		return "", err
+	}
+	group, err := d.createTargetGroup(config, name)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(group.TargetGroupArn), nil
+}
+
+// planTargetGroup describes what ensureTargetGroup does to the named target
+// group; replacement says how a group in use is replaced.
+func (d *ECSDeployer) planTargetGroup(plan *Plan, config ECSConfig, name, replacement string) {
+	if err := validateTargetGroup(config); err != nil {
+		plan.add("Target Group", name, PlanConflict, err.Error())
+		return
+	}
+	group, err := d.describeTargetGroup(name)
+	if err != nil || group == nil {
+		plan.add("Target Group", name, PlanCreate, targetGroupSettingsLabel(config))
+		return
+	}
+
+	if replace := targetGroupReplacements(config, *group); len(replace) > 0 {
+		if len(group.LoadBalancerArns) == 0 {
+			plan.add("Target Group", name, PlanUpdate, fmt.Sprintf("recreated, not in use: %s", strings.Join(replace, ", ")))
+		} else {
+			plan.add("Target Group", name, PlanUpdate, fmt.Sprintf("%s: %s", replacement, strings.Join(replace, ", ")))
+		}
+		return
+	}
+
+	differences := healthCheckDifferences(config, *group)
+	if attributes, err := d.describeTargetGroupAttributes(aws.ToString(group.TargetGroupArn)); err == nil {
+		differences = append(differences, attributeDifferences(config, attributes)...)
+	}
+	if len(differences) > 0 {
+		plan.add("Target Group", name, PlanUpdate, fmt.Sprintf("modified in place: %s", strings.Join(differences, ", ")))
+	} else {
+		plan.add("Target Group", name, PlanNoOp, "matches the configured settings")
+	}
+}
@@ -0,0 +1,692 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	appconfig "opsagents/internal/config"
+	"opsagents/pkg/tools"
+)
+
+// RegisterTools registers the ECS deployment tools.
+func RegisterTools(registry *tools.Registry, cfg *appconfig.Config) error {
+	return registry.Register(
+		&planTool{cfg: cfg},
+		&deployTool{cfg: cfg},
+		&statusTool{cfg: cfg},
+		&inventoryTool{cfg: cfg},
+		&revisionsTool{cfg: cfg},
+		&rollbackTool{cfg: cfg},
+		&switchBackTool{cfg: cfg},
+		&scaleTool{cfg: cfg},
+		&recommendTool{cfg: cfg},
+		&cleanupTool{cfg: cfg},
+	)
+}
+
+type planTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *planTool) Name() string {
+	return "plan_deployment"
+}
+
+func (t *planTool) Description() string {
+	return "Preview a deployment without changing anything: lists each resource that would be created, updated or left unchanged, and the task definition that would be registered. Use it to show the user the plan before deploy_application."
+}
+
+func (t *planTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the ECS service to plan for",
+			},
+			"include_task_definition": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Include the full task definition JSON in the result",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (t *planTool) Risk() tools.Risk {
+	return tools.RiskReadOnly
+}
+
+func (t *planTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing plan_deployment tool")
+
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+
+	// Progress lines would interleave with the streamed model output; the
+	// plan itself is the tool result
+	plan, err := deployer.Plan(ecsConfig, io.Discard)
+	if err != nil {
+		return "", fmt.Errorf("failed to plan deployment: %w", err)
+	}
+
+	if !tools.Bool(input, "include_task_definition", false) {
+		return plan.String(), nil
+	}
+
+	planJSON, err := plan.JSON()
+	if err != nil {
+		return "", fmt.Errorf("failed to render plan: %w", err)
+	}
+	return plan.String() + "\n" + string(planJSON), nil
+}
+
+type deployTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *deployTool) Name() string {
+	return "deploy_application"
+}
+
+func (t *deployTool) Description() string {
+	return "Deploy the application containers to AWS ECS Fargate"
+}
+
+func (t *deployTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the ECS service to deploy to",
+			},
+			"wait_for_ready": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Whether to wait for service to become ready",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (t *deployTool) Risk() tools.Risk {
+	return tools.RiskMutating
+}
+
+// Summarize shows the deployment plan, falling back to the static resource
+// list when the current state cannot be read.
+func (t *deployTool) Summarize(ctx context.Context, input map[string]interface{}) string {
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+
+	deployer, err := NewECSDeployer()
+	if err == nil {
+		// Progress output would interleave with the approval prompt
+		if plan, err := deployer.Plan(ecsConfig, io.Discard); err == nil {
+			return plan.String()
+		}
+	}
+	return DeploymentSummary(ecsConfig)
+}
+
+func (t *deployTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing deploy_application tool")
+
+	// Initialize ECS deployer
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+	if err := ValidateConfig(ecsConfig); err != nil {
+		return "", err
+	}
+
+	// Create ECS cluster
+	if err := deployer.CreateCluster(ecsConfig); err != nil {
+		log.Printf("ECS cluster might already exist: %v", err)
+	}
+
+	// Use advanced deployment if advanced features are enabled
+	if ecsConfig.CreateSecrets || ecsConfig.CreateEFS {
+		if err := deployer.DeployAdvanced(ecsConfig); err != nil {
+			return "", fmt.Errorf("failed to deploy with advanced features: %w", err)
+		}
+	} else {
+		// Basic deployment
+		if err := deployer.CreateTaskDefinition(ecsConfig); err != nil {
+			return "", fmt.Errorf("failed to create task definition: %w", err)
+		}
+	}
+
+	// Create ECS service (for both advanced and basic deployments)
+	if err := deployer.CreateService(ecsConfig); err != nil {
+		if rollout := deployer.LastRollout(); rollout != nil {
+			return "", fmt.Errorf("failed to create ECS service: %w\n%s", err, rollout)
+		}
+		return "", fmt.Errorf("failed to create ECS service: %w", err)
+	}
+
+	// Wait for service to be stable if requested
+	if tools.Bool(input, "wait_for_ready", true) {
+		if err := deployer.WaitForServiceStable(ecsConfig.ClusterName, ecsConfig.ServiceName); err != nil {
+			var circuitBreaker *CircuitBreakerError
+			if errors.As(err, &circuitBreaker) {
+				return "", err
+			}
+			return "", fmt.Errorf("failed waiting for service to be stable: %w", err)
+		}
+	}
+
+	result := fmt.Sprintf("ECS deployment to service '%s' completed successfully!", ecsConfig.ServiceName)
+	if url, err := deployer.ServiceURL(ecsConfig); err == nil {
+		result += fmt.Sprintf("\nURL: %s", url)
+	}
+	if secrets := deployer.LastSecrets(); secrets != nil {
+		result += "\n" + secrets.String()
+	}
+	if rollout := deployer.LastRollout(); rollout != nil {
+		result += "\n" + rollout.String()
+	}
+	return result, nil
+}
+
+type statusTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *statusTool) Name() string {
+	return "get_deployment_status"
+}
+
+func (t *statusTool) Description() string {
+	return "Get the current status of a deployed application"
+}
+
+func (t *statusTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the ECS service to check",
+			},
+		},
+		Required: []string{"service_name"},
+	}
+}
+
+func (t *statusTool) Risk() tools.Risk {
+	return tools.RiskReadOnly
+}
+
+func (t *statusTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing get_deployment_status tool")
+
+	serviceName := tools.String(input, "service_name", "")
+	if serviceName == "" {
+		return "", fmt.Errorf("service_name parameter is required")
+	}
+
+	// Initialize ECS deployer
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	status, err := deployer.GetServiceStatus(t.cfg.AWS.ECS.ClusterName, serviceName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get service status: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = serviceName
+	if url, err := deployer.ServiceURL(ecsConfig); err == nil {
+		status += fmt.Sprintf("\nURL: %s", url)
+	}
+	if scaling, err := deployer.ScalingStatus(ecsConfig); err == nil {
+		status += "\n" + scaling
+	}
+	if containers, err := deployer.ContainerStatus(ecsConfig); err == nil {
+		status += containers
+	}
+
+	state, err := deployer.LoadState(ecsConfig)
+	if err != nil {
+		return status + fmt.Sprintf("\nWarning: %v\n", err), nil
+	}
+
+	return status + "\n" + state.Summary(), nil
+}
+
+type inventoryTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *inventoryTool) Name() string {
+	return "list_managed_resources"
+}
+
+func (t *inventoryTool) Description() string {
+	return "List the AWS resources tagged managed-by=opsagents for a service and environment, or for all services, using the Resource Groups Tagging API. Use it to find orphaned resources."
+}
+
+func (t *inventoryTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the ECS service to list resources for",
+			},
+			"all": map[string]interface{}{
+				"type":        "boolean",
+				"description": "List the resources of every service and environment",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (t *inventoryTool) Risk() tools.Risk {
+	return tools.RiskReadOnly
+}
+
+func (t *inventoryTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing list_managed_resources tool")
+
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+
+	resources, err := deployer.Inventory(ecsConfig, tools.Bool(input, "all", false))
+	if err != nil {
+		return "", err
+	}
+	return InventorySummary(resources), nil
+}
+
+type revisionsTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *revisionsTool) Name() string {
+	return "list_task_definition_revisions"
+}
+
+func (t *revisionsTool) Description() string {
+	return "List recent revisions of the task definition family with their container images and registration times, marking the revision the service runs. Use it before rollback_deployment to pick a revision."
+}
+
+func (t *revisionsTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the ECS service to list revisions for",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Number of revisions to list, 1-100 (default 10)",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (t *revisionsTool) Risk() tools.Risk {
+	return tools.RiskReadOnly
+}
+
+func (t *revisionsTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing list_task_definition_revisions tool")
+
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+
+	// ListTaskDefinitions accepts 1-100 results per page
+	limit := tools.Int(input, "limit", 10)
+	if limit < 1 {
+		limit = 1
+	} else if limit > 100 {
+		limit = 100
+	}
+	revisions, err := deployer.ListRevisions(ecsConfig, int32(limit))
+	if err != nil {
+		return "", err
+	}
+	return RevisionsSummary(ecsConfig, revisions), nil
+}
+
+type rollbackTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *rollbackTool) Name() string {
+	return "rollback_deployment"
+}
+
+func (t *rollbackTool) Description() string {
+	return "Roll the ECS service back to an earlier task definition revision and wait for it to become stable. Without to_revision it uses the newest revision older than the one running."
+}
+
+func (t *rollbackTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the ECS service to roll back",
+			},
+			"to_revision": map[string]interface{}{
+				"type":        "integer",
+				"description": "Task definition revision to roll back to (default: the previous revision)",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (t *rollbackTool) Risk() tools.Risk {
+	return tools.RiskMutating
+}
+
+func (t *rollbackTool) Summarize(ctx context.Context, input map[string]interface{}) string {
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return ""
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+	current, target, err := deployer.RollbackTarget(ecsConfig, int32(tools.Int(input, "to_revision", 0)))
+	if err != nil {
+		return fmt.Sprintf("This will roll back service %s, but the target revision could not be resolved: %v\n", ecsConfig.ServiceName, err)
+	}
+	return fmt.Sprintf("This will update service %s\n  from %s\n  to   %s\n", ecsConfig.ServiceName, current, target)
+}
+
+func (t *rollbackTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing rollback_deployment tool")
+
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+
+	result, err := deployer.Rollback(ecsConfig, int32(tools.Int(input, "to_revision", 0)))
+	if err != nil {
+		return "", fmt.Errorf("rollback failed: %w", err)
+	}
+	return result.String(), nil
+}
+
+type switchBackTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *switchBackTool) Name() string {
+	return "switch_back_deployment"
+}
+
+func (t *switchBackTool) Description() string {
+	return "For blue/green services, move the load balancer traffic back to the previous task set kept by the last deployment. This is instant because the previous tasks are still running."
+}
+
+func (t *switchBackTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the ECS service to switch back",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (t *switchBackTool) Risk() tools.Risk {
+	return tools.RiskMutating
+}
+
+func (t *switchBackTool) Summarize(ctx context.Context, input map[string]interface{}) string {
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+	return fmt.Sprintf("This will shift all traffic of service %s back to the previous task set.\n", ecsConfig.ServiceName)
+}
+
+func (t *switchBackTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing switch_back_deployment tool")
+
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+
+	result, err := deployer.SwitchBack(ecsConfig)
+	if err != nil {
+		return "", fmt.Errorf("switch-back failed: %w", err)
+	}
+	return result, nil
+}
+
+type scaleTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *scaleTool) Name() string {
+	return "scale_service"
+}
+
+func (t *scaleTool) Description() string {
+	return "Change the capacity of the ECS service: set the desired task count and/or the auto scaling min and max task counts. Omitted values stay unchanged. The next deploy resets the auto scaling bounds to the config."
+}
+
+func (t *scaleTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the ECS service to scale",
+			},
+			"desired_count": map[string]interface{}{
+				"type":        "integer",
+				"description": "Number of tasks to run now (must be within the auto scaling bounds)",
+			},
+			"min_tasks": map[string]interface{}{
+				"type":        "integer",
+				"description": "Minimum task count for auto scaling",
+			},
+			"max_tasks": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum task count for auto scaling",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (t *scaleTool) Risk() tools.Risk {
+	return tools.RiskMutating
+}
+
+func (t *scaleTool) Summarize(ctx context.Context, input map[string]interface{}) string {
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+	var changes []string
+	if desired := tools.Int(input, "desired_count", 0); desired > 0 {
+		changes = append(changes, fmt.Sprintf("desired count -> %d", desired))
+	}
+	if min := tools.Int(input, "min_tasks", 0); min > 0 {
+		changes = append(changes, fmt.Sprintf("min tasks -> %d", min))
+	}
+	if max := tools.Int(input, "max_tasks", 0); max > 0 {
+		changes = append(changes, fmt.Sprintf("max tasks -> %d", max))
+	}
+	return fmt.Sprintf("This will scale service %s: %s\n", ecsConfig.ServiceName, strings.Join(changes, ", "))
+}
+
+func (t *scaleTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing scale_service tool")
+
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+
+	result, err := deployer.ScaleService(ecsConfig,
+		int32(tools.Int(input, "desired_count", 0)),
+		int32(tools.Int(input, "min_tasks", 0)),
+		int32(tools.Int(input, "max_tasks", 0)))
+	if err != nil {
+		return "", fmt.Errorf("scaling failed: %w", err)
+	}
+	return result, nil
+}
+
+type recommendTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *recommendTool) Name() string {
+	return "recommend_task_size"
+}
+
+func (t *recommendTool) Description() string {
+	return "Recommend a Fargate task CPU and memory size for the ECS service from its recent Container Insights utilization, with the cost difference and the task_cpu/task_memory config to apply it. Requires Container Insights on the cluster."
+}
+
+func (t *recommendTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the ECS service to size",
+			},
+			"days": map[string]interface{}{
+				"type":        "integer",
+				"description": "Days of utilization to look at, 1-30 (default: 14)",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (t *recommendTool) Risk() tools.Risk {
+	return tools.RiskReadOnly
+}
+
+func (t *recommendTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing recommend_task_size tool")
+
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+
+	recommendation, err := deployer.Recommend(ecsConfig, tools.Int(input, "days", 14))
+	if err != nil {
+		return "", err
+	}
+	return recommendation.String(), nil
+}
+
+type cleanupTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *cleanupTool) Name() string {
+	return "cleanup_resources"
+}
+
+func (t *cleanupTool) Description() string {
+	return "Clean up all AWS ECS resources including services, clusters, load balancers, and log groups"
+}
+
+func (t *cleanupTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"confirm": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Set to true to confirm resource deletion",
+			},
+			"service_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional service name to clean up specific resources",
+			},
+		},
+		Required: []string{"confirm"},
+	}
+}
+
+func (t *cleanupTool) Risk() tools.Risk {
+	return tools.RiskDestructive
+}
+
+func (t *cleanupTool) Summarize(ctx context.Context, input map[string]interface{}) string {
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+	return CleanupSummary(ecsConfig)
+}
+
+func (t *cleanupTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing cleanup_resources tool")
+
+	// Check confirmation
+	if !tools.Bool(input, "confirm", false) {
+		return "Cleanup cancelled. The 'confirm' parameter must be set to true to proceed with resource deletion.", nil
+	}
+
+	// Initialize ECS deployer
+	deployer, err := NewECSDeployer()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize ECS deployer: %w", err)
+	}
+
+	ecsConfig := NewECSConfig(t.cfg)
+	ecsConfig.ServiceName = tools.String(input, "service_name", ecsConfig.ServiceName)
+
+	if err := deployer.Cleanup(ecsConfig); err != nil {
+		return "", fmt.Errorf("cleanup failed: %w", err)
+	}
+
+	return fmt.Sprintf("✅ Successfully cleaned up all AWS ECS resources for service '%s'! This included:\n- ECS Service and Tasks\n- Task Definitions\n- Load Balancer and Target Groups\n- CloudWatch Log Groups\n- ECS Cluster (if empty)", ecsConfig.ServiceName), nil
+}
@@ -0,0 +1,70 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"opsagents/pkg/deploy"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+)
+
+// Reader fetches container logs from CloudWatch Logs.
+type Reader struct {
+	client *cloudwatchlogs.Client
+}
+
+func NewReader() (*Reader, error) {
+	cfg, err := deploy.LoadAWSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{client: cloudwatchlogs.NewFromConfig(cfg)}, nil
+}
+
+// Query selects the log events to fetch.
+type Query struct {
+	LogGroup string
+	Since    time.Duration
+	Filter   string
+	Limit    int
+}
+
+// Recent returns the most recent log lines of the group, oldest first.
+func (r *Reader) Recent(ctx context.Context, query Query) ([]string, error) {
+	if query.Limit <= 0 {
+		query.Limit = 50
+	}
+
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: aws.String(query.LogGroup),
+		StartTime:    aws.Int64(time.Now().Add(-query.Since).UnixMilli()),
+	}
+	if query.Filter != "" {
+		input.FilterPattern = aws.String(query.Filter)
+	}
+
+	// Events are returned oldest first, so page through the window and keep
+	// only the tail
+	var lines []string
+	paginator := cloudwatchlogs.NewFilterLogEventsPaginator(r.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log group %s: %w", query.LogGroup, err)
+		}
+		for _, event := range page.Events {
+			timestamp := time.UnixMilli(aws.ToInt64(event.Timestamp)).UTC().Format(time.RFC3339)
+			lines = append(lines, fmt.Sprintf("%s %s", timestamp, strings.TrimRight(aws.ToString(event.Message), "\n")))
+		}
+		if len(lines) > query.Limit {
+			lines = lines[len(lines)-query.Limit:]
+		}
+	}
+
+	return lines, nil
+}
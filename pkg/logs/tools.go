@@ -0,0 +1,87 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	appconfig "opsagents/internal/config"
+	"opsagents/pkg/deploy"
+	"opsagents/pkg/tools"
+)
+
+// RegisterTools registers the log inspection tools.
+func RegisterTools(registry *tools.Registry, cfg *appconfig.Config) error {
+	return registry.Register(&serviceLogsTool{cfg: cfg})
+}
+
+type serviceLogsTool struct {
+	cfg *appconfig.Config
+}
+
+func (t *serviceLogsTool) Name() string {
+	return "get_service_logs"
+}
+
+func (t *serviceLogsTool) Description() string {
+	return "Fetch recent CloudWatch log lines of a container in the deployed ECS task, e.g. to diagnose failing deployments"
+}
+
+func (t *serviceLogsTool) InputSchema() tools.InputSchema {
+	return tools.InputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"container": map[string]interface{}{
+				"type":        "string",
+				"description": "Container to read logs from (webapp or database, default webapp)",
+			},
+			"minutes": map[string]interface{}{
+				"type":        "integer",
+				"description": "How many minutes back to look (default 15)",
+			},
+			"filter": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional CloudWatch Logs filter pattern, e.g. ERROR",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of lines to return (default 50)",
+			},
+		},
+		Required: []string{},
+	}
+}
+
+func (t *serviceLogsTool) Risk() tools.Risk {
+	return tools.RiskReadOnly
+}
+
+func (t *serviceLogsTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	log.Println("Executing get_service_logs tool")
+
+	reader, err := NewReader()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize log reader: %w", err)
+	}
+
+	container := tools.String(input, "container", "webapp")
+	logGroup := deploy.LogGroupName(t.cfg.AWS.ECS.TaskDefinitionName, container)
+	minutes := tools.Int(input, "minutes", 15)
+
+	lines, err := reader.Recent(ctx, Query{
+		LogGroup: logGroup,
+		Since:    time.Duration(minutes) * time.Minute,
+		Filter:   tools.String(input, "filter", ""),
+		Limit:    tools.Int(input, "limit", 50),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(lines) == 0 {
+		return fmt.Sprintf("No log events in %s during the last %d minutes", logGroup, minutes), nil
+	}
+	return fmt.Sprintf("Last %d log lines from %s:\n%s", len(lines), logGroup, strings.Join(lines, "\n")), nil
+}
@@ -0,0 +1,28 @@
+package tools
+
+// String returns a non-empty string input or the fallback.
+func String(input map[string]interface{}, key, fallback string) string {
+	if value, ok := input[key].(string); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Bool returns a boolean input or the fallback.
+func Bool(input map[string]interface{}, key string, fallback bool) bool {
+	if value, ok := input[key].(bool); ok {
+		return value
+	}
+	return fallback
+}
+
+// Int returns a numeric input or the fallback. JSON numbers decode as float64.
+func Int(input map[string]interface{}, key string, fallback int) int {
+	switch value := input[key].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	}
+	return fallback
+}
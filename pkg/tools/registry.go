@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Tool is a single capability that Claude can call. Implementations live next
+// to the code they drive (deploy, builder, logs) and register themselves with
+// a Registry.
+type Tool interface {
+	// Name is the identifier Claude uses in tool_use blocks
+	Name() string
+	// Description tells Claude when and how to use the tool
+	Description() string
+	// InputSchema is the JSON schema of the tool input
+	InputSchema() InputSchema
+	// Risk classifies what the tool may change
+	Risk() Risk
+	// Execute runs the tool and returns the text result sent back to Claude.
+	// Returned errors are reported to Claude as failed tool results.
+	Execute(ctx context.Context, input map[string]interface{}) (string, error)
+}
+
+type InputSchema struct {
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties"`
+	Required   []string               `json:"required"`
+}
+
+// Definition is the JSON form of a tool in the model request tools array.
+type Definition struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema InputSchema `json:"input_schema"`
+}
+
+// Registry holds the tools available to the agent, in registration order.
+type Registry struct {
+	mu       sync.RWMutex
+	tools    map[string]Tool
+	order    []string
+	disabled map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		tools:    map[string]Tool{},
+		disabled: map[string]bool{},
+	}
+}
+
+// Register adds tools to the registry. Tool names must be unique.
+func (r *Registry) Register(tools ...Tool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, tool := range tools {
+		name := tool.Name()
+		if name == "" {
+			return fmt.Errorf("tool name must not be empty")
+		}
+		if _, exists := r.tools[name]; exists {
+			return fmt.Errorf("tool %s is already registered", name)
+		}
+		r.tools[name] = tool
+		r.order = append(r.order, name)
+	}
+	return nil
+}
+
+// Configure applies the enabled/disabled lists from the config. A non-empty
+// enabled list acts as an allow list; disabled tools are removed afterwards.
+// Unknown names are reported so typos in the config do not go unnoticed.
+func (r *Registry) Configure(enabled, disabled []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unknown []string
+	for _, name := range append(append([]string{}, enabled...), disabled...) {
+		if _, ok := r.tools[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	r.disabled = map[string]bool{}
+	if len(enabled) > 0 {
+		allowed := map[string]bool{}
+		for _, name := range enabled {
+			allowed[name] = true
+		}
+		for _, name := range r.order {
+			if !allowed[name] {
+				r.disabled[name] = true
+			}
+		}
+	}
+	for _, name := range disabled {
+		r.disabled[name] = true
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown tools in config: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// SetEnabled enables or disables a registered tool.
+func (r *Registry) SetEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tools[name]; !ok {
+		return fmt.Errorf("unknown tool: %s", name)
+	}
+	if enabled {
+		delete(r.disabled, name)
+	} else {
+		r.disabled[name] = true
+	}
+	return nil
+}
+
+// Get returns an enabled tool by name.
+func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tool, ok := r.tools[name]
+	if !ok || r.disabled[name] {
+		return nil, false
+	}
+	return tool, true
+}
+
+// Enabled returns the enabled tools in registration order.
+func (r *Registry) Enabled() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tools []Tool
+	for _, name := range r.order {
+		if !r.disabled[name] {
+			tools = append(tools, r.tools[name])
+		}
+	}
+	return tools
+}
+
+// Definitions generates the tools array for the model request from the
+// enabled tools.
+func (r *Registry) Definitions() []Definition {
+	var definitions []Definition
+	for _, tool := range r.Enabled() {
+		definitions = append(definitions, Definition{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			InputSchema: tool.InputSchema(),
+		})
+	}
+	return definitions
+}
+
+// Execute runs an enabled tool by name.
+func (r *Registry) Execute(ctx context.Context, name string, input map[string]interface{}) (string, error) {
+	tool, ok := r.Get(name)
+	if !ok {
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	return tool.Execute(ctx, input)
+}
@@ -0,0 +1,40 @@
+package tools
+
+import "context"
+
+// Risk classifies what a tool may change, which decides whether a human has
+// to approve it before it runs.
+type Risk int
+
+const (
+	// RiskReadOnly tools only inspect state and always run
+	RiskReadOnly Risk = iota
+	// RiskMutating tools create or update resources
+	RiskMutating
+	// RiskDestructive tools delete resources or data
+	RiskDestructive
+)
+
+func (r Risk) String() string {
+	switch r {
+	case RiskReadOnly:
+		return "read-only"
+	case RiskMutating:
+		return "mutating"
+	case RiskDestructive:
+		return "destructive"
+	default:
+		return "unknown"
+	}
+}
+
+// RequiresApproval reports whether tools of this risk need human approval.
+func (r Risk) RequiresApproval() bool {
+	return r != RiskReadOnly
+}
+
+// Summarizer is implemented by tools that can describe exactly what a call
+// would change, shown to the user when asking for approval.
+type Summarizer interface {
+	Summarize(ctx context.Context, input map[string]interface{}) string
+}